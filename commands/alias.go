@@ -0,0 +1,117 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Alias() Command {
+	return Command{
+		Name:        "alias",
+		Description: "Другое имя для счета: /alias <счет> <псевдоним>",
+		Hidden:      false,
+		Role:        model.RoleEditor,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			args := strings.TrimSpace(msg.CommandArguments())
+			if args == "" {
+				return sendAliases(ctx, d, chatID)
+			}
+
+			accName, alias, rest := splitTwoNames(args)
+			if alias == "" || rest != "" {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AliasUsage)))
+				return nil
+			}
+
+			acc, err := findAccount(ctx, d, chatID, accName)
+			if errors.Is(err, sqlite.ErrNotFound) || errors.Is(err, sqlite.ErrArchived) {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, accName)))
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			// An alias must not shadow another account's name.
+			other, err := findAccount(ctx, d, chatID, alias)
+			if err == nil || errors.Is(err, sqlite.ErrArchived) {
+				if other == nil || other.Id != acc.Id {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AliasTaken, alias)))
+					return nil
+				}
+			} else if !errors.Is(err, sqlite.ErrNotFound) {
+				return err
+			}
+
+			err = d.Storage.AddAlias(ctx, chatID, acc.Id, alias)
+			if errors.Is(err, sqlite.ErrAccountExists) {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AliasTaken, alias)))
+				return nil
+			}
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+
+			_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AliasAdded, acc.Name, alias)))
+			return nil
+		},
+	}
+}
+
+func Unalias() Command {
+	return Command{
+		Name:        "unalias",
+		Description: "Удалить псевдоним счета",
+		Hidden:      true,
+		Role:        model.RoleEditor,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			alias := strings.TrimSpace(msg.CommandArguments())
+			if alias == "" {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AliasUsage)))
+				return nil
+			}
+
+			err := d.Storage.RemoveAlias(ctx, chatID, alias)
+			if errors.Is(err, sqlite.ErrNotFound) {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AliasNotFound, alias)))
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AliasRemoved, alias)))
+			return nil
+		},
+	}
+}
+
+func sendAliases(ctx context.Context, d Deps, chatID int64) error {
+	aliases, err := d.Storage.ListAliases(ctx, chatID)
+	if err != nil {
+		return err
+	}
+	if len(aliases) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoAliasesYet)))
+		return nil
+	}
+
+	rows := make([][]string, len(aliases))
+	for i, a := range aliases {
+		rows[i] = []string{a.Alias, "→", a.Account}
+	}
+
+	out := api.NewMessage(chatID, "<pre>"+renderPre(rows, []bool{false, false, false})+"</pre>")
+	out.ParseMode = "HTML"
+	_, _ = d.Bot.Send(out)
+	return nil
+}
@@ -0,0 +1,108 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/internal/backup"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Backup() Command {
+	return Command{
+		Name:        "backup",
+		Description: "Резервная копия всех счетов чата в JSON",
+		Hidden:      false,
+		Role:        model.RoleOwner,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			f, err := d.Storage.Backup(ctx, chatID)
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+			if len(f.Accounts) == 0 {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoAccountsYet)))
+				return nil
+			}
+			// A copy that /restore would refuse is no use: say so now.
+			if err := f.Validate(); err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.BackupInconsistent, err)))
+				return nil
+			}
+
+			var buf bytes.Buffer
+			if err := backup.Encode(&buf, f); err != nil {
+				return err
+			}
+			name := fmt.Sprintf("backup_%d_%s.json", chatID, f.CreatedAt.Format("20060102_150405Z"))
+			doc := api.NewDocument(chatID, api.FileBytes{Name: name, Bytes: buf.Bytes()})
+			doc.Caption = msgs.T(msgs.BackupCaption, len(f.Accounts), len(f.Transactions))
+			_, err = d.Bot.Send(doc)
+			return err
+		},
+	}
+}
+
+// restoreBackup answers a backup sent with the /restore caption with what
+// restoring it would add, and asks to confirm.
+func restoreBackup(ctx context.Context, d Deps, msg *api.Message) error {
+	chatID := msg.Chat.ID
+	f, sum, err := loadBackup(ctx, d, chatID, msg, true)
+	if err != nil {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, restoreErrorText(err, sum)))
+		return nil
+	}
+
+	out := api.NewMessage(chatID, msgs.T(msgs.BackupConfirm, f.CreatedAt.Local().Format("02.01.2006 15:04"), renderRestoreSummary(sum)))
+	out.ReplyParameters.MessageID = msg.MessageID
+	out.ReplyMarkup = api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(
+		api.NewInlineKeyboardButtonData("Восстановить", "rbk:yes"),
+		api.NewInlineKeyboardButtonData("Отмена", "rbk:no"),
+	))
+	_, err = d.Bot.Send(out)
+	return err
+}
+
+// loadBackup reads the backup of msg and restores it to the chat, or with
+// dryRun only rehearses that.
+func loadBackup(ctx context.Context, d Deps, chatID int64, msg *api.Message, dryRun bool) (*backup.File, sqlite.RestoreSummary, error) {
+	data, err := downloadDocument(ctx, d, msg.Document)
+	if err != nil {
+		return nil, sqlite.RestoreSummary{}, err
+	}
+	f, err := backup.Decode(data)
+	if err != nil {
+		return nil, sqlite.RestoreSummary{}, fileError{err}
+	}
+	sum, err := d.Storage.RestoreBackup(ctx, chatID, f, dryRun)
+	return f, sum, err
+}
+
+func renderRestoreSummary(sum sqlite.RestoreSummary) string {
+	text := msgs.T(msgs.BackupSummary, sum.Accounts, sum.Archived, sum.Transactions, sum.Imports, sum.Aliases, sum.Rates, sum.Members)
+	if sum.KeptMembers > 0 {
+		text += "\n" + msgs.T(msgs.BackupMembersKept, sum.KeptMembers)
+	}
+	if !sum.SameChat {
+		text += "\n" + msgs.T(msgs.BackupOtherChat)
+	}
+	return text
+}
+
+func restoreErrorText(err error, sum sqlite.RestoreSummary) string {
+	var fe fileError
+	switch {
+	case errors.Is(err, sqlite.ErrRestoreConflict):
+		return msgs.T(msgs.BackupConflict, strings.Join(sum.Conflicts, ", "))
+	case errors.As(err, &fe):
+		return msgs.T(msgs.BackupInvalid, fe.Error())
+	}
+	return msgs.T(msgs.UnsuccessfulOperation)
+}
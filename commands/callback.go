@@ -2,22 +2,54 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"os"
 	"strconv"
 	"strings"
 	"time"
 
 	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/exprsplit"
 	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/internal/period"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
 )
 
 func HandleCallback(ctx context.Context, d Deps, cq *api.CallbackQuery) {
 	data := cq.Data
+	if cq.Message == nil {
+		return
+	}
+	if need := callbackRole(data); !d.allowed(ctx, cq.Message.Chat, cq.From, need) {
+		_ = answerCB(d.Bot, cq, deniedText(need), true)
+		return
+	}
+
 	if strings.HasPrefix(data, "undo:") {
 		handleUndo(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "undotransfer:") {
+		handleUndoTransfer(ctx, d, cq, data)
 	} else if strings.HasPrefix(data, "statement:") {
 		handleStatement(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "stmt:") {
+		handleStatementExport(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "del:") {
+		handleDel(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "purge:") {
+		handlePurge(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "pick:") {
+		handlePick(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "hist:") {
+		handleHistoryPage(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "find:") {
+		handleFindPage(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "imp:") {
+		handleImport(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "undoimport:") {
+		handleUndoImport(ctx, d, cq, data)
+	} else if strings.HasPrefix(data, "rbk:") {
+		handleRestoreBackup(ctx, d, cq, data)
 	}
 	_ = answerCB(d.Bot, cq, "Unknown action", true)
 }
@@ -27,9 +59,12 @@ func handleUndo(ctx context.Context, d Deps, cq *api.CallbackQuery, data string)
 	txID, err := strconv.Atoi(parts[0])
 	accName := parts[1]
 	if err == nil {
-		newBalance, delta, err := d.Storage.RevertTransaction(ctx, int64(txID))
+		if !canUndo(ctx, d, cq, int64(txID)) {
+			return
+		}
+		newBalance, delta, err := d.Storage.RevertTransaction(ctx, int64(txID), cq.From.ID)
 		if err != nil {
-			_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+			_ = answerCB(d.Bot, cq, revertErrorText(err), true)
 			return
 		}
 		_ = answerCB(d.Bot, cq, "Transaction reverted", false)
@@ -38,11 +73,16 @@ func handleUndo(ctx context.Context, d Deps, cq *api.CallbackQuery, data string)
 			cq.Message.Text+"\n\nДанное изменение отменено ✅")
 		_, _ = d.Bot.Send(edit)
 
+		currency := ""
+		if acc, err := d.Storage.GetAccount(ctx, cq.Message.Chat.ID, accName); err == nil {
+			currency = acc.Currency
+		}
+
 		reply_msg := msgs.T(
 			msgs.BalanceReverted,
-			formatAmount(-delta),
+			formatMoney(-delta, currency),
 			accName,
-			formatAmount(newBalance),
+			formatMoney(newBalance, currency),
 		)
 
 		reply := api.NewMessage(cq.Message.Chat.ID, reply_msg)
@@ -52,31 +92,406 @@ func handleUndo(ctx context.Context, d Deps, cq *api.CallbackQuery, data string)
 	}
 }
 
+func handleUndoTransfer(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	transferID, err := strconv.ParseInt(strings.TrimPrefix(data, "undotransfer:"), 10, 64)
+	if err != nil {
+		return
+	}
+	// A transfer is identified by its outgoing leg.
+	if !canUndo(ctx, d, cq, transferID) {
+		return
+	}
+
+	legs, err := d.Storage.RevertTransfer(ctx, transferID, cq.From.ID)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, revertErrorText(err), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, msgs.T(msgs.TransferUndoneToast), false)
+
+	edit := api.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID,
+		cq.Message.Text+"\n\n"+msgs.T(msgs.TransferUndoneMark))
+	_, _ = d.Bot.Send(edit)
+
+	var b strings.Builder
+	b.WriteString(msgs.T(msgs.TransferReverted))
+	for _, leg := range legs {
+		b.WriteString("\n")
+		b.WriteString(msgs.T(msgs.AccountBalance, leg.Account, formatMoney(leg.Balance, leg.Currency)))
+	}
+
+	reply := api.NewMessage(cq.Message.Chat.ID, b.String())
+	reply.ReplyParameters.MessageID = cq.Message.MessageID
+	_, _ = d.Bot.Send(reply)
+}
+
+// handleStatement answers the legacy "Получить выписку" button from /get
+// by offering a period to export.
 func handleStatement(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	_ = answerCB(d.Bot, cq, "", false)
+
+	out := api.NewMessage(cq.Message.Chat.ID, msgs.T(msgs.StatementPickPeriod))
+	out.ReplyMarkup = statementPicker(0, 0, time.Now())
+	_, _ = d.Bot.Send(out)
+}
+
+func handleStatementExport(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	chatID := cq.Message.Chat.ID
+	// Buttons sent before formats existed end at the account or the tag.
+	parts := strings.Split(strings.TrimPrefix(data, "stmt:"), ":")
+	for len(parts) < 4 {
+		parts = append(parts, "")
+	}
+	key, acc, tagPart := parts[0], parts[1], parts[2]
+	format := formatCSV
+	if statementFormat(parts[3]) == formatXLSX {
+		format = formatXLSX
+	}
+
+	r, err := period.FromKey(key, time.Local)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	accountID, _ := strconv.Atoi(acc)
+
+	var tag *model.Tag
+	if id, err := strconv.Atoi(tagPart); err == nil && id != 0 {
+		if tag, err = d.Storage.GetTagByID(ctx, chatID, id); err != nil {
+			_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+			return
+		}
+	}
+
+	_ = answerCB(d.Bot, cq, "Готовлю выписку…", false)
+
+	if err := sendStatement(ctx, d, chatID, accountID, "", tag, r, format); err != nil {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, "Не удалось сформировать выписку: "+err.Error()))
+	}
+}
+
+// callbackRole is the least role needed to press a button.
+func callbackRole(data string) model.Role {
+	if strings.HasPrefix(data, "undo:") || strings.HasPrefix(data, "undotransfer:") || strings.HasPrefix(data, "pick:") ||
+		strings.HasPrefix(data, "imp:") || strings.HasPrefix(data, "undoimport:") {
+		return model.RoleEditor
+	}
+	if strings.HasPrefix(data, "del:") || strings.HasPrefix(data, "purge:") || strings.HasPrefix(data, "rbk:") {
+		return model.RoleOwner
+	}
+	return model.RoleViewer
+}
+
+// canUndo lets editors undo their own transactions and owners anyone's,
+// answering the callback when it refuses.
+func canUndo(ctx context.Context, d Deps, cq *api.CallbackQuery, txID int64) bool {
+	if d.allowed(ctx, cq.Message.Chat, cq.From, model.RoleOwner) {
+		return true
+	}
+	t, err := d.Storage.GetTransaction(ctx, txID)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, revertErrorText(err), true)
+		return false
+	}
+	if t.CreatedBy != cq.From.ID {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UndoNotYours), true)
+		return false
+	}
+	return true
+}
+
+// handleDel answers the confirmation of /del.
+func handleDel(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	chatID := cq.Message.Chat.ID
+	arg := strings.TrimPrefix(data, "del:")
+	if arg == "no" {
+		_ = answerCB(d.Bot, cq, "", false)
+		_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, msgs.T(msgs.DelCancelled)))
+		return
+	}
+
+	accountID, err := strconv.Atoi(arg)
+	if err != nil {
+		return
+	}
+	name, err := d.Storage.ArchiveAccount(ctx, chatID, accountID)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, "", false)
+	_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, msgs.T(msgs.AccRemoved, name, name)))
+}
+
+// handlePurge answers the confirmation of /purge. The cutoff comes from the
+// button, so only the accounts that were listed are deleted.
+func handlePurge(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	chatID := cq.Message.Chat.ID
+	arg := strings.TrimPrefix(data, "purge:")
+	if arg == "no" {
+		_ = answerCB(d.Bot, cq, "", false)
+		_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, msgs.T(msgs.PurgeCancelled)))
+		return
+	}
+
+	cutoff, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return
+	}
+
+	names, err := d.Storage.PurgeArchived(ctx, chatID, time.Unix(cutoff, 0))
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, "", false)
+
+	text := msgs.T(msgs.Purged, strings.Join(names, ", "))
+	if len(names) == 0 {
+		days := int(archiveRetention / (24 * time.Hour))
+		text = msgs.T(msgs.PurgeNothing, days)
+	}
+	_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, text))
+}
+
+// handlePick applies a transaction whose account name was not found to the
+// suggested account the author chose. The pending transaction is read back
+// from the message the suggestion replied to.
+func handlePick(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	chatID := cq.Message.Chat.ID
+	accountID, err := strconv.Atoi(strings.TrimPrefix(data, "pick:"))
+	if err != nil {
+		return
+	}
+
+	orig := cq.Message.ReplyToMessage
+	if orig == nil || orig.From == nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.PickGone), true)
+		return
+	}
+	if orig.From.ID != cq.From.ID {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.PickNotYours), true)
+		return
+	}
+	if _, _, err := d.Storage.FindBySourceMessage(ctx, chatID, orig.MessageID); err == nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.AlreadyApplied), true)
+		return
+	}
+
+	typed, args := parseSlash(orig.Text)
+	expression, note, err := exprsplit.SplitExprAndComment(args)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.PickGone), true)
+		return
+	}
+	acc, err := d.Storage.GetAccountByID(ctx, chatID, accountID)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, "", false)
+
+	_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, msgs.T(msgs.AccPicked, typed, acc.Name)))
+	_ = applyTransaction(ctx, d, chatID, acc, expression, note, cq.From.ID, orig.MessageID)
+}
+
+// handleHistoryPage turns a /history page in place.
+func handleHistoryPage(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	parts := strings.Split(strings.TrimPrefix(data, "hist:"), ":")
+	if len(parts) != 3 {
+		return
+	}
+	accountID, err1 := strconv.Atoi(parts[0])
+	n, err2 := strconv.Atoi(parts[1])
+	before, after, err3 := parsePageCursor(parts[2])
+	if err := errors.Join(err1, err2, err3); err != nil {
+		return
+	}
+
+	text, kb, err := renderHistory(ctx, d, cq.Message.Chat.ID, accountID, clampPageSize(n), before, after)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, "", false)
+	editPage(d, cq, text, kb)
+}
+
+// handleFindPage turns a /find page in place. The query is read back from
+// the /find message the results reply to.
+func handleFindPage(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	before, after, err := parsePageCursor(strings.TrimPrefix(data, "find:"))
+	if err != nil {
+		return
+	}
+	orig := cq.Message.ReplyToMessage
+	if orig == nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.FindGone), true)
+		return
+	}
+
+	_, args := parseSlash(orig.Text)
+	q, err := parseFind(ctx, d, cq.Message.Chat.ID, args, time.Unix(int64(orig.Date), 0))
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	text, kb, err := renderFind(ctx, d, cq.Message.Chat, q, before, after)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, "", false)
+	editPage(d, cq, text, kb)
+}
+
+// handleImport answers the confirmation of /import. The file and the column
+// mapping are read back from the document the preview replied to, and the
+// document's message id keeps the file from being imported twice.
+func handleImport(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
 	chatID := cq.Message.Chat.ID
-	if s := strings.TrimPrefix(data, "statement:"); s != data {
-		if v, err := strconv.ParseInt(s, 10, 64); err == nil {
-			chatID = v
+	arg := strings.TrimPrefix(data, "imp:")
+	orig := cq.Message.ReplyToMessage
+	if orig == nil || orig.From == nil || orig.Document == nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.ImportGone), true)
+		return
+	}
+	if orig.From.ID != cq.From.ID {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.ImportNotYours), true)
+		return
+	}
+	if arg == "no" {
+		_ = answerCB(d.Bot, cq, "", false)
+		_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, msgs.T(msgs.ImportCancelled)))
+		return
+	}
+
+	accountID, err := strconv.Atoi(arg)
+	if err != nil {
+		return
+	}
+	_, args := documentCommand(orig)
+	_, spec, _ := strings.Cut(strings.TrimSpace(args), " ")
+	plan, err := loadImport(ctx, d, chatID, orig, spec)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, importErrorText(err), true)
+		return
+	}
+
+	txs := plan.transactions()
+	importID, balance, err := d.Storage.ImportTransactions(ctx, chatID, accountID, orig.MessageID, orig.Document.FileName, cq.From.ID, txs)
+	if errors.Is(err, sqlite.ErrAlreadyImported) {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.ImportAlreadyDone), true)
+		return
+	}
+	if errors.Is(err, sqlite.ErrBackdated) {
+		// Something was recorded after the preview was shown.
+		text := msgs.T(msgs.UnsuccessfulOperation)
+		if acc, err := d.Storage.GetAccountByID(ctx, chatID, accountID); err == nil {
+			if t, err := backdatedImport(ctx, d, acc, plan); err == nil && t != "" {
+				text = t
+			}
 		}
+		_ = answerCB(d.Bot, cq, text, true)
+		return
 	}
+	if err != nil {
+		_ = answerCB(d.Bot, cq, revertErrorText(err), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, "", false)
 
-	answerCB(d.Bot, cq, "Готовлю выписку…", false)
+	acc, err := d.Storage.GetAccountByID(ctx, chatID, accountID)
+	if err != nil {
+		return
+	}
+	edit := api.NewEditMessageText(chatID, cq.Message.MessageID,
+		msgs.T(msgs.ImportDone, len(txs), acc.Name, formatMoney(balance, acc.Currency)))
+	kb := api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(
+		api.NewInlineKeyboardButtonData("Отменить импорт", fmt.Sprintf("undoimport:%d", importID)),
+	))
+	edit.ReplyMarkup = &kb
+	_, _ = d.Bot.Send(edit)
+}
 
-	ts := time.Now().UTC().Format("20060102_150405Z")
-	filename := fmt.Sprintf("statement_%d_%s.csv", chatID, ts)
+// handleUndoImport reverts a whole import. Like single transactions, an
+// import can be undone by whoever loaded it or by an owner.
+func handleUndoImport(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	chatID := cq.Message.Chat.ID
+	importID, err := strconv.ParseInt(strings.TrimPrefix(data, "undoimport:"), 10, 64)
+	if err != nil {
+		return
+	}
+	im, err := d.Storage.GetImport(ctx, chatID, importID)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UnsuccessfulOperation), true)
+		return
+	}
+	if im.CreatedBy != cq.From.ID && !d.allowed(ctx, cq.Message.Chat, cq.From, model.RoleOwner) {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.UndoNotYours), true)
+		return
+	}
 
-	if err := d.Storage.WriteTransactionsCsv(ctx, chatID, filename); err != nil {
-		answerCB(d.Bot, cq, "Не удалось сформировать выписку: "+err.Error(), true)
+	n, err := d.Storage.RevertImport(ctx, chatID, importID, cq.From.ID)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, revertErrorText(err), true)
 		return
 	}
-	defer os.Remove(filename)
+	_ = answerCB(d.Bot, cq, "", false)
+
+	text := cq.Message.Text + "\n\n" + msgs.T(msgs.ImportReverted, n)
+	if acc, err := d.Storage.GetAccountByID(ctx, chatID, im.AccountId); err == nil {
+		text += "\n" + msgs.T(msgs.AccountBalance, acc.Name, formatMoney(acc.Balance, acc.Currency))
+	}
+	_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, text))
+}
 
-	doc := api.NewDocument(chatID, api.FilePath(filename))
-	doc.Caption = "Выписка по счетам"
-	if _, err := d.Bot.Send(doc); err != nil {
-		answerCB(d.Bot, cq, "Не удалось отправить файл: "+err.Error(), true)
+// handleRestoreBackup answers the confirmation of a backup restore. The
+// backup is read back from the document the question replied to; restoring
+// it twice fails on the account names the first restore added.
+func handleRestoreBackup(ctx context.Context, d Deps, cq *api.CallbackQuery, data string) {
+	chatID := cq.Message.Chat.ID
+	orig := cq.Message.ReplyToMessage
+	if orig == nil || orig.From == nil || orig.Document == nil {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.ImportGone), true)
+		return
+	}
+	if orig.From.ID != cq.From.ID {
+		_ = answerCB(d.Bot, cq, msgs.T(msgs.ImportNotYours), true)
+		return
+	}
+	if strings.TrimPrefix(data, "rbk:") != "yes" {
+		_ = answerCB(d.Bot, cq, "", false)
+		_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, msgs.T(msgs.BackupCancelled)))
 		return
 	}
+
+	_, sum, err := loadBackup(ctx, d, chatID, orig, false)
+	if err != nil {
+		_ = answerCB(d.Bot, cq, restoreErrorText(err, sum), true)
+		return
+	}
+	_ = answerCB(d.Bot, cq, "", false)
+	_, _ = d.Bot.Send(api.NewEditMessageText(chatID, cq.Message.MessageID, msgs.T(msgs.BackupRestored, renderRestoreSummary(sum))))
+}
+
+// editPage replaces a paged message with a new page.
+func editPage(d Deps, cq *api.CallbackQuery, text string, kb *api.InlineKeyboardMarkup) {
+	edit := api.NewEditMessageText(cq.Message.Chat.ID, cq.Message.MessageID, text)
+	edit.ParseMode = "HTML"
+	edit.LinkPreviewOptions.IsDisabled = true
+	edit.ReplyMarkup = kb
+	_, _ = d.Bot.Send(edit)
+}
+
+func revertErrorText(err error) string {
+	if errors.Is(err, sqlite.ErrAlreadyReverted) {
+		return msgs.T(msgs.AlreadyReverted)
+	}
+	if errors.Is(err, sqlite.ErrArchived) {
+		return msgs.T(msgs.ArchivedReadOnly)
+	}
+	return msgs.T(msgs.UnsuccessfulOperation)
 }
 
 func answerCB(bot Bot, cq *api.CallbackQuery, text string, alert bool) error {
@@ -0,0 +1,192 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"sort"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/internal/chart"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/internal/period"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Chart() Command {
+	return Command{
+		Name:        "chart",
+		Description: "График: /chart [счет] [период], /chart tags [период]",
+		Hidden:      false,
+		Role:        model.RoleViewer,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			args := strings.TrimSpace(msg.CommandArguments())
+			now := time.Now()
+			if sub, rest, _ := strings.Cut(args, " "); strings.EqualFold(sub, "tags") || strings.EqualFold(sub, "теги") {
+				r, ok := reportPeriod(rest, now)
+				if !ok {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.StatementBadPeriod, rest)))
+					return nil
+				}
+				return sendTagChart(ctx, d, chatID, r)
+			}
+
+			accountID, args, err := cutReportAccount(ctx, d, chatID, args)
+			if err != nil {
+				return err
+			}
+			r := period.All
+			if strings.TrimSpace(args) != "" {
+				if r, err = period.Parse(args, now); err != nil {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.ChartUsage)))
+					return nil
+				}
+			}
+			return sendBalanceChart(ctx, d, chatID, accountID, r, now)
+		},
+	}
+}
+
+// sendBalanceChart draws the running balance of one account, or of every
+// active account when accountID is zero, as step lines over r.
+func sendBalanceChart(ctx context.Context, d Deps, chatID int64, accountID int, r period.Range, now time.Time) error {
+	var accs []*model.Account
+	if accountID != 0 {
+		acc, err := chartAccount(ctx, d, chatID, accountID)
+		if err != nil {
+			return err
+		}
+		accs = append(accs, acc)
+	} else {
+		names, err := d.Storage.GetAll(ctx, chatID)
+		if err != nil {
+			return err
+		}
+		for _, name := range names {
+			acc, err := d.Storage.GetAccount(ctx, chatID, name)
+			if err != nil {
+				return err
+			}
+			accs = append(accs, acc)
+		}
+	}
+	if len(accs) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoAccountsYet)))
+		return nil
+	}
+
+	end := r.To
+	if end.IsZero() || end.After(now) {
+		end = now
+	}
+
+	var (
+		series []chart.Series
+		points int
+	)
+	for _, acc := range accs {
+		bals, err := d.Storage.BalanceSeries(ctx, acc.Id, r.From, r.To)
+		if err != nil {
+			return err
+		}
+		s := chart.Series{Name: acc.Name}
+		if acc.Currency != "" {
+			s.Name += ", " + acc.Currency
+		}
+		for _, p := range bals {
+			s.Points = append(s.Points, chart.Point{T: p.At, V: p.Balance.Float()})
+		}
+		points += len(bals)
+		series = append(series, s)
+	}
+	if points == 0 || (!r.From.IsZero() && points == len(accs)) {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoTransactionsInPeriod, r.Label())))
+		return nil
+	}
+
+	title := "Баланс " + r.Label()
+	if accountID != 0 {
+		title = fmt.Sprintf("Баланс %s %s", accs[0].Name, r.Label())
+	}
+	img, err := chart.Line(title, series, end)
+	if err != nil {
+		return err
+	}
+	return sendChart(d, chatID, img, title)
+}
+
+// chartAccount looks up an account by ID, archived ones included: their
+// history stays viewable.
+func chartAccount(ctx context.Context, d Deps, chatID int64, accountID int) (*model.Account, error) {
+	acc, err := d.Storage.GetAccountByID(ctx, chatID, accountID)
+	if !errors.Is(err, sqlite.ErrNotFound) {
+		return acc, err
+	}
+	archived, err := d.Storage.ListArchived(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range archived {
+		if a.Id == accountID {
+			return &a.Account, nil
+		}
+	}
+	return nil, sqlite.ErrNotFound
+}
+
+// sendTagChart draws the expense of every tag over r as bars, largest
+// first. Tags used in several currencies get a bar per currency.
+func sendTagChart(ctx context.Context, d Deps, chatID int64, r period.Range) error {
+	totals, err := d.Storage.TagTotals(ctx, chatID, r.From, r.To)
+	if err != nil {
+		return err
+	}
+
+	var bars []chart.Bar
+	for _, t := range totals {
+		if t.Out == 0 {
+			continue
+		}
+		label := "без тега"
+		if t.Tag != "" {
+			label = "#" + t.Tag
+		}
+		if t.Currency != "" {
+			label += ", " + t.Currency
+		}
+		spent := -t.Out
+		bars = append(bars, chart.Bar{Label: label, Value: spent.Float(), Text: formatMoney(spent, t.Currency)})
+	}
+	if len(bars) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoTransactionsInPeriod, r.Label())))
+		return nil
+	}
+	sort.SliceStable(bars, func(i, j int) bool { return bars[i].Value > bars[j].Value })
+
+	title := "Расходы по тегам " + r.Label()
+	if len(bars) > chart.MaxBars {
+		title += fmt.Sprintf(" (первые %d из %d)", chart.MaxBars, len(bars))
+	}
+	img, err := chart.Bars(title, bars)
+	if err != nil {
+		return err
+	}
+	return sendChart(d, chatID, img, title)
+}
+
+func sendChart(d Deps, chatID int64, img image.Image, caption string) error {
+	var buf bytes.Buffer
+	if err := chart.Encode(&buf, img); err != nil {
+		return err
+	}
+	photo := api.NewPhoto(chatID, api.FileBytes{Name: "chart.png", Bytes: buf.Bytes()})
+	photo.Caption = caption
+	_, err := d.Bot.Send(photo)
+	return err
+}
@@ -0,0 +1,55 @@
+package commands
+
+import (
+	"context"
+	"strings"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func Check() Command {
+	return Command{
+		Name:        "check",
+		Description: "Проверить целостность балансов (/check fix — исправить)",
+		Hidden:      true,
+		Role:        model.RoleOwner,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			fix := strings.TrimSpace(msg.CommandArguments()) == "fix"
+
+			found, err := d.Storage.Reconcile(ctx, chatID, fix)
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+			if len(found) == 0 {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.LedgerConsistent)))
+				return nil
+			}
+
+			var b strings.Builder
+			b.WriteString(msgs.T(msgs.LedgerInconsistent))
+			for _, f := range found {
+				b.WriteString("\n")
+				b.WriteString(msgs.T(
+					msgs.LedgerDiscrepancy,
+					f.Account,
+					formatMoney(f.Balance, f.Currency),
+					formatMoney(f.Sum, f.Currency),
+					f.BadRunning,
+				))
+			}
+			b.WriteString("\n\n")
+			if fix {
+				b.WriteString(msgs.T(msgs.LedgerFixed))
+			} else {
+				b.WriteString(msgs.T(msgs.LedgerFixHint))
+			}
+
+			_, _ = d.Bot.Send(api.NewMessage(chatID, b.String()))
+			return nil
+		},
+	}
+}
@@ -2,16 +2,21 @@ package commands
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	api "github.com/OvyFlash/telegram-bot-api"
 	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
 )
 
 func Del() Command {
 	return Command{
 		Name:        "del",
-		Description: "Удалить существующий аккаунт",
+		Description: "Перенести счет в архив",
 		Hidden: false,
+		Role:        model.RoleOwner,
 		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
 			chatID := msg.Chat.ID
 			accName := msg.CommandArguments()
@@ -20,24 +25,23 @@ func Del() Command {
 				return nil
 			}
 
-			exists, err := d.Storage.Exists(ctx, chatID, accName)
-			if err != nil {
-				return err
-			}
-			if !exists {
+			acc, err := d.Storage.GetAccount(ctx, chatID, accName)
+			if errors.Is(err, sqlite.ErrNotFound) {
 				reply := msgs.T(msgs.AccDoesNotExist, accName)
 				_, _ = d.Bot.Send(api.NewMessage(chatID, reply))
 				return nil
 			}
-
-			if err := d.Storage.RemoveAccount(ctx, chatID, accName); err != nil {
+			if err != nil {
 				return err
 			}
 
-			reply := msgs.T(msgs.AccRemoved, accName)
-			_, _ = d.Bot.Send(api.NewMessage(chatID, reply))
+			yes := api.NewInlineKeyboardButtonData("🗄 В архив", fmt.Sprintf("del:%d", acc.Id))
+			no := api.NewInlineKeyboardButtonData("Отмена", "del:no")
+
+			out := api.NewMessage(chatID, msgs.T(msgs.DelConfirm, acc.Name))
+			out.ReplyMarkup = api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(yes, no))
+			_, _ = d.Bot.Send(out)
 			return nil
 		},
 	}
 }
-
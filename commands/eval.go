@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/exprcalc"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// Evaluator turns the expression part of a transaction into an amount.
+type Evaluator interface {
+	Eval(ctx context.Context, expr string) (model.Money, error)
+}
+
+// NativeEvaluator evaluates expressions in-process with exact arithmetic.
+type NativeEvaluator struct{}
+
+func (NativeEvaluator) Eval(ctx context.Context, expr string) (model.Money, error) {
+	return exprcalc.EvalMoney(expr)
+}
+
+// QalcEvaluator delegates to the external qalc binary.
+type QalcEvaluator struct {
+	Precision int
+}
+
+func (q QalcEvaluator) Eval(ctx context.Context, expr string) (model.Money, error) {
+	return EvalQalc(ctx, expr, q.Precision)
+}
+
+func (d Deps) evaluator() Evaluator {
+	if d.Eval == nil {
+		return NativeEvaluator{}
+	}
+	return d.Eval
+}
+
+func evalErrorText(err error) string {
+	switch {
+	case errors.Is(err, exprcalc.ErrDivisionByZero):
+		return msgs.T(msgs.DivisionByZero)
+	case errors.Is(err, exprcalc.ErrOverflow):
+		return msgs.T(msgs.AmountOverflow)
+	}
+	return msgs.T(msgs.InvalidExpression)
+}
+
+func EvalQalc(ctx context.Context, raw string, precision int) (model.Money, error) {
+	expr := strings.TrimSpace(raw)
+
+	path, err := exec.LookPath("qalc")
+	if err != nil {
+		return 0, fmt.Errorf("qalc not found in PATH: %w", err)
+	}
+
+	precArg := fmt.Sprintf("prec %d", precision)
+	args := []string{"--terse", "--set", precArg, "--", expr}
+
+	if ctx == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+	}
+
+	cmd := exec.CommandContext(ctx, path, args...)
+	env := os.Environ()
+	env = append(env, "LC_ALL=C", "LANG=C", "LC_NUMERIC=C")
+	cmd.Env = env
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return 0, fmt.Errorf("qalc run error: %v (stderr=%q)", err, strings.TrimSpace(stderr.String()))
+	}
+
+	res := strings.TrimSpace(stdout.String())
+	res = strings.ReplaceAll(res, "−", "-")
+	res = strings.ReplaceAll(res, " ", "")
+	res = strings.ReplaceAll(res, "\u2009", "")
+	res = strings.ReplaceAll(res, "\u202F", "")
+
+	v, err := model.ParseMoney(res)
+	if err != nil {
+		return 0, fmt.Errorf("parse qalc result %q failed for expr %q", res, expr)
+	}
+	return v, nil
+}
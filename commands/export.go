@@ -0,0 +1,86 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/internal/journal"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Export() Command {
+	return Command{
+		Name:        "export",
+		Description: "Выгрузка для hledger/beancount: /export ledger, /export beancount",
+		Hidden:      false,
+		Role:        model.RoleViewer,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+
+			var format journal.Format
+			switch strings.ToLower(strings.TrimSpace(msg.CommandArguments())) {
+			case "ledger", "hledger", "journal":
+				format = journal.Hledger
+			case "beancount", "bean":
+				format = journal.Beancount
+			default:
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.ExportUsage)))
+				return nil
+			}
+
+			txs, err := d.Storage.Transactions(ctx, sqlite.TxnFilter{ChatID: chatID})
+			if err != nil {
+				return err
+			}
+			if len(txs) == 0 {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoHistory)))
+				return nil
+			}
+
+			entries := make([]journal.Entry, len(txs))
+			for i, e := range txs {
+				sec, err := strconv.ParseInt(strings.TrimSpace(e.CreatedAt), 10, 64)
+				if err != nil {
+					return fmt.Errorf("parse created_at of txn %d: %w", e.Id, err)
+				}
+				entries[i] = journal.Entry{
+					ID:         e.Id,
+					Account:    e.Account,
+					Currency:   e.Currency,
+					Time:       time.Unix(sec, 0),
+					Amount:     e.Amount,
+					Balance:    e.Balance,
+					Note:       e.Note,
+					Expression: e.Expression,
+					TransferID: e.TransferId,
+					ReversesID: e.ReversesId,
+				}
+			}
+
+			now := time.Now()
+			who := strings.TrimSpace(msg.Chat.Title)
+			if who == "" {
+				who = strconv.FormatInt(chatID, 10)
+			}
+			title := fmt.Sprintf("Учет чата %s на %s", who, now.Format("02.01.2006 15:04"))
+
+			var buf bytes.Buffer
+			if err := journal.Write(&buf, format, title, entries); err != nil {
+				return err
+			}
+
+			name := fmt.Sprintf("ledger_%d_%s.%s", chatID, now.UTC().Format("20060102_150405Z"), format.Ext())
+			doc := api.NewDocument(chatID, api.FileBytes{Name: name, Bytes: buf.Bytes()})
+			doc.Caption = msgs.T(msgs.ExportCaption, string(format))
+			_, err = d.Bot.Send(doc)
+			return err
+		},
+	}
+}
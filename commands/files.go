@@ -0,0 +1,56 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+)
+
+// maxUploadSize caps documents the bot downloads, well above any ledger
+// file users are expected to send.
+const maxUploadSize = 10 << 20
+
+// documentCommand returns the command and arguments written in the caption
+// of a document message; Telegram does not set them as for text messages.
+func documentCommand(msg *api.Message) (cmd, args string) {
+	if msg.Document == nil {
+		return "", ""
+	}
+	return parseSlash(msg.Caption)
+}
+
+func downloadDocument(ctx context.Context, d Deps, doc *api.Document) ([]byte, error) {
+	if doc.FileSize > maxUploadSize {
+		return nil, fmt.Errorf("file is too large")
+	}
+
+	url, err := d.Bot.GetFileDirectURL(doc.FileID)
+	if err != nil {
+		return nil, fmt.Errorf("get file url: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("download file: %s", resp.Status)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxUploadSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("read file: %w", err)
+	}
+	if len(data) > maxUploadSize {
+		return nil, fmt.Errorf("file is too large")
+	}
+	return data, nil
+}
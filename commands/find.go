@@ -0,0 +1,178 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/internal/period"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Find() Command {
+	return Command{
+		Name:        "find",
+		Description: "Поиск: /find <текст> [счет] [период] [amount>100]",
+		Hidden:      false,
+		Role:        model.RoleViewer,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			q, err := parseFind(ctx, d, chatID, msg.CommandArguments(), time.Now())
+			if err != nil {
+				return err
+			}
+			if q.empty() {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.FindUsage)))
+				return nil
+			}
+
+			text, kb, err := renderFind(ctx, d, msg.Chat, q, 0, 0)
+			if err != nil {
+				return err
+			}
+			// The results quote the query so that paging can read it back.
+			out := api.NewMessage(chatID, text)
+			out.ParseMode = "HTML"
+			out.ReplyParameters.MessageID = msg.MessageID
+			out.LinkPreviewOptions.IsDisabled = true
+			if kb != nil {
+				out.ReplyMarkup = *kb
+			}
+			_, _ = d.Bot.Send(out)
+			return nil
+		},
+	}
+}
+
+type findQuery struct {
+	text   string
+	filter sqlite.TxnFilter
+}
+
+func (q findQuery) empty() bool {
+	f := q.filter
+	return q.text == "" && f.AccountID == 0 && f.From.IsZero() && f.To.IsZero() && f.MinAmount == nil && f.MaxAmount == nil
+}
+
+var amountFilter = regexp.MustCompile(`^(?i:amount|сумма)?(>=|<=|>|<|=)(\d+(?:[.,]\d+)?)$`)
+
+// parseFind splits /find arguments into search words and filters: amount
+// bounds such as amount>100 or <50 (compared with the absolute amount),
+// periods written with digits such as 2025-01 or 01.03..15.03, and an
+// account name anywhere after the first word.
+func parseFind(ctx context.Context, d Deps, chatID int64, args string, now time.Time) (findQuery, error) {
+	q := findQuery{filter: sqlite.TxnFilter{ChatID: chatID}}
+
+	var words []string
+	for i, tok := range strings.Fields(args) {
+		if m := amountFilter.FindStringSubmatch(tok); m != nil {
+			v, err := model.ParseMoney(strings.ReplaceAll(m[2], ",", "."))
+			if err == nil {
+				switch m[1] {
+				case ">":
+					v++
+					q.filter.MinAmount = &v
+				case ">=":
+					q.filter.MinAmount = &v
+				case "<":
+					v--
+					q.filter.MaxAmount = &v
+				case "<=":
+					q.filter.MaxAmount = &v
+				case "=":
+					q.filter.MinAmount, q.filter.MaxAmount = &v, &v
+				}
+				continue
+			}
+		}
+		if looksLikeDate(tok) {
+			if r, err := period.Parse(tok, now); err == nil {
+				q.filter.From, q.filter.To = r.From, r.To
+				continue
+			}
+		}
+		if i > 0 && q.filter.AccountID == 0 {
+			id, err := viewableAccountID(ctx, d, chatID, tok)
+			if err == nil {
+				q.filter.AccountID = id
+				continue
+			}
+			if !errors.Is(err, sqlite.ErrNotFound) {
+				return findQuery{}, err
+			}
+		}
+		words = append(words, tok)
+	}
+	q.text = strings.Join(words, " ")
+	return q, nil
+}
+
+// looksLikeDate keeps plain numbers and words in the search text: only
+// tokens with digits and a date separator are tried as periods.
+func looksLikeDate(tok string) bool {
+	return strings.IndexFunc(tok, unicode.IsDigit) >= 0 && strings.ContainsAny(tok, ".-–")
+}
+
+func renderFind(ctx context.Context, d Deps, chat api.Chat, q findQuery, before, after int64) (string, *api.InlineKeyboardMarkup, error) {
+	page, err := d.Storage.Search(ctx, q.filter, q.text, before, after, defaultPageSize)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(page.Entries) == 0 {
+		return html.EscapeString(msgs.T(msgs.NothingFound)), nil, nil
+	}
+
+	rows := historyRows(page.Entries, q.filter.AccountID == 0)
+	var links []string
+	for i, e := range page.Entries {
+		num := strconv.Itoa(i + 1)
+		rows[i] = append([]string{num}, rows[i]...)
+		if link := messageLink(chat, e.SourceMsgId); link != "" {
+			links = append(links, fmt.Sprintf(`<a href="%s">%s</a>`, link, num))
+		}
+	}
+
+	var b strings.Builder
+	if q.text != "" {
+		fmt.Fprintf(&b, "<b>Найдено по запросу «%s»</b>\n", html.EscapeString(q.text))
+	} else {
+		b.WriteString("<b>Найденные операции</b>\n")
+	}
+	b.WriteString("<pre>")
+	b.WriteString(renderPre(rows, []bool{true, false, false, false, false, false, true, true, false}))
+	b.WriteString("</pre>")
+	if len(links) > 0 {
+		b.WriteString("\nК сообщению: ")
+		b.WriteString(strings.Join(links, " · "))
+	}
+
+	return b.String(), pageKeyboard(page, func(dir byte, id int) string {
+		return fmt.Sprintf("find:%c%d", dir, id)
+	}), nil
+}
+
+// messageLink returns a t.me link to a message, or "" when the chat has no
+// linkable messages: only public chats and supergroups do.
+func messageLink(chat api.Chat, msgID int) string {
+	if msgID == 0 {
+		return ""
+	}
+	if chat.UserName != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", chat.UserName, msgID)
+	}
+	// Supergroup and channel ids are -100 followed by the internal id.
+	const prefix = -1000000000000
+	if chat.ID < prefix {
+		return fmt.Sprintf("https://t.me/c/%d/%d", prefix-chat.ID, msgID)
+	}
+	return ""
+}
@@ -2,15 +2,19 @@ package commands
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"html"
-	"math"
+	"math/big"
 	"strconv"
 	"strings"
-	"unicode/utf8"
+	"time"
 
 	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/exprcalc"
 	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
 )
 
 func Get() Command {
@@ -18,6 +22,7 @@ func Get() Command {
 		Name:        "get",
 		Description: "Возвращает баланс всех аккаунтов",
 		Hidden: false,
+		Role:        model.RoleViewer,
 		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
 			chatID := msg.Chat.ID
 
@@ -35,14 +40,9 @@ func Get() Command {
 				who = html.EscapeString(t)
 			}
 
-			formatted := make([]string, len(bals))
-			maxw := 0
+			rows := make([][]string, len(bals))
 			for i, ab := range bals {
-				s := formatAmount(ab.Balance)
-				formatted[i] = s
-				if w := utf8.RuneCountInString(s); w > maxw {
-					maxw = w
-				}
+				rows[i] = []string{formatAmount(ab.Balance), ab.Currency, ab.Name}
 			}
 
 			var b strings.Builder
@@ -50,23 +50,19 @@ func Get() Command {
 			fmt.Fprintf(&b, "<b>Средств на руках у %s:</b>\n", who)
 
 			b.WriteString("<pre>")
-			for i, ab := range bals {
-				amt := formatted[i]
-				name := html.EscapeString(ab.Name)
-
-				pad := maxw - utf8.RuneCountInString(amt)
-				if pad > 0 {
-					b.WriteString(strings.Repeat(" ", pad))
-				}
+			b.WriteString(renderPre(rows, []bool{true, false, false}))
+			b.WriteString("</pre>")
 
-				b.WriteString(amt)
-				b.WriteString("  ")
-				b.WriteString(name)
-				if i < len(bals)-1 {
-					b.WriteByte('\n')
+			target := valuationCurrency(msg.CommandArguments())
+			if target != "" {
+				if err := writeValuation(ctx, d, &b, chatID, bals, target); err != nil {
+					return err
 				}
+			} else if totals := totalsByCurrency(bals); len(bals) > 1 {
+				b.WriteString("\n<b>Итого:</b>\n<pre>")
+				b.WriteString(renderPre(totals, []bool{true, false}))
+				b.WriteString("</pre>")
 			}
-			b.WriteString("</pre>")
 
 			out := api.NewMessage(chatID, b.String())
 			out.ParseMode = "HTML"
@@ -80,27 +76,133 @@ func Get() Command {
 	}
 }
 
-func formatAmount(v float64) string {
+// valuationCurrency reads "/get in RUB", "/get в RUB" or "/get RUB".
+func valuationCurrency(args string) string {
+	fields := strings.Fields(args)
+	if len(fields) == 2 && (strings.EqualFold(fields[0], "in") || strings.EqualFold(fields[0], "в")) {
+		fields = fields[1:]
+	}
+	if len(fields) != 1 {
+		return ""
+	}
+	code, err := model.NormalizeCurrency(fields[0])
+	if err != nil {
+		return ""
+	}
+	return code
+}
+
+// writeValuation values every account in target using the latest stored
+// rates and appends the per-account values and their total. Accounts
+// without a currency are taken to be in target already.
+func writeValuation(ctx context.Context, d Deps, b *strings.Builder, chatID int64, bals []sqlite.AccountBalance, target string) error {
+	var (
+		total   = new(big.Rat)
+		rows    [][]string
+		missing []string
+	)
+	now := time.Now()
+	for _, ab := range bals {
+		cur := ab.Currency
+		if cur == "" {
+			cur = target
+		}
+		rate, err := d.Storage.LatestRate(ctx, chatID, cur, target, now)
+		if errors.Is(err, sqlite.ErrNotFound) {
+			missing = append(missing, cur)
+			rows = append(rows, []string{"—", target, ab.Name})
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		v := new(big.Rat).Mul(big.NewRat(int64(ab.Balance), model.MinorUnits), rate)
+		total.Add(total, v)
+		m, err := exprcalc.ToMoney(v)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, []string{formatAmount(m), target, ab.Name})
+	}
+
+	sum, err := exprcalc.ToMoney(total)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(b, "\n<b>В пересчете на %s:</b>\n<pre>", html.EscapeString(target))
+	b.WriteString(renderPre(rows, []bool{true, false, false}))
+	b.WriteString("</pre>\n<b>Итого: ")
+	b.WriteString(html.EscapeString(formatMoney(sum, target)))
+	b.WriteString("</b>")
+	if len(missing) > 0 {
+		b.WriteString("\n")
+		b.WriteString(html.EscapeString(msgs.T(msgs.RatesMissingFor, strings.Join(uniqueStrings(missing), ", "), target)))
+	}
+	return nil
+}
+
+func uniqueStrings(in []string) []string {
+	seen := make(map[string]bool, len(in))
+	out := in[:0]
+	for _, s := range in {
+		if !seen[s] {
+			seen[s] = true
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// totalsByCurrency sums balances per currency, in order of first
+// appearance, as rows of amount and currency.
+func totalsByCurrency(bals []sqlite.AccountBalance) [][]string {
+	var order []string
+	sums := make(map[string]model.Money)
+	for _, ab := range bals {
+		if _, ok := sums[ab.Currency]; !ok {
+			order = append(order, ab.Currency)
+		}
+		sums[ab.Currency] += ab.Balance
+	}
+
+	rows := make([][]string, len(order))
+	for i, cur := range order {
+		rows[i] = []string{formatAmount(sums[cur]), cur}
+	}
+	return rows
+}
+
+// formatMoney is formatAmount followed by the currency code, if any.
+func formatMoney(v model.Money, currency string) string {
+	if currency == "" {
+		return formatAmount(v)
+	}
+	return formatAmount(v) + " " + currency
+}
+
+func currencyLabel(currency string) string {
+	if currency == "" {
+		return "без валюты"
+	}
+	return currency
+}
+
+func formatAmount(v model.Money) string {
 	sep := '’'
 	sign := ""
 	if v < 0 {
 		sign = "-"
-		v = -v
-	}
-
-	if math.Trunc(v) == v {
-		s := strconv.FormatInt(int64(v), 10)
-		return sign + insertSep(s, sep)
 	}
 
-	s := strconv.FormatFloat(v, 'f', 2, 64)
-	intPart, frac := s, ""
-	if dot := strings.IndexByte(s, '.'); dot >= 0 {
-		intPart, frac = s[:dot], s[dot+1:]
+	major := v.Major()
+	if major < 0 {
+		major = -major
 	}
-	intPart = insertSep(intPart, sep)
+	intPart := insertSep(strconv.FormatInt(major, 10), sep)
 
-	frac = strings.TrimRight(frac, "0")
+	frac := strings.TrimRight(fmt.Sprintf("%02d", v.Minor()), "0")
 	if frac == "" {
 		return sign + intPart
 	}
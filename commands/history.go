@@ -0,0 +1,218 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+const (
+	defaultPageSize = 10
+	maxPageSize     = 50
+	// maxNoteWidth and maxExprWidth keep table rows narrow; a page that is
+	// still too long is cut by renderHistory.
+	maxNoteWidth = 30
+	maxExprWidth = 24
+	// maxMessageLen is Telegram's limit on the text of a message.
+	maxMessageLen = 4096
+	// unknownAuthor stands in for users whose name was never seen, such as
+	// the authors of transactions from before names were recorded.
+	unknownAuthor = "неизвестен"
+)
+
+func History() Command {
+	return Command{
+		Name:        "history",
+		Description: "Последние операции: /history [счет] [N]",
+		Hidden:      false,
+		Role:        model.RoleViewer,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			args := strings.Fields(msg.CommandArguments())
+
+			n := defaultPageSize
+			if len(args) > 0 {
+				if v, err := strconv.Atoi(args[len(args)-1]); err == nil {
+					n = clampPageSize(v)
+					args = args[:len(args)-1]
+				}
+			}
+			if len(args) > 1 {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.HistoryUsage)))
+				return nil
+			}
+
+			accountID := 0
+			if len(args) == 1 {
+				id, err := viewableAccountID(ctx, d, chatID, args[0])
+				if errors.Is(err, sqlite.ErrNotFound) {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, args[0])))
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				accountID = id
+			}
+
+			text, kb, err := renderHistory(ctx, d, chatID, accountID, n, 0, 0)
+			if err != nil {
+				return err
+			}
+			out := api.NewMessage(chatID, text)
+			out.ParseMode = "HTML"
+			if kb != nil {
+				out.ReplyMarkup = *kb
+			}
+			_, _ = d.Bot.Send(out)
+			return nil
+		},
+	}
+}
+
+// viewableAccountID resolves a name for read-only use, so archived accounts
+// are found too.
+func viewableAccountID(ctx context.Context, d Deps, chatID int64, typed string) (int, error) {
+	acc, err := findAccount(ctx, d, chatID, typed)
+	if errors.Is(err, sqlite.ErrArchived) {
+		return d.Storage.GetAccountID(ctx, chatID, typed)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return acc.Id, nil
+}
+
+func clampPageSize(n int) int {
+	return max(1, min(n, maxPageSize))
+}
+
+// renderHistory renders a page of /history. The keyboard is nil when there
+// is nothing to page to.
+func renderHistory(ctx context.Context, d Deps, chatID int64, accountID, n int, before, after int64) (string, *api.InlineKeyboardMarkup, error) {
+	filter := sqlite.TxnFilter{ChatID: chatID, AccountID: accountID}
+	page, err := d.Storage.History(ctx, filter, before, after, n)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(page.Entries) == 0 {
+		return html.EscapeString(msgs.T(msgs.NoHistory)), nil, nil
+	}
+
+	render := func() string {
+		var b strings.Builder
+		if accountID != 0 {
+			fmt.Fprintf(&b, "<b>История счета %s</b>\n", html.EscapeString(page.Entries[0].Account))
+		} else {
+			b.WriteString("<b>История операций</b>\n")
+		}
+		b.WriteString("<pre>")
+		b.WriteString(renderPre(historyRows(page.Entries, accountID == 0), []bool{false, false, false, false, false, true, true, false}))
+		b.WriteString("</pre>")
+		return b.String()
+	}
+	// Long names and notes can take a page past the limit. The rows that do
+	// not fit are dropped from the far end and left to the next page.
+	text := render()
+	for len(page.Entries) > 1 && utf8.RuneCountInString(text) > maxMessageLen {
+		if after > 0 {
+			page.Entries, page.HasNewer = page.Entries[1:], true
+		} else {
+			page.Entries, page.HasOlder = page.Entries[:len(page.Entries)-1], true
+		}
+		text = render()
+	}
+
+	return text, pageKeyboard(page, func(dir byte, id int) string {
+		return fmt.Sprintf("hist:%d:%d:%c%d", accountID, n, dir, id)
+	}), nil
+}
+
+// historyRows lays entries out as date, status, account, author,
+// expression, amount, balance and note. Reversals are marked ↩ and
+// reverted entries ✗.
+func historyRows(entries []sqlite.HistoryEntry, withAccount bool) [][]string {
+	rows := make([][]string, len(entries))
+	for i, e := range entries {
+		status := ""
+		switch {
+		case e.ReversesId != 0:
+			status = "↩"
+		case e.Reverted:
+			status = "✗"
+		}
+		account := ""
+		if withAccount {
+			account = e.Account
+		}
+		author := e.Author
+		if author == "" && e.CreatedBy != 0 {
+			author = unknownAuthor
+		}
+		rows[i] = []string{
+			formatUnixDate(e.CreatedAt),
+			status,
+			account,
+			author,
+			truncateRunes(e.Expression, maxExprWidth),
+			formatAmount(e.Amount),
+			formatMoney(e.Balance, e.Currency),
+			truncateRunes(e.Note, maxNoteWidth),
+		}
+	}
+	return rows
+}
+
+// pageKeyboard offers ◀ for older and ▶ for newer entries. data builds the
+// callback for a direction ('o' or 'n') and the id to page from.
+func pageKeyboard(page sqlite.HistoryPage, data func(dir byte, id int) string) *api.InlineKeyboardMarkup {
+	var row []api.InlineKeyboardButton
+	if page.HasOlder {
+		last := page.Entries[len(page.Entries)-1].Id
+		row = append(row, api.NewInlineKeyboardButtonData("◀", data('o', last)))
+	}
+	if page.HasNewer {
+		row = append(row, api.NewInlineKeyboardButtonData("▶", data('n', page.Entries[0].Id)))
+	}
+	if len(row) == 0 {
+		return nil
+	}
+	kb := api.NewInlineKeyboardMarkup(row)
+	return &kb
+}
+
+// parsePageCursor reads the 'o<id>' or 'n<id>' tail of a paging callback
+// into History's before and after.
+func parsePageCursor(s string) (before, after int64, err error) {
+	if s == "" {
+		return 0, 0, fmt.Errorf("empty cursor")
+	}
+	id, err := strconv.ParseInt(s[1:], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+	switch s[0] {
+	case 'o':
+		return id, 0, nil
+	case 'n':
+		return 0, id, nil
+	}
+	return 0, 0, fmt.Errorf("bad cursor %q", s)
+}
+
+func truncateRunes(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	return string(r[:n-1]) + "…"
+}
@@ -0,0 +1,220 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/internal/csvimport"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+// importPreviewRows is how many rows the confirmation shows.
+const importPreviewRows = 5
+
+func Import() Command {
+	return Command{
+		Name:        "import",
+		Description: "Загрузить историю из CSV: отправьте файл с подписью /import <счет>",
+		Hidden:      false,
+		Role:        model.RoleEditor,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			_, args := documentCommand(msg)
+			typed, spec, _ := strings.Cut(strings.TrimSpace(args), " ")
+			if msg.Document == nil || typed == "" {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.ImportUsage)))
+				return nil
+			}
+
+			acc, err := findAccount(ctx, d, chatID, typed)
+			switch {
+			case errors.Is(err, sqlite.ErrNotFound):
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, typed)))
+				return nil
+			case errors.Is(err, sqlite.ErrArchived):
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.ArchivedReadOnly)))
+				return nil
+			case err != nil:
+				return err
+			}
+
+			plan, err := loadImport(ctx, d, chatID, msg, spec)
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, importErrorText(err)))
+				return nil
+			}
+			if text, err := backdatedImport(ctx, d, acc, plan); err != nil || text != "" {
+				if text != "" {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, text))
+				}
+				return err
+			}
+
+			out := api.NewMessage(chatID, renderImportPreview(acc, msg.Document.FileName, plan))
+			out.ParseMode = "HTML"
+			out.ReplyParameters.MessageID = msg.MessageID
+			out.ReplyMarkup = api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(
+				api.NewInlineKeyboardButtonData("Импортировать", fmt.Sprintf("imp:%d", acc.Id)),
+				api.NewInlineKeyboardButtonData("Отмена", "imp:no"),
+			))
+			_, err = d.Bot.Send(out)
+			return err
+		},
+	}
+}
+
+// importPlan is a parsed file with the authors of its rows resolved.
+type importPlan struct {
+	file    *csvimport.File
+	authors []int64
+	// unknown are the author names no chat member matched; their rows are
+	// recorded as the importer's.
+	unknown []string
+}
+
+// loadImport downloads and parses the document of msg. The import is read
+// again from the file on confirmation, so nothing is kept between the
+// preview and the button.
+func loadImport(ctx context.Context, d Deps, chatID int64, msg *api.Message, spec string) (*importPlan, error) {
+	data, err := downloadDocument(ctx, d, msg.Document)
+	if err != nil {
+		return nil, err
+	}
+	file, err := csvimport.Parse(data, spec, time.Local)
+	if err != nil {
+		return nil, fileError{err}
+	}
+
+	members, err := d.Storage.ListRoles(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	plan := &importPlan{file: file, authors: make([]int64, len(file.Rows))}
+	seen := make(map[string]bool)
+	for i, row := range file.Rows {
+		id, ok := resolveAuthor(row.Author, members)
+		if !ok {
+			id = msg.From.ID
+			if row.Author != "" && !seen[row.Author] {
+				seen[row.Author] = true
+				plan.unknown = append(plan.unknown, row.Author)
+			}
+		}
+		plan.authors[i] = id
+	}
+	return plan, nil
+}
+
+// backdatedImport explains why plan cannot go into acc when its first row
+// is older than the latest transaction there, and is empty otherwise.
+func backdatedImport(ctx context.Context, d Deps, acc *model.Account, p *importPlan) (string, error) {
+	latest, err := d.Storage.LatestTransactionTime(ctx, acc.Id)
+	if err != nil {
+		return "", err
+	}
+	first := p.file.Rows[0].Time
+	if !first.Before(latest) {
+		return "", nil
+	}
+	return msgs.T(msgs.ImportBackdated, acc.Name, latest.Local().Format("02.01.2006 15:04"), first.Format("02.01.2006 15:04")), nil
+}
+
+// resolveAuthor maps the author column to a member with a role, by user ID
+// or by name or @username. A file can't attribute rows to anyone else.
+func resolveAuthor(author string, members []model.ChatMember) (int64, bool) {
+	if author == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(author, 10, 64)
+	if err != nil {
+		id = 0
+	}
+	key := model.NormalizeName(strings.TrimPrefix(author, "@"))
+	for _, m := range members {
+		if (id > 0 && m.UserId == id) || model.NormalizeName(strings.TrimPrefix(m.Name, "@")) == key {
+			return m.UserId, true
+		}
+	}
+	return 0, false
+}
+
+// transactions builds the rows of the plan, dated as in the file.
+func (p *importPlan) transactions() []*model.Transaction {
+	txs := make([]*model.Transaction, len(p.file.Rows))
+	for i, row := range p.file.Rows {
+		t := model.NewTransaction(0, row.Amount, row.Note, 0, row.Amount.String(), p.authors[i])
+		t.CreatedAt = strconv.FormatInt(row.Time.UTC().Unix(), 10)
+		txs[i] = t
+	}
+	return txs
+}
+
+func renderImportPreview(acc *model.Account, fileName string, p *importPlan) string {
+	rows := p.file.Rows
+	var in, out model.Money
+	for _, r := range rows {
+		if r.Amount > 0 {
+			in += r.Amount
+		} else {
+			out += r.Amount
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "<b>Импорт в счет %s</b>", html.EscapeString(acc.Name))
+	if fileName != "" {
+		fmt.Fprintf(&b, " из %s", html.EscapeString(fileName))
+	}
+	fmt.Fprintf(&b, "\nОпераций: %d, с %s по %s\n", len(rows),
+		rows[0].Time.Format("02.01.2006"), rows[len(rows)-1].Time.Format("02.01.2006"))
+	fmt.Fprintf(&b, "Приход: %s, расход: %s\n", html.EscapeString(formatMoney(in, acc.Currency)), html.EscapeString(formatMoney(-out, acc.Currency)))
+	fmt.Fprintf(&b, "Баланс после импорта: %s\n", html.EscapeString(formatMoney(acc.Balance+in+out, acc.Currency)))
+	fmt.Fprintf(&b, "Колонки: %s; разделитель %s, дробная часть через «%c»\n",
+		html.EscapeString(p.file.MappingText()), delimiterName(p.file.Delimiter), p.file.Decimal)
+
+	n := min(len(rows), importPreviewRows)
+	table := make([][]string, n)
+	for i, r := range rows[:n] {
+		table[i] = []string{r.Time.Format("02.01.06"), formatAmount(r.Amount), truncateRunes(r.Note, maxNoteWidth)}
+	}
+	b.WriteString("<pre>" + renderPre(table, []bool{false, true, false}) + "</pre>")
+	if len(rows) > n {
+		fmt.Fprintf(&b, "\n…и еще %d", len(rows)-n)
+	}
+	if len(p.unknown) > 0 {
+		sort.Strings(p.unknown)
+		fmt.Fprintf(&b, "\n\n%s", html.EscapeString(msgs.T(msgs.ImportUnknownAuthors, strings.Join(p.unknown, ", "))))
+	}
+	return b.String()
+}
+
+func delimiterName(r rune) string {
+	switch r {
+	case '\t':
+		return "табуляция"
+	case ';':
+		return "«;»"
+	}
+	return "«,»"
+}
+
+// fileError is a problem with the contents of the uploaded file, which is
+// shown to the user as is.
+type fileError struct{ error }
+
+func importErrorText(err error) string {
+	var fe fileError
+	if errors.As(err, &fe) {
+		return msgs.T(msgs.ImportFailed, fe.Error())
+	}
+	return msgs.T(msgs.UnsuccessfulOperation)
+}
@@ -2,10 +2,14 @@ package commands
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	api "github.com/OvyFlash/telegram-bot-api"
 	msgs "github.com/maxBezel/ledgerbot/internal/messages"
 	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+	"golang.org/x/text/currency"
 )
 
 func New() Command {
@@ -13,32 +17,70 @@ func New() Command {
 		Name:        "new",
 		Description: "Создать новый аккаунт",
 		Hidden: false,
+		Role:        model.RoleEditor,
 		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
-			accName := msg.CommandArguments()
+			accName, currency := splitNameCurrency(msg.CommandArguments())
 			chatID := msg.Chat.ID
 			if accName == "" {
 				_, _ = d.Bot.Send(api.NewMessage(msg.Chat.ID, msgs.T(msgs.NoAccountName)))
 				return nil
 			}
+			if currency != "" {
+				code, err := model.NormalizeCurrency(currency)
+				if err != nil {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.InvalidCurrency, currency)))
+					return nil
+				}
+				currency = code
+			}
 
-			exists, err := d.Storage.Exists(ctx, chatID, accName)
-			if err != nil {
+			use, err := d.Storage.NameInUse(ctx, chatID, accName)
+			if err != nil && !errors.Is(err, sqlite.ErrNotFound) {
 				return err
 			}
-			if exists {
-				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccAlreadyExist)))
+			if use != nil {
+				reply := msgs.T(msgs.AccAlreadyExist)
+				switch {
+				case use.Alias:
+					reply = msgs.T(msgs.AliasTaken, accName)
+				case use.Archived:
+					reply = msgs.T(msgs.AccArchived, use.Account, use.Account)
+				}
+				_, _ = d.Bot.Send(api.NewMessage(chatID, reply))
 				return nil
 			}
 
 			acc := model.NewAccount(accName, msg.Chat.ID)
+			acc.Currency = currency
 			if err := d.Storage.AddAccount(ctx, acc); err != nil {
 				return err
 			}
 
 			reply := msgs.T(msgs.AccountCreated, accName)
+			if currency != "" {
+				reply = msgs.T(msgs.AccountCreatedCurrency, accName, currency)
+			}
 			_, _ = d.Bot.Send(api.NewMessage(msg.Chat.ID, reply))
 			return nil
 		},
 	}
 }
 
+// splitNameCurrency reads "/new <name> [currency]". The last word is the
+// currency only when it is a known ISO 4217 code, so "/new cash box" names
+// the account "cash box"; other tickers such as USDT follow a colon, as in
+// "/new wallet: USDT".
+func splitNameCurrency(args string) (name, code string) {
+	args = strings.TrimSpace(args)
+	if i := strings.LastIndexByte(args, ':'); i >= 0 {
+		return strings.TrimSpace(args[:i]), strings.TrimSpace(args[i+1:])
+	}
+	i := strings.LastIndexByte(args, ' ')
+	if i < 0 {
+		return args, ""
+	}
+	if unit, err := currency.ParseISO(args[i+1:]); err != nil || unit == (currency.Unit{}) {
+		return args, ""
+	}
+	return strings.TrimSpace(args[:i]), args[i+1:]
+}
@@ -0,0 +1,131 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+// defaultRole is what members without an explicit role may do, so that a
+// group keeps working without configuring everyone up front.
+const defaultRole = model.RoleEditor
+
+// roleOf looks up the user's role in the chat. A chat without owners is
+// bootstrapped from its Telegram administrators; in a private chat the
+// user owns the books.
+func (d Deps) roleOf(ctx context.Context, chat api.Chat, user *api.User) (model.Role, error) {
+	if user == nil {
+		return 0, nil
+	}
+
+	role, err := d.Storage.GetRole(ctx, chat.ID, user.ID)
+	if err == nil {
+		return role, nil
+	}
+	if !errors.Is(err, sqlite.ErrNotFound) {
+		return 0, err
+	}
+
+	if chat.IsPrivate() {
+		m := model.ChatMember{ChatId: chat.ID, UserId: user.ID, Name: displayName(user), Role: model.RoleOwner}
+		if err := d.Storage.SetRoles(ctx, m); err != nil {
+			return 0, err
+		}
+		return model.RoleOwner, nil
+	}
+
+	owners, err := d.Storage.CountOwners(ctx, chat.ID)
+	if err != nil {
+		return 0, err
+	}
+	if owners == 0 {
+		if err := d.bootstrapOwners(ctx, chat.ID); err != nil {
+			return 0, err
+		}
+		role, err := d.Storage.GetRole(ctx, chat.ID, user.ID)
+		if err == nil {
+			return role, nil
+		}
+		if !errors.Is(err, sqlite.ErrNotFound) {
+			return 0, err
+		}
+	}
+	// Without a member row the name is kept aside, for the history.
+	if name := displayName(user); name != "" {
+		if err := d.Storage.SeenUser(ctx, chat.ID, user.ID, name); err != nil {
+			log.Printf("record name in chat %d: %v", chat.ID, err)
+		}
+	}
+	return defaultRole, nil
+}
+
+func (d Deps) bootstrapOwners(ctx context.Context, chatID int64) error {
+	admins, err := d.Bot.GetChatAdministrators(api.ChatAdministratorsConfig{ChatConfig: api.ChatConfig{ChatID: chatID}})
+	if err != nil {
+		return err
+	}
+
+	var owners []model.ChatMember
+	for _, a := range admins {
+		if a.User == nil || a.User.IsBot {
+			continue
+		}
+		owners = append(owners, model.ChatMember{ChatId: chatID, UserId: a.User.ID, Name: displayName(a.User), Role: model.RoleOwner})
+	}
+	return d.Storage.SetRoles(ctx, owners...)
+}
+
+// allowed reports whether the user holds at least the needed role. Lookup
+// failures deny.
+func (d Deps) allowed(ctx context.Context, chat api.Chat, user *api.User, need model.Role) bool {
+	if need <= 0 {
+		return true
+	}
+	role, err := d.roleOf(ctx, chat, user)
+	if err != nil {
+		log.Printf("role lookup in chat %d: %v", chat.ID, err)
+		return false
+	}
+	return role >= need
+}
+
+// authorize is allowed for messages and replies with an explanation when
+// the sender lacks the role.
+func (d Deps) authorize(ctx context.Context, msg *api.Message, need model.Role) bool {
+	if d.allowed(ctx, msg.Chat, msg.From, need) {
+		return true
+	}
+	out := api.NewMessage(msg.Chat.ID, deniedText(need))
+	out.ReplyParameters.MessageID = msg.MessageID
+	_, _ = d.Bot.Send(out)
+	return false
+}
+
+func deniedText(need model.Role) string {
+	return msgs.T(msgs.PermissionDenied, roleLabel(need))
+}
+
+func roleLabel(r model.Role) string {
+	switch r {
+	case model.RoleViewer:
+		return "наблюдатель"
+	case model.RoleEditor:
+		return "редактор"
+	case model.RoleOwner:
+		return "владелец"
+	}
+	return "нет"
+}
+
+func displayName(u *api.User) string {
+	if u.UserName != "" {
+		return "@" + u.UserName
+	}
+	return strings.TrimSpace(u.FirstName + " " + u.LastName)
+}
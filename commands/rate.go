@@ -0,0 +1,204 @@
+package commands
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/exprcalc"
+	"github.com/maxBezel/ledgerbot/internal/csvimport"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/internal/period"
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func Rate() Command {
+	return Command{
+		Name:        "rate",
+		Description: "Курсы валют: /rate USD RUB 92.5 [дата]",
+		Hidden:      false,
+		Role:        model.RoleEditor,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			if msg.Document != nil {
+				return importRates(ctx, d, msg)
+			}
+
+			fields := strings.Fields(msg.CommandArguments())
+			switch len(fields) {
+			case 0:
+				return listRates(ctx, d, chatID, "", "")
+			case 1:
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RateUsage)))
+				return nil
+			}
+
+			base, err1 := model.NormalizeCurrency(fields[0])
+			quote, err2 := model.NormalizeCurrency(fields[1])
+			if err1 != nil || err2 != nil || base == quote {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RateUsage)))
+				return nil
+			}
+			if len(fields) == 2 {
+				return listRates(ctx, d, chatID, base, quote)
+			}
+
+			rate, err := parseRate(fields[2])
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.InvalidRate, fields[2])))
+				return nil
+			}
+
+			validFrom := time.Now()
+			if len(fields) > 3 {
+				r, err := period.Parse(strings.Join(fields[3:], " "), time.Now())
+				if err != nil || r.From.IsZero() {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.StatementBadPeriod, strings.Join(fields[3:], " "))))
+					return nil
+				}
+				validFrom = r.From
+			}
+
+			if err := d.Storage.AddRates(ctx, model.NewRate(chatID, base, quote, rate, validFrom, msg.From.ID)); err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+
+			reply := msgs.T(msgs.RateSaved, base, formatRate(rate), quote, validFrom.Format("02.01.2006"))
+			_, _ = d.Bot.Send(api.NewMessage(chatID, reply))
+			return nil
+		},
+	}
+}
+
+func listRates(ctx context.Context, d Deps, chatID int64, base, quote string) error {
+	rates, err := d.Storage.ListRates(ctx, chatID, base, quote, 20)
+	if err != nil {
+		return err
+	}
+	if len(rates) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoRatesYet)))
+		return nil
+	}
+
+	rows := make([][]string, len(rates))
+	for i, r := range rates {
+		rows[i] = []string{formatUnixDate(r.ValidFrom), "1 " + r.Base, "=", formatRate(r.Rate), r.Quote}
+	}
+
+	out := api.NewMessage(chatID, "<b>Курсы валют:</b>\n<pre>"+renderPre(rows, []bool{false, true, false, true, false})+"</pre>")
+	out.ParseMode = "HTML"
+	_, _ = d.Bot.Send(out)
+	return nil
+}
+
+// importRates reads a CSV document of "[date,]BASE,QUOTE,RATE" lines. The
+// delimiter may be a comma, semicolon or tab; with a semicolon or tab the
+// rate may use a decimal comma. A header line is skipped.
+func importRates(ctx context.Context, d Deps, msg *api.Message) error {
+	chatID := msg.Chat.ID
+	data, err := downloadDocument(ctx, d, msg.Document)
+	if err != nil {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+		return err
+	}
+
+	r := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	r.Comma = csvimport.DetectDelimiter(data)
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	records, err := r.ReadAll()
+	if err != nil {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RateImportFailed, 0, err.Error())))
+		return nil
+	}
+
+	now := time.Now()
+	var rates []*model.Rate
+	for i, rec := range records {
+		rate, err := parseRateRecord(rec, chatID, msg.From.ID, now)
+		if err != nil {
+			if i == 0 {
+				continue
+			}
+			_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RateImportFailed, i+1, err.Error())))
+			return nil
+		}
+		rates = append(rates, rate)
+	}
+	if len(rates) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RateImportFailed, 0, "нет строк с курсами")))
+		return nil
+	}
+
+	if err := d.Storage.AddRates(ctx, rates...); err != nil {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+		return err
+	}
+	_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RatesImported, len(rates))))
+	return nil
+}
+
+func parseRateRecord(rec []string, chatID, userID int64, now time.Time) (*model.Rate, error) {
+	validFrom := now
+	switch len(rec) {
+	case 3:
+	case 4:
+		r, err := period.Parse(rec[0], now)
+		if err != nil || r.From.IsZero() {
+			return nil, fmt.Errorf("дата %q", rec[0])
+		}
+		validFrom = r.From
+		rec = rec[1:]
+	default:
+		return nil, fmt.Errorf("ожидалось 3 или 4 колонки")
+	}
+
+	base, err := model.NormalizeCurrency(rec[0])
+	if err != nil {
+		return nil, fmt.Errorf("валюта %q", rec[0])
+	}
+	quote, err := model.NormalizeCurrency(rec[1])
+	if err != nil || quote == base {
+		return nil, fmt.Errorf("валюта %q", rec[1])
+	}
+	rate, err := parseRate(rec[2])
+	if err != nil {
+		return nil, fmt.Errorf("курс %q", rec[2])
+	}
+	return model.NewRate(chatID, base, quote, rate, validFrom, userID), nil
+}
+
+// parseRate accepts any positive expression, e.g. "92.5", "92,5" or
+// "1/92.5", and keeps it exact.
+func parseRate(s string) (*big.Rat, error) {
+	r, err := exprcalc.Eval(s)
+	if err != nil {
+		return nil, err
+	}
+	if r.Sign() <= 0 {
+		return nil, fmt.Errorf("rate must be positive")
+	}
+	return r, nil
+}
+
+// formatRate shows up to six decimal places without trailing zeros.
+func formatRate(r *big.Rat) string {
+	s := r.FloatString(6)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func formatUnixDate(unix string) string {
+	sec, err := strconv.ParseInt(strings.TrimSpace(unix), 10, 64)
+	if err != nil {
+		return unix
+	}
+	return time.Unix(sec, 0).Format("02.01.2006")
+}
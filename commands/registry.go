@@ -3,31 +3,80 @@ package commands
 import (
 	"context"
 	"log"
+	"math/big"
+	"strings"
+	"time"
 
 	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/internal/backup"
 	"github.com/maxBezel/ledgerbot/model"
 	sqlite "github.com/maxBezel/ledgerbot/storage"
 )
 
 type Bot interface {
 	Send(c api.Chattable) (api.Message, error)
+	GetFileDirectURL(fileID string) (string, error)
+	GetChatAdministrators(config api.ChatAdministratorsConfig) ([]api.ChatMember, error)
 }
 type Storage interface {
 	AddAccount(ctx context.Context, acc *model.Account) error
-	RemoveAccount(ctx context.Context, chatID int64, name string) error
 	GetAll(ctx context.Context, chatID int64) ([]string, error)
-	ApplyDeltaAndLog(ctx context.Context, chatId int64, name string, delta float64, txs *model.Transaction) (newBalance float64, txnID int64, err error)
+	ApplyDeltaAndLog(ctx context.Context, chatId int64, name string, delta model.Money, txs *model.Transaction) (newBalance model.Money, txnID int64, err error)
 	Exists(ctx context.Context, chatID int64, name string) (bool, error)
 	GetAccountID(ctx context.Context, chatID int64, name string) (int, error)
-	RevertTransaction(ctx context.Context, txsId int64) (float64, float64, error)
+	GetAccount(ctx context.Context, chatID int64, name string) (*model.Account, error)
+	RevertTransaction(ctx context.Context, txsId int64, revertedBy int64) (model.Money, model.Money, error)
 	ListAccountBalances(ctx context.Context, chatID int64) ([]sqlite.AccountBalance, error)
-	WriteTransactionsCsv(ctx context.Context, chatId int64, filename string) error
-	GetCurrentBalance(ctx context.Context, accountID int) (float64, error)
+	WriteTransactionsCsv(ctx context.Context, filter sqlite.TxnFilter, filename string) error
+	WriteTransactionsXlsx(ctx context.Context, filter sqlite.TxnFilter, filename string) error
+	GetCurrentBalance(ctx context.Context, accountID int) (model.Money, error)
+	Transfer(ctx context.Context, chatId int64, from, to string, out, in *model.Transaction) (int64, error)
+	RevertTransfer(ctx context.Context, transferID int64, revertedBy int64) ([]sqlite.TransferLeg, error)
+	SetReplyMessage(ctx context.Context, txsId int64, msgID int) error
+	FindBySourceMessage(ctx context.Context, chatID int64, msgID int) (*model.Transaction, string, error)
+	EditTransaction(ctx context.Context, txs *model.Transaction) error
+	Reconcile(ctx context.Context, chatID int64, fix bool) ([]sqlite.Discrepancy, error)
+	AddRates(ctx context.Context, rates ...*model.Rate) error
+	LatestRate(ctx context.Context, chatID int64, base, quote string, at time.Time) (*big.Rat, error)
+	ListRates(ctx context.Context, chatID int64, base, quote string, limit int) ([]model.Rate, error)
+	GetRole(ctx context.Context, chatID, userID int64) (model.Role, error)
+	SetRoles(ctx context.Context, members ...model.ChatMember) error
+	SeenUser(ctx context.Context, chatID, userID int64, name string) error
+	CountOwners(ctx context.Context, chatID int64) (int, error)
+	ListRoles(ctx context.Context, chatID int64) ([]model.ChatMember, error)
+	GetTransaction(ctx context.Context, id int64) (*model.Transaction, error)
+	ArchiveAccount(ctx context.Context, chatID int64, accountID int) (string, error)
+	RestoreAccount(ctx context.Context, chatID int64, name string) error
+	ListArchived(ctx context.Context, chatID int64) ([]sqlite.ArchivedAccount, error)
+	PurgeArchived(ctx context.Context, chatID int64, before time.Time) ([]string, error)
+	RenameAccount(ctx context.Context, chatID int64, oldName, newName string) error
+	NameInUse(ctx context.Context, chatID int64, name string) (*sqlite.NameUse, error)
+	MergeAccounts(ctx context.Context, chatID int64, src, dst string) (sqlite.MergeResult, error)
+	GetAccountByID(ctx context.Context, chatID int64, id int) (*model.Account, error)
+	AddAlias(ctx context.Context, chatID int64, accountID int, alias string) error
+	RemoveAlias(ctx context.Context, chatID int64, alias string) error
+	ResolveAlias(ctx context.Context, chatID int64, alias string) (string, error)
+	ListAliases(ctx context.Context, chatID int64) ([]sqlite.Alias, error)
+	History(ctx context.Context, filter sqlite.TxnFilter, before, after int64, limit int) (sqlite.HistoryPage, error)
+	Transactions(ctx context.Context, filter sqlite.TxnFilter) ([]sqlite.HistoryEntry, error)
+	Search(ctx context.Context, filter sqlite.TxnFilter, query string, before, after int64, limit int) (sqlite.HistoryPage, error)
+	GetTag(ctx context.Context, chatID int64, name string) (*model.Tag, error)
+	GetTagByID(ctx context.Context, chatID int64, id int) (*model.Tag, error)
+	TagTotals(ctx context.Context, chatID int64, from, to time.Time) ([]sqlite.TagTotal, error)
+	PeriodReport(ctx context.Context, chatID int64, accountID int, from, to time.Time) ([]sqlite.PeriodTotals, []sqlite.PeriodTotals, error)
+	BalanceSeries(ctx context.Context, accountID int, from, to time.Time) ([]sqlite.BalancePoint, error)
+	ImportTransactions(ctx context.Context, chatID int64, accountID, sourceMsgID int, fileName string, createdBy int64, txs []*model.Transaction) (int64, model.Money, error)
+	GetImport(ctx context.Context, chatID, importID int64) (*sqlite.Import, error)
+	LatestTransactionTime(ctx context.Context, accountID int) (time.Time, error)
+	RevertImport(ctx context.Context, chatID, importID, revertedBy int64) (int, error)
+	Backup(ctx context.Context, chatID int64) (*backup.File, error)
+	RestoreBackup(ctx context.Context, chatID int64, f *backup.File, dryRun bool) (sqlite.RestoreSummary, error)
 }
 
 type Deps struct {
 	Bot     Bot
 	Storage Storage
+	Eval    Evaluator
 }
 
 type Handler func(ctx context.Context, d Deps, msg *api.Message) error
@@ -35,8 +84,10 @@ type Handler func(ctx context.Context, d Deps, msg *api.Message) error
 type Command struct {
 	Name        string
 	Description string
-	Hidden 		  bool
-	Handle      Handler
+	Hidden      bool
+	// Role is the least role a chat member needs to run the command.
+	Role   model.Role
+	Handle Handler
 }
 
 type Registry struct {
@@ -55,23 +106,53 @@ func (r *Registry) Handle(ctx context.Context, msg *api.Message) bool {
 		return false
 	}
 	name := msg.Command()
+	if name == "" {
+		name, _ = documentCommand(msg)
+	}
 
 	if c, ok := r.m[name]; ok {
+		if !r.deps.authorize(ctx, msg, c.Role) {
+			return true
+		}
 		_ = c.Handle(ctx, r.deps, msg)
 		return true
 	} else {
 		if t, ok := r.m["transaction"]; ok {
+			// Plain chat messages are not transactions and are ignored by
+			// the handler, so only slash messages are checked.
+			if strings.HasPrefix(msg.Text, "/") && !r.deps.authorize(ctx, msg, t.Role) {
+				return true
+			}
 			err := t.Handle(ctx, r.deps, msg)
 			if err != nil {
-				log.Printf(err.Error())
+				log.Print(err)
 			}
-			
+
 			return true
 		}
 	}
 	return false
 }
 
+// HandleEdit handles an edited message. Only messages that were handled as
+// transactions are re-applied; edits of other commands are ignored.
+func (r *Registry) HandleEdit(ctx context.Context, msg *api.Message) bool {
+	if msg == nil {
+		return false
+	}
+	if _, ok := r.m[msg.Command()]; ok {
+		return false
+	}
+	t, ok := r.m["transaction"]
+	if !ok {
+		return false
+	}
+	if err := HandleEdit(ctx, r.deps, msg, t.Role); err != nil {
+		log.Print(err)
+	}
+	return true
+}
+
 func (r *Registry) BotCommands() []api.BotCommand {
 	out := make([]api.BotCommand, 0, len(r.m))
 	for _, c := range r.m {
@@ -0,0 +1,88 @@
+package commands
+
+import (
+	"context"
+	"errors"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Rename() Command {
+	return Command{
+		Name:        "rename",
+		Description: "Переименовать счет",
+		Hidden:      false,
+		Role:        model.RoleEditor,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			oldName, newName, rest := splitTwoNames(msg.CommandArguments())
+			if oldName == "" || newName == "" || rest != "" {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RenameUsage)))
+				return nil
+			}
+
+			err := d.Storage.RenameAccount(ctx, chatID, oldName, newName)
+			switch {
+			case errors.Is(err, sqlite.ErrNotFound):
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, oldName)))
+				return nil
+			case errors.Is(err, sqlite.ErrAccountExists):
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccAlreadyExist)))
+				return nil
+			case err != nil:
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+
+			_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccRenamed, oldName, newName)))
+			return nil
+		},
+	}
+}
+
+func Merge() Command {
+	return Command{
+		Name:        "merge",
+		Description: "Перенести все операции одного счета в другой",
+		Hidden:      false,
+		Role:        model.RoleOwner,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			src, dst, rest := splitTwoNames(msg.CommandArguments())
+			if src == "" || dst == "" || rest != "" || src == dst {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.MergeUsage)))
+				return nil
+			}
+
+			var accs [2]*model.Account
+			for i, name := range []string{src, dst} {
+				acc, err := d.Storage.GetAccount(ctx, chatID, name)
+				if errors.Is(err, sqlite.ErrNotFound) {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, name)))
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				accs[i] = acc
+			}
+			if accs[0].Currency != accs[1].Currency {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.MergeCurrencyMismatch, currencyLabel(accs[0].Currency), currencyLabel(accs[1].Currency))))
+				return nil
+			}
+
+			res, err := d.Storage.MergeAccounts(ctx, chatID, src, dst)
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+
+			reply := msgs.T(msgs.AccMerged, src, dst, res.Moved, formatMoney(res.Balance, accs[1].Currency))
+			_, _ = d.Bot.Send(api.NewMessage(chatID, reply))
+			return nil
+		},
+	}
+}
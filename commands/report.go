@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"html"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/internal/period"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Report() Command {
+	return Command{
+		Name:        "report",
+		Description: "Отчет: /report [период] [счет], /report tags [период]",
+		Hidden:      false,
+		Role:        model.RoleViewer,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			args := strings.TrimSpace(msg.CommandArguments())
+			if sub, rest, _ := strings.Cut(args, " "); strings.EqualFold(sub, "tags") || strings.EqualFold(sub, "теги") {
+				r, ok := reportPeriod(rest, time.Now())
+				if !ok {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.StatementBadPeriod, rest)))
+					return nil
+				}
+				return sendTagReport(ctx, d, chatID, r)
+			}
+
+			accountID, args, err := cutReportAccount(ctx, d, chatID, args)
+			if err != nil {
+				return err
+			}
+			r, ok := reportPeriod(args, time.Now())
+			if !ok {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.ReportUsage)))
+				return nil
+			}
+			return sendPeriodReport(ctx, d, chatID, accountID, r)
+		},
+	}
+}
+
+// cutReportAccount takes an account name off the end, or else the start, of
+// the report arguments.
+func cutReportAccount(ctx context.Context, d Deps, chatID int64, args string) (int, string, error) {
+	fields := strings.Fields(args)
+	if len(fields) == 0 {
+		return 0, args, nil
+	}
+	for _, i := range []int{len(fields) - 1, 0} {
+		id, err := viewableAccountID(ctx, d, chatID, fields[i])
+		if errors.Is(err, sqlite.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		rest := append(fields[:i:i], fields[i+1:]...)
+		return id, strings.Join(rest, " "), nil
+	}
+	return 0, args, nil
+}
+
+// reportPeriod parses the period of a report, defaulting to the current
+// month.
+func reportPeriod(args string, now time.Time) (period.Range, bool) {
+	if strings.TrimSpace(args) == "" {
+		return period.Month(now), true
+	}
+	r, err := period.Parse(args, now)
+	return r, err == nil
+}
+
+func sendPeriodReport(ctx context.Context, d Deps, chatID int64, accountID int, r period.Range) error {
+	accounts, summary, err := d.Storage.PeriodReport(ctx, chatID, accountID, r.From, r.To)
+	if err != nil {
+		return err
+	}
+	if len(accounts) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoAccountsYet)))
+		return nil
+	}
+
+	header := []string{"", "начало", "приход", "расход", "изменение", "конец", ""}
+	totalsRow := func(name string, p sqlite.PeriodTotals) []string {
+		return []string{
+			name,
+			formatAmount(p.Opening),
+			formatAmount(p.In),
+			formatAmount(p.Out),
+			formatAmount(p.Net),
+			formatAmount(p.Closing),
+			p.Currency,
+		}
+	}
+	alignRight := []bool{false, true, true, true, true, true, false}
+
+	rows := [][]string{header}
+	for _, p := range accounts {
+		rows = append(rows, totalsRow(p.Account, p))
+	}
+
+	var b strings.Builder
+	b.WriteString("<b>Отчет ")
+	b.WriteString(html.EscapeString(r.Label()))
+	b.WriteString(":</b>\n<pre>")
+	b.WriteString(renderPre(rows, alignRight))
+	b.WriteString("</pre>")
+
+	if accountID == 0 && len(summary) > 0 {
+		rows = [][]string{header}
+		for _, p := range summary {
+			rows = append(rows, totalsRow("Всего", p))
+		}
+		b.WriteString("\n<b>По чату</b> (без переводов между счетами):\n<pre>")
+		b.WriteString(renderPre(rows, alignRight))
+		b.WriteString("</pre>")
+	}
+
+	out := api.NewMessage(chatID, b.String())
+	out.ParseMode = "HTML"
+	_, _ = d.Bot.Send(out)
+	return nil
+}
+
+func sendTagReport(ctx context.Context, d Deps, chatID int64, r period.Range) error {
+	totals, err := d.Storage.TagTotals(ctx, chatID, r.From, r.To)
+	if err != nil {
+		return err
+	}
+	if len(totals) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NoTransactionsInPeriod, r.Label())))
+		return nil
+	}
+
+	rows := [][]string{{"", "приход", "расход", ""}}
+	for _, t := range totals {
+		tag := "без тега"
+		if t.Tag != "" {
+			tag = "#" + t.Tag
+		}
+		rows = append(rows, []string{tag, formatAmount(t.In), formatAmount(t.Out), t.Currency})
+	}
+
+	var b strings.Builder
+	b.WriteString("<b>По тегам ")
+	b.WriteString(html.EscapeString(r.Label()))
+	b.WriteString(":</b>\n<pre>")
+	b.WriteString(renderPre(rows, []bool{false, true, true, false}))
+	b.WriteString("</pre>")
+
+	out := api.NewMessage(chatID, b.String())
+	out.ParseMode = "HTML"
+	_, _ = d.Bot.Send(out)
+	return nil
+}
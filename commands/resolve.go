@@ -0,0 +1,155 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+// maxSuggestions caps the buttons offered for an unknown account name.
+const maxSuggestions = 3
+
+// findAccount resolves what the user typed to an active account: the exact
+// name first, then a name equal after model.NormalizeName, then an alias.
+// An archived account with exactly that name gives sqlite.ErrArchived.
+func findAccount(ctx context.Context, d Deps, chatID int64, typed string) (*model.Account, error) {
+	acc, err := d.Storage.GetAccount(ctx, chatID, typed)
+	if !errors.Is(err, sqlite.ErrNotFound) {
+		return acc, err
+	}
+
+	key := model.NormalizeName(typed)
+	names, err := d.Storage.GetAll(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		if model.NormalizeName(name) == key {
+			return d.Storage.GetAccount(ctx, chatID, name)
+		}
+	}
+
+	name, err := d.Storage.ResolveAlias(ctx, chatID, typed)
+	if err == nil {
+		return d.Storage.GetAccount(ctx, chatID, name)
+	}
+	if !errors.Is(err, sqlite.ErrNotFound) {
+		return nil, err
+	}
+
+	exists, err := d.Storage.Exists(ctx, chatID, typed)
+	if err != nil {
+		return nil, err
+	}
+	if exists {
+		return nil, sqlite.ErrArchived
+	}
+	return nil, sqlite.ErrNotFound
+}
+
+// suggestAccounts returns up to maxSuggestions active account names whose
+// name or alias is closest to typed, nearest first. Candidates further
+// than half the typed length are left out.
+func suggestAccounts(ctx context.Context, d Deps, chatID int64, typed string) ([]string, error) {
+	names, err := d.Storage.GetAll(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+	aliases, err := d.Storage.ListAliases(ctx, chatID)
+	if err != nil {
+		return nil, err
+	}
+
+	key := model.NormalizeName(typed)
+	limit := (utf8.RuneCountInString(key) + 1) / 2
+	best := make(map[string]int)
+	consider := func(candidate, account string) {
+		dist := levenshtein(key, model.NormalizeName(candidate))
+		if dist > limit {
+			return
+		}
+		if cur, ok := best[account]; !ok || dist < cur {
+			best[account] = dist
+		}
+	}
+	for _, name := range names {
+		consider(name, name)
+	}
+	for _, a := range aliases {
+		consider(a.Alias, a.Account)
+	}
+
+	out := make([]string, 0, len(best))
+	for name := range best {
+		out = append(out, name)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if best[out[i]] != best[out[j]] {
+			return best[out[i]] < best[out[j]]
+		}
+		return out[i] < out[j]
+	})
+	if len(out) > maxSuggestions {
+		out = out[:maxSuggestions]
+	}
+	return out, nil
+}
+
+// replyUnknownAccount tells the user the account does not exist and, when
+// there are close names, offers them as buttons. The reply quotes msg so
+// that the chosen button can read the pending transaction back from it.
+func replyUnknownAccount(ctx context.Context, d Deps, msg *api.Message, typed string) error {
+	chatID := msg.Chat.ID
+	names, err := suggestAccounts(ctx, d, chatID, typed)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, typed)))
+		return nil
+	}
+
+	var rows [][]api.InlineKeyboardButton
+	for _, name := range names {
+		id, err := d.Storage.GetAccountID(ctx, chatID, name)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, api.NewInlineKeyboardRow(api.NewInlineKeyboardButtonData(name, fmt.Sprintf("pick:%d", id))))
+	}
+
+	out := api.NewMessage(chatID, msgs.T(msgs.AccSuggest, typed))
+	out.ReplyParameters.MessageID = msg.MessageID
+	out.ReplyMarkup = api.NewInlineKeyboardMarkup(rows...)
+	_, _ = d.Bot.Send(out)
+	return nil
+}
+
+// levenshtein is the edit distance between a and b counted in runes.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,91 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+// archiveRetention is how long an archived account is kept before /purge
+// may delete it for good.
+const archiveRetention = 30 * 24 * time.Hour
+
+func Restore() Command {
+	return Command{
+		Name:        "restore",
+		Description: "Вернуть счет из архива или восстановить файл /backup",
+		Hidden:      false,
+		Role:        model.RoleOwner,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			if msg.Document != nil {
+				return restoreBackup(ctx, d, msg)
+			}
+			accName := strings.TrimSpace(msg.CommandArguments())
+			if accName == "" {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RestoreUsage)))
+				return nil
+			}
+
+			err := d.Storage.RestoreAccount(ctx, chatID, accName)
+			if errors.Is(err, sqlite.ErrNotFound) {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.NotArchived, accName)))
+				return nil
+			}
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+
+			_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccRestored, accName)))
+			return nil
+		},
+	}
+}
+
+func Purge() Command {
+	return Command{
+		Name:        "purge",
+		Description: "Окончательно удалить давно архивированные счета",
+		Hidden:      true,
+		Role:        model.RoleOwner,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+
+			archived, err := d.Storage.ListArchived(ctx, chatID)
+			if err != nil {
+				return err
+			}
+
+			// The cutoff goes into the button so that confirming later does
+			// not purge accounts that were not listed.
+			cutoff := time.Now().Add(-archiveRetention)
+			var names []string
+			for _, a := range archived {
+				if !a.ArchivedAt.After(cutoff) {
+					names = append(names, a.Name)
+				}
+			}
+			if len(names) == 0 {
+				days := int(archiveRetention / (24 * time.Hour))
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.PurgeNothing, days)))
+				return nil
+			}
+
+			yes := api.NewInlineKeyboardButtonData("Удалить навсегда", fmt.Sprintf("purge:%d", cutoff.Unix()))
+			no := api.NewInlineKeyboardButtonData("Отмена", "purge:no")
+
+			out := api.NewMessage(chatID, msgs.T(msgs.PurgeConfirm, strings.Join(names, ", ")))
+			out.ReplyMarkup = api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(yes, no))
+			_, _ = d.Bot.Send(out)
+			return nil
+		},
+	}
+}
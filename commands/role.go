@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func Role() Command {
+	return Command{
+		Name:        "role",
+		Description: "Роли участников (ответом на сообщение: /role editor)",
+		Hidden:      false,
+		Role:        model.RoleOwner,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			args := strings.Fields(msg.CommandArguments())
+			if len(args) == 0 {
+				return sendRoles(ctx, d, chatID)
+			}
+
+			var target model.ChatMember
+			switch {
+			case len(args) == 1 && msg.ReplyToMessage != nil && msg.ReplyToMessage.From != nil:
+				u := msg.ReplyToMessage.From
+				target = model.ChatMember{ChatId: chatID, UserId: u.ID, Name: displayName(u)}
+			case len(args) == 2:
+				id, err := strconv.ParseInt(args[0], 10, 64)
+				if err != nil {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RoleUsage)))
+					return nil
+				}
+				target = model.ChatMember{ChatId: chatID, UserId: id, Name: args[0]}
+				args = args[1:]
+			default:
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RoleUsage)))
+				return nil
+			}
+
+			role, ok := model.ParseRole(args[0])
+			if !ok {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RoleUsage)))
+				return nil
+			}
+			target.Role = role
+
+			if role != model.RoleOwner {
+				current, err := d.roleOf(ctx, msg.Chat, &api.User{ID: target.UserId})
+				if err != nil {
+					return err
+				}
+				owners, err := d.Storage.CountOwners(ctx, chatID)
+				if err != nil {
+					return err
+				}
+				if current == model.RoleOwner && owners <= 1 {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RoleLastOwner)))
+					return nil
+				}
+			}
+
+			if err := d.Storage.SetRoles(ctx, target); err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+			_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RoleSet, target.Name, roleLabel(role))))
+			return nil
+		},
+	}
+}
+
+func sendRoles(ctx context.Context, d Deps, chatID int64) error {
+	members, err := d.Storage.ListRoles(ctx, chatID)
+	if err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(members))
+	for i, m := range members {
+		rows[i] = []string{m.Name, roleLabel(m.Role), fmt.Sprint(m.UserId)}
+	}
+
+	var b strings.Builder
+	b.WriteString(msgs.T(msgs.RolesList, html.EscapeString(roleLabel(defaultRole))))
+	b.WriteString("<pre>")
+	b.WriteString(renderPre(rows, []bool{false, false, true}))
+	b.WriteString("</pre>")
+
+	out := api.NewMessage(chatID, b.String())
+	out.ParseMode = "HTML"
+	_, _ = d.Bot.Send(out)
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 
 	api "github.com/OvyFlash/telegram-bot-api"
 	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
 )
 
 func Start() Command {
@@ -12,6 +13,7 @@ func Start() Command {
 		Name:        "start",
 		Description: "Начать диалог с ботом",
 		Hidden: false,
+		Role:        model.RoleViewer,
 		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
 			reply := msgs.T(msgs.Start)
 			_, err := d.Bot.Send(api.NewMessage(msg.Chat.ID, reply))
@@ -0,0 +1,164 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/internal/period"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Statement() Command {
+	return Command{
+		Name:        "statement",
+		Description: "Выписка: /statement [счет] [#тег] [период] [xlsx]",
+		Hidden:      false,
+		Role:        model.RoleViewer,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			format, args := cutStatementFormat(strings.TrimSpace(msg.CommandArguments()))
+
+			var tag *model.Tag
+			if name, rest, ok := cutHashtag(args); ok {
+				t, err := d.Storage.GetTag(ctx, chatID, name)
+				if errors.Is(err, sqlite.ErrNotFound) {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnknownTag, "#"+name)))
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				tag, args = t, rest
+			}
+
+			accountID, accName := 0, ""
+			if first, rest, _ := strings.Cut(args, " "); first != "" {
+				id, err := viewableAccountID(ctx, d, chatID, first)
+				if err != nil && !errors.Is(err, sqlite.ErrNotFound) {
+					return err
+				}
+				if err == nil {
+					accountID, accName, args = id, first, strings.TrimSpace(rest)
+				}
+			}
+
+			if args == "" {
+				out := api.NewMessage(chatID, msgs.T(msgs.StatementPickPeriod))
+				out.ReplyMarkup = statementPicker(accountID, tagID(tag), time.Now())
+				_, _ = d.Bot.Send(out)
+				return nil
+			}
+
+			r, err := period.Parse(args, time.Now())
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.StatementBadPeriod, args)))
+				return nil
+			}
+
+			if err := sendStatement(ctx, d, chatID, accountID, accName, tag, r, format); err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, "Не удалось сформировать выписку: "+err.Error()))
+				return err
+			}
+			return nil
+		},
+	}
+}
+
+// statementFormat is the file type of a statement.
+type statementFormat string
+
+const (
+	formatCSV  statementFormat = "csv"
+	formatXLSX statementFormat = "xlsx"
+)
+
+// cutStatementFormat takes a "csv", "xlsx" or "excel" word out of args;
+// the format defaults to CSV.
+func cutStatementFormat(args string) (statementFormat, string) {
+	fields := strings.Fields(args)
+	for i, f := range fields {
+		format := formatCSV
+		switch strings.ToLower(f) {
+		case "csv":
+		case "xlsx", "excel":
+			format = formatXLSX
+		default:
+			continue
+		}
+		rest := append(fields[:i:i], fields[i+1:]...)
+		return format, strings.Join(rest, " ")
+	}
+	return formatCSV, args
+}
+
+// statementPicker offers periods and formats for a statement as
+// stmt:<period>:<account>:<tag>:<format> callbacks, with tag 0 when not
+// filtering by a tag.
+func statementPicker(accountID, tagID int, now time.Time) api.InlineKeyboardMarkup {
+	row := func(text string, r period.Range) []api.InlineKeyboardButton {
+		btn := func(format statementFormat, label string) api.InlineKeyboardButton {
+			data := fmt.Sprintf("stmt:%s:%d:%d:%s", r.Key(), accountID, tagID, format)
+			return api.NewInlineKeyboardButtonData(text+" · "+label, data)
+		}
+		return api.NewInlineKeyboardRow(btn(formatCSV, "CSV"), btn(formatXLSX, "Excel"))
+	}
+	lastMonth := period.Month(period.Month(now).From.AddDate(0, -1, 0))
+	return api.NewInlineKeyboardMarkup(
+		row("Этот месяц", period.Month(now)),
+		row("Прошлый месяц", lastMonth),
+		row("За все время", period.All),
+	)
+}
+
+func sendStatement(ctx context.Context, d Deps, chatID int64, accountID int, accName string, tag *model.Tag, r period.Range, format statementFormat) error {
+	ts := time.Now().UTC().Format("20060102_150405Z")
+	filename := fmt.Sprintf("statement_%d_%s.%s", chatID, ts, format)
+
+	filter := sqlite.TxnFilter{ChatID: chatID, AccountID: accountID, From: r.From, To: r.To, TagID: tagID(tag)}
+	write := d.Storage.WriteTransactionsCsv
+	if format == formatXLSX {
+		write = d.Storage.WriteTransactionsXlsx
+	}
+	if err := write(ctx, filter, filename); err != nil {
+		return err
+	}
+	defer os.Remove(filename)
+
+	doc := api.NewDocument(chatID, api.FilePath(filename))
+	if accName != "" {
+		doc.Caption = fmt.Sprintf("Выписка по счету %s %s", accName, r.Label())
+	} else {
+		doc.Caption = "Выписка по счетам " + r.Label()
+	}
+	if tag != nil {
+		doc.Caption += ", #" + tag.Name
+	}
+	_, err := d.Bot.Send(doc)
+	return err
+}
+
+// cutHashtag takes the first #tag word out of args.
+func cutHashtag(args string) (tag, rest string, ok bool) {
+	fields := strings.Fields(args)
+	for i, f := range fields {
+		if len(f) > 1 && f[0] == '#' {
+			rest := append(fields[:i:i], fields[i+1:]...)
+			return f[1:], strings.Join(rest, " "), true
+		}
+	}
+	return "", args, false
+}
+
+func tagID(t *model.Tag) int {
+	if t == nil {
+		return 0
+	}
+	return t.Id
+}
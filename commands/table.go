@@ -0,0 +1,46 @@
+package commands
+
+import (
+	"html"
+	"strings"
+	"unicode/utf8"
+)
+
+// renderPre lays rows out as aligned columns separated by two spaces, ready
+// to be put inside an HTML <pre> block. Columns flagged in alignRight are
+// padded on the left; columns that are empty in every row are dropped.
+// Cells are HTML-escaped.
+func renderPre(rows [][]string, alignRight []bool) string {
+	var widths []int
+	for _, row := range rows {
+		for i, cell := range row {
+			if i >= len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := utf8.RuneCountInString(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	var b strings.Builder
+	for r, row := range rows {
+		line := make([]string, 0, len(row))
+		for i, cell := range row {
+			if widths[i] == 0 {
+				continue
+			}
+			pad := strings.Repeat(" ", widths[i]-utf8.RuneCountInString(cell))
+			if i < len(alignRight) && alignRight[i] {
+				line = append(line, pad+html.EscapeString(cell))
+			} else {
+				line = append(line, html.EscapeString(cell)+pad)
+			}
+		}
+		b.WriteString(strings.TrimRight(strings.Join(line, "  "), " "))
+		if r < len(rows)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
@@ -1,19 +1,16 @@
 package commands
 
 import (
-	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"os"
-	"os/exec"
-	"strconv"
 	"strings"
-	"time"
 
 	api "github.com/OvyFlash/telegram-bot-api"
 	"github.com/maxBezel/ledgerbot/exprsplit"
 	msgs "github.com/maxBezel/ledgerbot/internal/messages"
 	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
 )
 
 func Transaction() Command {
@@ -21,6 +18,7 @@ func Transaction() Command {
 		Name:        "transaction",
 		Description: "Выполняет транзакцию для указанного аккаунта",
 		Hidden: true,
+		Role:        model.RoleEditor,
 		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
 			accName := msg.Command()
 			usrId := msg.From.ID
@@ -38,99 +36,146 @@ func Transaction() Command {
 				return nil
 			}
 
-			exists, err := d.Storage.Exists(ctx, chatID, accName)
-			if err != nil {
-				return err
+			acc, err := findAccount(ctx, d, chatID, accName)
+			if errors.Is(err, sqlite.ErrNotFound) {
+				return replyUnknownAccount(ctx, d, msg, accName)
 			}
-			if !exists {
-				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, accName)))
+			if errors.Is(err, sqlite.ErrArchived) {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccArchived, accName, accName)))
 				return nil
 			}
-
-			val, err := EvalQalc(ctx, expression, 20)
 			if err != nil {
-				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.InvalidExpression)))
 				return err
 			}
 
-			accountId, err := d.Storage.GetAccountID(ctx, chatID, accName)
-			if err != nil {
-				return err
-			}
+			return applyTransaction(ctx, d, chatID, acc, expression, note, usrId, msg.MessageID)
+		},
+	}
+}
 
-			balance, err := d.Storage.GetCurrentBalance(ctx, accountId)
-			if err != nil {
-				return err
-			}
+// applyTransaction evaluates expression, logs it against acc on behalf of
+// the user and sends the confirmation with an undo button. sourceMsgID is
+// the chat message the transaction was written in.
+func applyTransaction(ctx context.Context, d Deps, chatID int64, acc *model.Account, expression, note string, userID int64, sourceMsgID int) error {
+	val, err := d.evaluator().Eval(ctx, expression)
+	if err != nil {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, evalErrorText(err)))
+		return err
+	}
 
-			newBalance := balance + val
-			txs := model.NewTransaction(accountId, val, note, newBalance, expression, usrId)
-			newBalance, txsId, err := d.Storage.ApplyDeltaAndLog(ctx, chatID, accName, val, txs)
+	txs := model.NewTransaction(acc.Id, val, note, acc.Balance+val, expression, userID)
+	txs.SourceMsgId = sourceMsgID
+	newBalance, txsId, err := d.Storage.ApplyDeltaAndLog(ctx, chatID, acc.Name, val, txs)
+	if err != nil {
+		_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+		return err
+	}
 
-			btn := api.NewInlineKeyboardButtonData("↩️ Откатить это изменение", fmt.Sprintf("undo:%d,%s", txsId, accName))
-			kb := api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(btn))
+	msgOK := api.NewMessage(chatID, transactionReply(val, acc, note, newBalance))
+	msgOK.ReplyMarkup = undoKeyboard(txsId, acc.Name)
+	sent, err := d.Bot.Send(msgOK)
+	if err != nil {
+		return err
+	}
 
-			if note == "" {
-				note = "Нет"
-			}
-			reply := msgs.T(
-				msgs.BalanceUpdated,
-				formatAmount(val),
-				accName,
-				note,
-				formatAmount(newBalance),
-			)
-
-			msgOK := api.NewMessage(chatID, reply)
-			msgOK.ReplyMarkup = kb
-			_, _ = d.Bot.Send(msgOK)
+	return d.Storage.SetReplyMessage(ctx, txsId, sent.MessageID)
+}
 
-			return nil
-		},
+// HandleEdit re-applies a transaction after its source message was edited:
+// the amount, note and expression are replaced, later running balances are
+// shifted by the difference and the bot's confirmation is edited in place.
+// Edits of any other message are ignored; role is checked only once the
+// message turns out to be a transaction.
+func HandleEdit(ctx context.Context, d Deps, msg *api.Message, role model.Role) error {
+	chatID := msg.Chat.ID
+	txs, accName, err := d.Storage.FindBySourceMessage(ctx, chatID, msg.MessageID)
+	if errors.Is(err, sqlite.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if txs.Reverted || txs.TransferId != 0 {
+		return nil
+	}
+	if !d.authorize(ctx, msg, role) {
+		return nil
 	}
-}
 
-func EvalQalc(ctx context.Context, raw string, precision int) (float64, error) {
-	expr := strings.TrimSpace(raw)
+	newName, args := msg.Command(), msg.CommandArguments()
+	if newName == "" && strings.HasPrefix(msg.Text, "/") {
+		newName, args = parseSlash(msg.Text)
+	}
+	acc, err := findAccount(ctx, d, chatID, newName)
+	if errors.Is(err, sqlite.ErrArchived) {
+		_, _ = d.Bot.Send(editNotice(msg, msgs.T(msgs.ArchivedReadOnly)))
+		return nil
+	}
+	if err != nil && !errors.Is(err, sqlite.ErrNotFound) {
+		return err
+	}
+	if acc == nil || acc.Name != accName {
+		_, _ = d.Bot.Send(editNotice(msg, msgs.T(msgs.EditAccountChanged, accName)))
+		return nil
+	}
 
-	path, err := exec.LookPath("qalc")
+	expression, note, err := exprsplit.SplitExprAndComment(args)
 	if err != nil {
-		return 0, fmt.Errorf("qalc not found in PATH: %w", err)
+		_, _ = d.Bot.Send(editNotice(msg, msgs.T(msgs.NoExpression)))
+		return nil
 	}
 
-	precArg := fmt.Sprintf("prec %d", precision)
-	args := []string{"--terse", "--set", precArg, "--", expr}
-
-	if ctx == nil {
-		var cancel context.CancelFunc
-		ctx, cancel = context.WithTimeout(context.Background(), 3*time.Second)
-		defer cancel()
+	val, err := d.evaluator().Eval(ctx, expression)
+	if err != nil {
+		_, _ = d.Bot.Send(editNotice(msg, evalErrorText(err)))
+		return err
 	}
 
-	cmd := exec.CommandContext(ctx, path, args...)
-	env := os.Environ()
-	env = append(env, "LC_ALL=C", "LANG=C", "LC_NUMERIC=C")
-	cmd.Env = env
+	txs.Amount = val
+	txs.Expression = expression
+	txs.Note = strings.TrimSpace(note)
+	if err := d.Storage.EditTransaction(ctx, txs); err != nil {
+		if errors.Is(err, sqlite.ErrArchived) {
+			_, _ = d.Bot.Send(editNotice(msg, msgs.T(msgs.ArchivedReadOnly)))
+			return nil
+		}
+		_, _ = d.Bot.Send(editNotice(msg, msgs.T(msgs.UnsuccessfulOperation)))
+		return err
+	}
 
-	var stdout, stderr bytes.Buffer
-	cmd.Stdout = &stdout
-	cmd.Stderr = &stderr
+	if txs.ReplyMsgId == 0 {
+		return nil
+	}
+	edit := api.NewEditMessageTextAndMarkup(chatID, txs.ReplyMsgId,
+		transactionReply(val, acc, note, txs.Balance)+"\n\n"+msgs.T(msgs.TransactionEdited),
+		undoKeyboard(int64(txs.Id), accName),
+	)
+	_, err = d.Bot.Send(edit)
+	return err
+}
 
-	if err := cmd.Run(); err != nil {
-		return 0, fmt.Errorf("qalc run error: %v (stderr=%q)", err, strings.TrimSpace(stderr.String()))
+func transactionReply(val model.Money, acc *model.Account, note string, balance model.Money) string {
+	if note == "" {
+		note = "Нет"
 	}
+	return msgs.T(
+		msgs.BalanceUpdated,
+		formatMoney(val, acc.Currency),
+		acc.Name,
+		note,
+		formatMoney(balance, acc.Currency),
+	)
+}
 
-	res := strings.TrimSpace(stdout.String())
-	res = strings.ReplaceAll(res, "−", "-")
-	res = strings.ReplaceAll(res, " ", "")
-	res = strings.ReplaceAll(res, "\u2009", "")
-	res = strings.ReplaceAll(res, "\u202F", "")
+func undoKeyboard(txsId int64, accName string) api.InlineKeyboardMarkup {
+	btn := api.NewInlineKeyboardButtonData("↩️ Откатить это изменение", fmt.Sprintf("undo:%d,%s", txsId, accName))
+	return api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(btn))
+}
 
-	v, err := strconv.ParseFloat(res, 64)
-	if err != nil {
-		return 0, fmt.Errorf("parse qalc result %q failed for expr %q", res, expr)
-	}
-	return v, nil
+func editNotice(msg *api.Message, text string) api.MessageConfig {
+	out := api.NewMessage(msg.Chat.ID, text)
+	out.ReplyParameters.MessageID = msg.MessageID
+	return out
 }
 
 func parseSlash(s string) (cmd, args string) {
@@ -0,0 +1,162 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+	"github.com/maxBezel/ledgerbot/exprcalc"
+	"github.com/maxBezel/ledgerbot/exprsplit"
+	msgs "github.com/maxBezel/ledgerbot/internal/messages"
+	"github.com/maxBezel/ledgerbot/model"
+	sqlite "github.com/maxBezel/ledgerbot/storage"
+)
+
+func Transfer() Command {
+	return Command{
+		Name:        "transfer",
+		Description: "Перевести средства между счетами",
+		Hidden:      false,
+		Role:        model.RoleEditor,
+		Handle: func(ctx context.Context, d Deps, msg *api.Message) error {
+			chatID := msg.Chat.ID
+			from, to, rest := splitTwoNames(msg.CommandArguments())
+			if from == "" || to == "" {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.TransferUsage)))
+				return nil
+			}
+			expression, note, err := exprsplit.SplitExprAndComment(rest)
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.TransferUsage)))
+				return nil
+			}
+
+			var accs [2]*model.Account
+			for i, name := range []string{from, to} {
+				acc, err := findAccount(ctx, d, chatID, name)
+				if errors.Is(err, sqlite.ErrNotFound) || errors.Is(err, sqlite.ErrArchived) {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.AccDoesNotExist, name)))
+					return nil
+				}
+				if err != nil {
+					return err
+				}
+				accs[i] = acc
+			}
+			if accs[0].Id == accs[1].Id {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.TransferSameAccount)))
+				return nil
+			}
+			from, to = accs[0].Name, accs[1].Name
+			fromCur, toCur := accs[0].Currency, accs[1].Currency
+			if fromCur != toCur && (fromCur == "" || toCur == "") {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.TransferCurrencyMismatch, currencyLabel(fromCur), currencyLabel(toCur))))
+				return nil
+			}
+
+			// A converting transfer takes the rate from a leading "@92.5" in
+			// the comment, or else the latest rate stored for the pair.
+			var rate *big.Rat
+			if fromCur != toCur {
+				if r, ok := strings.CutPrefix(note, "@"); ok {
+					raw, rest, _ := strings.Cut(strings.TrimSpace(r), " ")
+					if rate, err = parseRate(raw); err != nil {
+						_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.InvalidRate, raw)))
+						return nil
+					}
+					note = strings.TrimSpace(rest)
+				} else {
+					rate, err = d.Storage.LatestRate(ctx, chatID, fromCur, toCur, time.Now())
+					if errors.Is(err, sqlite.ErrNotFound) {
+						_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.RateMissing, fromCur, toCur)))
+						return nil
+					}
+					if err != nil {
+						return err
+					}
+				}
+			}
+
+			val, err := d.evaluator().Eval(ctx, expression)
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, evalErrorText(err)))
+				return err
+			}
+			if val <= 0 {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.TransferNotPositive)))
+				return nil
+			}
+
+			out := model.NewTransaction(0, -val, note, 0, expression, msg.From.ID)
+			in := model.NewTransaction(0, val, note, 0, expression, msg.From.ID)
+			if rate != nil {
+				converted, err := exprcalc.ToMoney(new(big.Rat).Mul(big.NewRat(int64(val), model.MinorUnits), rate))
+				if err != nil {
+					_, _ = d.Bot.Send(api.NewMessage(chatID, evalErrorText(err)))
+					return err
+				}
+				in.Amount = converted
+				in.Expression = fmt.Sprintf("(%s)*%s", expression, formatRate(rate))
+				out.Rate = rate.RatString()
+				in.Rate = rate.RatString()
+			}
+			transferID, err := d.Storage.Transfer(ctx, chatID, from, to, out, in)
+			if err != nil {
+				_, _ = d.Bot.Send(api.NewMessage(chatID, msgs.T(msgs.UnsuccessfulOperation)))
+				return err
+			}
+
+			btn := api.NewInlineKeyboardButtonData("↩️ Откатить этот перевод", fmt.Sprintf("undotransfer:%d", transferID))
+			kb := api.NewInlineKeyboardMarkup(api.NewInlineKeyboardRow(btn))
+
+			if note == "" {
+				note = "Нет"
+			}
+			reply := msgs.T(
+				msgs.TransferDone,
+				formatMoney(val, fromCur),
+				from,
+				to,
+				note,
+				from,
+				formatMoney(out.Balance, fromCur),
+				to,
+				formatMoney(in.Balance, toCur),
+			)
+			if rate != nil {
+				reply = msgs.T(
+					msgs.TransferConvertedDone,
+					formatMoney(val, fromCur),
+					from,
+					formatMoney(in.Amount, toCur),
+					to,
+					formatRate(rate),
+					note,
+					from,
+					formatMoney(out.Balance, fromCur),
+					to,
+					formatMoney(in.Balance, toCur),
+				)
+			}
+
+			msgOK := api.NewMessage(chatID, reply)
+			msgOK.ReplyMarkup = kb
+			_, _ = d.Bot.Send(msgOK)
+			return nil
+		},
+	}
+}
+
+// splitTwoNames takes the first two whitespace-separated words of s as
+// account names and returns the remainder untouched.
+func splitTwoNames(s string) (first, second, rest string) {
+	s = strings.TrimSpace(s)
+	first, s, _ = strings.Cut(s, " ")
+	s = strings.TrimSpace(s)
+	second, rest, _ = strings.Cut(s, " ")
+	return first, second, strings.TrimSpace(rest)
+}
@@ -49,11 +49,13 @@ def clone_repo(repo: Path, url: str, branch: str, remote: str = "origin"):
     print(f"Cloning {url} (branch {branch}) into {repo} ...")
     run(["git", "clone", "--branch", branch, url, str(repo)])
 
-def build_go(repo: Path, binary_name: str, ldflags: str = "", extra_build_args=None) -> Path:
+def build_go(repo: Path, binary_name: str, ldflags: str = "", tags: str = "", extra_build_args=None) -> Path:
     which_or_die("go")
     build_dir = Path(tempfile.mkdtemp(prefix="go-build-"))
     out_path = build_dir / binary_name
     cmd = ["go", "build", "-o", str(out_path)]
+    if tags:
+        cmd.extend(["-tags", tags])
     if ldflags:
         cmd.extend(["-ldflags", ldflags])
     if extra_build_args:
@@ -98,6 +100,7 @@ def main():
     parser.add_argument("--use-sudo", action="store_true", help="Run systemctl with sudo (for system services)")
     parser.add_argument("--always-build", action="store_true", help="Build/restart even if no git updates detected")
     parser.add_argument("--ldflags", default="", help="Go build -ldflags string")
+    parser.add_argument("--tags", default="sqlite_fts5", help="Go build -tags (default: sqlite_fts5, the full-text index of /find)")
     parser.add_argument("--extra-build-arg", action="append", dest="extra_build_args", help="Extra args passed to `go build` (repeatable)")
     args = parser.parse_args()
 
@@ -134,7 +137,7 @@ def main():
             return
 
     print("Building Go project...")
-    new_bin = build_go(repo, args.binary_name, ldflags=args.ldflags, extra_build_args=args.extra_build_args)
+    new_bin = build_go(repo, args.binary_name, ldflags=args.ldflags, tags=args.tags, extra_build_args=args.extra_build_args)
 
     dest = deploy_binary(new_bin, args.work_dir, args.binary_name)
     print(f"Deployed binary to: {dest}")
@@ -0,0 +1,347 @@
+package exprcalc
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"unicode"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+/*
+Eval вычисляет выражения той же грамматики, что принимает
+exprsplit.SplitExprAndComment:
+
+	expr    := term   (('+' | '-') term)*
+	term    := unary  (('*' | '/') unary)*
+	unary   := ('+' | '-') unary | power
+	power   := postfix ('^' unary)?
+	postfix := primary '%'*
+	primary := number | '(' expr ')'
+
+Арифметика точная (math/big.Rat), без округлений до самого конца.
+Степень правоассоциативна и сильнее унарного минуса: -2^2 = -4.
+Постфиксный % делит на 100, но справа от + и - считается от левого
+операнда, как в qalc: 200 + 10% = 220, 200 - 10% = 180.
+*/
+
+var (
+	ErrSyntax          = errors.New("invalid expression")
+	ErrDivisionByZero  = errors.New("division by zero")
+	ErrOverflow        = errors.New("result is too large")
+	ErrFractionalPower = errors.New("exponent must be an integer")
+)
+
+// maxBits bounds the size of intermediate numerators and denominators so
+// that expressions like 9^9^9 fail fast instead of exhausting memory.
+const maxBits = 4096
+
+var hundred = big.NewRat(100, 1)
+
+// Eval evaluates expr exactly.
+func Eval(expr string) (*big.Rat, error) {
+	p := &parser{r: []rune(expr)}
+	p.skipSpaces()
+	v, _, err := p.parseExpr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.eof() {
+		return nil, p.syntaxError()
+	}
+	return v, nil
+}
+
+// EvalMoney evaluates expr and rounds the result half away from zero to
+// whole minor units.
+func EvalMoney(expr string) (model.Money, error) {
+	v, err := Eval(expr)
+	if err != nil {
+		return 0, err
+	}
+	return ToMoney(v)
+}
+
+// ToMoney rounds v half away from zero to whole minor units.
+func ToMoney(v *big.Rat) (model.Money, error) {
+	scaled := new(big.Rat).Mul(v, big.NewRat(model.MinorUnits, 1))
+	num := new(big.Int).Abs(scaled.Num())
+	q, r := new(big.Int).QuoRem(num, scaled.Denom(), new(big.Int))
+	if r.Lsh(r, 1).Cmp(scaled.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if scaled.Sign() < 0 {
+		q.Neg(q)
+	}
+	if !q.IsInt64() {
+		return 0, ErrOverflow
+	}
+	return model.Money(q.Int64()), nil
+}
+
+type parser struct {
+	r []rune
+	i int
+}
+
+func (p *parser) eof() bool { return p.i >= len(p.r) }
+
+func (p *parser) peek() rune {
+	if p.eof() {
+		return 0
+	}
+	return p.r[p.i]
+}
+
+func (p *parser) skipSpaces() {
+	for !p.eof() && unicode.IsSpace(p.r[p.i]) {
+		p.i++
+	}
+}
+
+func (p *parser) next() {
+	p.i++
+	p.skipSpaces()
+}
+
+func (p *parser) syntaxError() error {
+	if p.eof() {
+		return fmt.Errorf("%w: unexpected end", ErrSyntax)
+	}
+	return fmt.Errorf("%w: unexpected %q at position %d", ErrSyntax, p.r[p.i], p.i+1)
+}
+
+// parseExpr returns pct=true when the whole expression is a single
+// percentage term, so that an enclosing "a + (b%)" keeps qalc semantics.
+func (p *parser) parseExpr() (v *big.Rat, pct bool, err error) {
+	v, pct, err = p.parseTerm()
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		op := p.peek()
+		if op != '+' && op != '-' {
+			return v, pct, nil
+		}
+		p.next()
+
+		rhs, rhsPct, err := p.parseTerm()
+		if err != nil {
+			return nil, false, err
+		}
+		if rhsPct {
+			rhs = new(big.Rat).Mul(v, rhs)
+		}
+		if op == '+' {
+			v = new(big.Rat).Add(v, rhs)
+		} else {
+			v = new(big.Rat).Sub(v, rhs)
+		}
+		if err := checkSize(v); err != nil {
+			return nil, false, err
+		}
+		pct = false
+	}
+}
+
+func (p *parser) parseTerm() (v *big.Rat, pct bool, err error) {
+	v, pct, err = p.parseUnary()
+	if err != nil {
+		return nil, false, err
+	}
+	for {
+		op := p.peek()
+		if op != '*' && op != '/' {
+			return v, pct, nil
+		}
+		p.next()
+
+		rhs, _, err := p.parseUnary()
+		if err != nil {
+			return nil, false, err
+		}
+		if op == '*' {
+			v = new(big.Rat).Mul(v, rhs)
+		} else {
+			if rhs.Sign() == 0 {
+				return nil, false, ErrDivisionByZero
+			}
+			v = new(big.Rat).Quo(v, rhs)
+		}
+		if err := checkSize(v); err != nil {
+			return nil, false, err
+		}
+		pct = false
+	}
+}
+
+func (p *parser) parseUnary() (*big.Rat, bool, error) {
+	switch p.peek() {
+	case '+':
+		p.next()
+		return p.parseUnary()
+	case '-':
+		p.next()
+		v, pct, err := p.parseUnary()
+		if err != nil {
+			return nil, false, err
+		}
+		return new(big.Rat).Neg(v), pct, nil
+	}
+	return p.parsePower()
+}
+
+func (p *parser) parsePower() (*big.Rat, bool, error) {
+	base, pct, err := p.parsePostfix()
+	if err != nil {
+		return nil, false, err
+	}
+	if p.peek() != '^' {
+		return base, pct, nil
+	}
+	p.next()
+
+	exp, _, err := p.parseUnary()
+	if err != nil {
+		return nil, false, err
+	}
+	v, err := pow(base, exp)
+	if err != nil {
+		return nil, false, err
+	}
+	return v, false, nil
+}
+
+func (p *parser) parsePostfix() (*big.Rat, bool, error) {
+	v, pct, err := p.parsePrimary()
+	if err != nil {
+		return nil, false, err
+	}
+	for p.peek() == '%' {
+		p.next()
+		v = new(big.Rat).Quo(v, hundred)
+		pct = true
+	}
+	return v, pct, nil
+}
+
+func (p *parser) parsePrimary() (*big.Rat, bool, error) {
+	r := p.peek()
+	if r == '(' {
+		p.next()
+		v, pct, err := p.parseExpr()
+		if err != nil {
+			return nil, false, err
+		}
+		if p.peek() != ')' {
+			return nil, false, p.syntaxError()
+		}
+		p.next()
+		return v, pct, nil
+	}
+	if unicode.IsDigit(r) || r == '.' {
+		v, err := p.parseNumber()
+		return v, false, err
+	}
+	return nil, false, p.syntaxError()
+}
+
+// parseNumber accepts "12", "12.5", ".5" and "1.". A comma is treated as
+// the decimal separator, matching SplitExprAndComment.
+func (p *parser) parseNumber() (*big.Rat, error) {
+	start := p.i
+	digits := new(big.Int)
+	scale := 0
+	seenDigit, seenDot := false, false
+	ten := big.NewInt(10)
+
+	for !p.eof() {
+		r := p.r[p.i]
+		switch {
+		case r >= '0' && r <= '9':
+			digits.Mul(digits, ten)
+			digits.Add(digits, big.NewInt(int64(r-'0')))
+			if seenDot {
+				scale++
+			}
+			seenDigit = true
+		case (r == '.' || r == ',') && !seenDot:
+			seenDot = true
+		default:
+			goto done
+		}
+		p.i++
+		if digits.BitLen() > maxBits {
+			return nil, ErrOverflow
+		}
+	}
+
+done:
+	if !seenDigit {
+		p.i = start
+		return nil, p.syntaxError()
+	}
+	p.skipSpaces()
+
+	denom := new(big.Int).Exp(ten, big.NewInt(int64(scale)), nil)
+	return new(big.Rat).SetFrac(digits, denom), nil
+}
+
+func pow(base, exp *big.Rat) (*big.Rat, error) {
+	if !exp.IsInt() {
+		return nil, ErrFractionalPower
+	}
+	e := exp.Num()
+	if !e.IsInt64() {
+		return nil, ErrOverflow
+	}
+	n := e.Int64()
+	neg := n < 0
+	if neg {
+		n = -n
+	}
+	if n < 0 {
+		// -MinInt64 wraps around to itself.
+		return nil, ErrOverflow
+	}
+
+	if base.Sign() == 0 {
+		if neg {
+			return nil, ErrDivisionByZero
+		}
+		if n == 0 {
+			return big.NewRat(1, 1), nil
+		}
+		return new(big.Rat), nil
+	}
+
+	// |base| != 1 at least doubles or halves per step, so the bit length
+	// grows linearly with n; reject before computing huge powers. The bound
+	// is divided rather than (bits-1)*n multiplied, which could overflow.
+	absNum := new(big.Int).Abs(base.Num())
+	if absNum.Cmp(base.Denom()) != 0 {
+		bits := absNum.BitLen()
+		if d := base.Denom().BitLen(); d > bits {
+			bits = d
+		}
+		if bits > 1 && n > maxBits/int64(bits-1) {
+			return nil, ErrOverflow
+		}
+	}
+
+	num := new(big.Int).Exp(base.Num(), big.NewInt(n), nil)
+	den := new(big.Int).Exp(base.Denom(), big.NewInt(n), nil)
+	v := new(big.Rat).SetFrac(num, den)
+	if neg {
+		v.Inv(v)
+	}
+	return v, checkSize(v)
+}
+
+func checkSize(v *big.Rat) error {
+	if v.Num().BitLen() > maxBits || v.Denom().BitLen() > maxBits {
+		return ErrOverflow
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package exprcalc
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+)
+
+func TestEval(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"1+2*3", "7"},
+		{"(1+2)*3", "9"},
+		{"10/4", "5/2"},
+		{"2^10", "1024"},
+		{"2^-2", "1/4"},
+		{"-2^2", "-4"},
+		{"2^3^2", "512"},
+		{"1,5+1.5", "3"},
+		{"0^0", "1"},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.expr)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.expr, err)
+			continue
+		}
+		want, _ := new(big.Rat).SetString(tt.want)
+		if got.Cmp(want) != 0 {
+			t.Errorf("Eval(%q) = %s, want %s", tt.expr, got.RatString(), tt.want)
+		}
+	}
+}
+
+func TestEvalPercent(t *testing.T) {
+	tests := []struct {
+		expr string
+		want string
+	}{
+		{"10%", "1/10"},
+		{"200+10%", "220"},
+		{"200-10%", "180"},
+		{"200*10%", "20"},
+		{"200/10%", "2000"},
+		{"200+(10%)", "220"},
+		{"50%%", "1/200"},
+		{"200+10%+10%", "242"},
+	}
+	for _, tt := range tests {
+		got, err := Eval(tt.expr)
+		if err != nil {
+			t.Errorf("Eval(%q): %v", tt.expr, err)
+			continue
+		}
+		want, _ := new(big.Rat).SetString(tt.want)
+		if got.Cmp(want) != 0 {
+			t.Errorf("Eval(%q) = %s, want %s", tt.expr, got.RatString(), tt.want)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		want error
+	}{
+		{"", ErrSyntax},
+		{"1+", ErrSyntax},
+		{"(1", ErrSyntax},
+		{"1 2", ErrSyntax},
+		{"abc", ErrSyntax},
+		{"1/0", ErrDivisionByZero},
+		{"1/(2-2)", ErrDivisionByZero},
+		{"0^-1", ErrDivisionByZero},
+		{"2^0.5", ErrFractionalPower},
+		{"9^9^9", ErrOverflow},
+		{"2^99999999999999999999", ErrOverflow},
+		{"(2^4000)^10000000000000000", ErrOverflow},
+		// (bits-1)*n used to wrap around to a negative number here and
+		// let the power through.
+		{"(2^4000)^2400000000000000", ErrOverflow},
+		{"2^-9223372036854775808", ErrOverflow},
+	}
+	for _, tt := range tests {
+		done := make(chan error, 1)
+		go func() {
+			_, err := Eval(tt.expr)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Eval(%q) error = %v, want %v", tt.expr, err, tt.want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Eval(%q) did not return", tt.expr)
+		}
+	}
+}
+
+func TestEvalMoney(t *testing.T) {
+	tests := []struct {
+		expr string
+		want int64
+	}{
+		{"1.005", 101},
+		{"-1.005", -101},
+		{"1/3", 33},
+		{"2/3", 67},
+	}
+	for _, tt := range tests {
+		got, err := EvalMoney(tt.expr)
+		if err != nil {
+			t.Errorf("EvalMoney(%q): %v", tt.expr, err)
+			continue
+		}
+		if int64(got) != tt.want {
+			t.Errorf("EvalMoney(%q) = %d, want %d", tt.expr, got, tt.want)
+		}
+	}
+}
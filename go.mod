@@ -5,3 +5,7 @@ go 1.24.5
 require github.com/OvyFlash/telegram-bot-api v0.0.0-20250903213241-2ddbaeebe9a5
 
 require github.com/mattn/go-sqlite3 v1.14.32
+
+require golang.org/x/text v0.29.0
+
+require golang.org/x/image v0.25.0
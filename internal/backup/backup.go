@@ -0,0 +1,255 @@
+// Package backup defines the JSON backup of a chat's books and checks that
+// a backup is complete and consistent before it is restored.
+//
+// Ids in a backup are those of the source database and only link records
+// within the file; a restore assigns new ones. Money is in minor units, as
+// stored, and times are unix seconds as strings, also as stored. Tags are
+// not listed: they are parsed again from the notes.
+package backup
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+const (
+	// Format marks a file as a backup of this bot.
+	Format = "ledgerbot-backup"
+	// Version is the version of the layout written by Encode. Decode
+	// accepts this version and older ones.
+	Version = 1
+)
+
+type File struct {
+	Format  string `json:"format"`
+	Version int    `json:"version"`
+	// Schema is the database migration the backup was made at, for
+	// reference only.
+	Schema       int           `json:"schema"`
+	ChatID       int64         `json:"chat_id"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Accounts     []Account     `json:"accounts"`
+	Transactions []Transaction `json:"transactions"`
+	Aliases      []Alias       `json:"aliases"`
+	Rates        []Rate        `json:"rates"`
+	Members      []Member      `json:"members"`
+	Imports      []Import      `json:"imports"`
+}
+
+type Account struct {
+	ID        int         `json:"id"`
+	Name      string      `json:"name"`
+	Currency  string      `json:"currency,omitempty"`
+	Balance   model.Money `json:"balance"`
+	CreatedAt string      `json:"created_at"`
+	// ArchivedAt is set for accounts in the archive.
+	ArchivedAt int64 `json:"archived_at,omitempty"`
+}
+
+type Transaction struct {
+	ID          int         `json:"id"`
+	AccountID   int         `json:"account_id"`
+	Amount      model.Money `json:"amount"`
+	Balance     model.Money `json:"balance"`
+	Expression  string      `json:"expression"`
+	Note        string      `json:"note,omitempty"`
+	CreatedAt   string      `json:"created_at"`
+	CreatedBy   int64       `json:"created_by,omitempty"`
+	TransferID  int         `json:"transfer_id,omitempty"`
+	ReversesID  int         `json:"reverses_id,omitempty"`
+	Reverted    bool        `json:"reverted,omitempty"`
+	SourceMsgID int         `json:"source_msg_id,omitempty"`
+	ReplyMsgID  int         `json:"reply_msg_id,omitempty"`
+	Rate        string      `json:"rate,omitempty"`
+	ImportID    int         `json:"import_id,omitempty"`
+}
+
+type Alias struct {
+	Alias     string `json:"alias"`
+	AccountID int    `json:"account_id"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Rate struct {
+	Base      string `json:"base"`
+	Quote     string `json:"quote"`
+	Rate      string `json:"rate"`
+	ValidFrom string `json:"valid_from"`
+	CreatedBy int64  `json:"created_by,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+type Member struct {
+	UserID    int64  `json:"user_id"`
+	Name      string `json:"name,omitempty"`
+	Role      string `json:"role"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+type Import struct {
+	ID          int    `json:"id"`
+	AccountID   int    `json:"account_id"`
+	SourceMsgID int    `json:"source_msg_id"`
+	FileName    string `json:"file_name,omitempty"`
+	Rows        int    `json:"rows"`
+	CreatedBy   int64  `json:"created_by,omitempty"`
+	CreatedAt   string `json:"created_at"`
+	Reverted    bool   `json:"reverted,omitempty"`
+}
+
+// ErrNotBackup is returned for JSON that is not a backup of this bot.
+var ErrNotBackup = errors.New("это не файл резервной копии")
+
+// Encode writes f as compact JSON, which keeps large books under the
+// upload limit of a restore.
+func Encode(w io.Writer, f *File) error {
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(f); err != nil {
+		return fmt.Errorf("encode backup: %w", err)
+	}
+	return nil
+}
+
+// Decode reads a backup and validates it.
+func Decode(data []byte) (*File, error) {
+	var f File
+	if err := json.Unmarshal(bytes.TrimPrefix(data, []byte("\ufeff")), &f); err != nil {
+		if f.Format != Format {
+			return nil, ErrNotBackup
+		}
+		return nil, fmt.Errorf("поврежденный файл: %v", err)
+	}
+	if f.Format != Format {
+		return nil, ErrNotBackup
+	}
+	if f.Version < 1 || f.Version > Version {
+		return nil, fmt.Errorf("версия копии %d не поддерживается, обновите бота", f.Version)
+	}
+	if err := f.Validate(); err != nil {
+		return nil, err
+	}
+	return &f, nil
+}
+
+// Validate checks that every reference in f resolves, that names and
+// aliases are unique as the bot compares them and that the balance of
+// every account is the sum of its transactions. Transactions must be
+// listed in the order they were made.
+func (f *File) Validate() error {
+	if len(f.Accounts) == 0 {
+		return fmt.Errorf("в копии нет счетов")
+	}
+
+	accounts := make(map[int]*Account, len(f.Accounts))
+	// names maps account names, normalized as the bot resolves them, to
+	// their ids.
+	names := make(map[string]int, len(f.Accounts))
+	for i := range f.Accounts {
+		a := &f.Accounts[i]
+		key := model.NormalizeName(a.Name)
+		switch {
+		case a.ID <= 0 || accounts[a.ID] != nil:
+			return fmt.Errorf("счет %q: неверный id %d", a.Name, a.ID)
+		case key == "":
+			return fmt.Errorf("счет %d: нет имени", a.ID)
+		case names[key] != 0:
+			return fmt.Errorf("счет %q указан дважды", a.Name)
+		}
+		if a.Currency != "" {
+			if c, err := model.NormalizeCurrency(a.Currency); err != nil || c != a.Currency {
+				return fmt.Errorf("счет %q: неверная валюта %q", a.Name, a.Currency)
+			}
+		}
+		accounts[a.ID] = a
+		names[key] = a.ID
+	}
+
+	imports := make(map[int]bool, len(f.Imports))
+	for _, im := range f.Imports {
+		if im.ID <= 0 || imports[im.ID] {
+			return fmt.Errorf("импорт: неверный id %d", im.ID)
+		}
+		if accounts[im.AccountID] == nil {
+			return fmt.Errorf("импорт %d: нет счета %d", im.ID, im.AccountID)
+		}
+		imports[im.ID] = true
+	}
+
+	txns := make(map[int]bool, len(f.Transactions))
+	sums := make(map[int]model.Money, len(f.Accounts))
+	last := 0
+	for _, t := range f.Transactions {
+		switch {
+		case t.ID <= last:
+			return fmt.Errorf("операция %d: id должны идти по возрастанию", t.ID)
+		case accounts[t.AccountID] == nil:
+			return fmt.Errorf("операция %d: нет счета %d", t.ID, t.AccountID)
+		case t.ReversesID != 0 && !txns[t.ReversesID]:
+			return fmt.Errorf("операция %d: отменяет неизвестную операцию %d", t.ID, t.ReversesID)
+		case t.ImportID != 0 && !imports[t.ImportID]:
+			return fmt.Errorf("операция %d: нет импорта %d", t.ID, t.ImportID)
+		case t.Rate != "" && !positiveRat(t.Rate):
+			return fmt.Errorf("операция %d: неверный курс %q", t.ID, t.Rate)
+		}
+		last = t.ID
+		txns[t.ID] = true
+		sums[t.AccountID] += t.Amount
+	}
+	// A transfer is linked by the id of one of its legs, which may come
+	// after the leg that refers to it.
+	for _, t := range f.Transactions {
+		if t.TransferID != 0 && !txns[t.TransferID] {
+			return fmt.Errorf("операция %d: нет перевода %d", t.ID, t.TransferID)
+		}
+	}
+	for _, a := range f.Accounts {
+		if sums[a.ID] != a.Balance {
+			return fmt.Errorf("счет %q: баланс %s не равен сумме операций %s", a.Name, a.Balance, sums[a.ID])
+		}
+	}
+
+	aliases := make(map[string]bool, len(f.Aliases))
+	for _, al := range f.Aliases {
+		key := model.NormalizeName(al.Alias)
+		switch {
+		case key == "":
+			return fmt.Errorf("пустой псевдоним")
+		case aliases[key]:
+			return fmt.Errorf("псевдоним %q указан дважды", al.Alias)
+		case accounts[al.AccountID] == nil:
+			return fmt.Errorf("псевдоним %q: нет счета %d", al.Alias, al.AccountID)
+		case names[key] != 0 && names[key] != al.AccountID:
+			return fmt.Errorf("псевдоним %q совпадает с именем другого счета", al.Alias)
+		}
+		aliases[key] = true
+	}
+
+	for _, r := range f.Rates {
+		base, err1 := model.NormalizeCurrency(r.Base)
+		quote, err2 := model.NormalizeCurrency(r.Quote)
+		if err1 != nil || err2 != nil || base != r.Base || quote != r.Quote || !positiveRat(r.Rate) {
+			return fmt.Errorf("неверный курс %s/%s %q", r.Base, r.Quote, r.Rate)
+		}
+	}
+
+	members := make(map[int64]bool, len(f.Members))
+	for _, m := range f.Members {
+		if _, ok := model.ParseRole(m.Role); !ok || m.UserID == 0 || members[m.UserID] {
+			return fmt.Errorf("участник %d: неверная роль %q", m.UserID, m.Role)
+		}
+		members[m.UserID] = true
+	}
+	return nil
+}
+
+func positiveRat(s string) bool {
+	r, ok := new(big.Rat).SetString(s)
+	return ok && r.Sign() > 0
+}
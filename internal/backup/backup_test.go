@@ -0,0 +1,130 @@
+package backup
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validFile is a small consistent backup: a transfer between two accounts,
+// an undone entry with its reversal and an imported row.
+func validFile() *File {
+	return &File{
+		Format:    Format,
+		Version:   Version,
+		Schema:    14,
+		ChatID:    1,
+		CreatedAt: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+		Accounts: []Account{
+			{ID: 1, Name: "Наличные", Balance: 700, CreatedAt: "1700000000"},
+			{ID: 2, Name: "Карта", Currency: "USD", Balance: 300, CreatedAt: "1700000000", ArchivedAt: 1709000000},
+		},
+		Transactions: []Transaction{
+			{ID: 1, AccountID: 1, Amount: 1000, Balance: 1000, Expression: "10", CreatedAt: "1700000100"},
+			{ID: 2, AccountID: 1, Amount: -300, Balance: 700, Expression: "-3", CreatedAt: "1700000200", TransferID: 2},
+			{ID: 3, AccountID: 2, Amount: 300, Balance: 300, Expression: "3", CreatedAt: "1700000200", TransferID: 2, Rate: "1/90"},
+			{ID: 4, AccountID: 1, Amount: 50, Balance: 750, Expression: "0.5", CreatedAt: "1700000300", Reverted: true, ImportID: 1},
+			{ID: 5, AccountID: 1, Amount: -50, Balance: 700, Expression: "-0.5", CreatedAt: "1700000400", ReversesID: 4},
+		},
+		Aliases: []Alias{
+			{Alias: "нал", AccountID: 1, CreatedAt: "1700000000"},
+			{Alias: "наличные", AccountID: 1, CreatedAt: "1700000000"},
+		},
+		Rates:   []Rate{{Base: "USD", Quote: "RUB", Rate: "90", ValidFrom: "1700000000", CreatedAt: "1700000000"}},
+		Members: []Member{{UserID: 42, Role: "owner", UpdatedAt: "1700000000"}},
+		Imports: []Import{{ID: 1, AccountID: 1, SourceMsgID: 10, Rows: 1, CreatedAt: "1700000300"}},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := validFile().Validate(); err != nil {
+		t.Fatalf("valid file: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		spoil func(f *File)
+		want  string
+	}{
+		{"no accounts", func(f *File) { f.Accounts = nil }, "нет счетов"},
+		{"duplicate account id", func(f *File) { f.Accounts[1].ID = 1 }, "неверный id"},
+		{"duplicate name", func(f *File) { f.Accounts[1].Name = "Наличные" }, "указан дважды"},
+		{"same name in another case", func(f *File) { f.Accounts[1].Name = " НАЛИЧНЫЕ" }, "указан дважды"},
+		{"blank name", func(f *File) { f.Accounts[1].Name = "  " }, "нет имени"},
+		{"bad currency", func(f *File) { f.Accounts[1].Currency = "usd" }, "неверная валюта"},
+		{"txn of unknown account", func(f *File) { f.Transactions[0].AccountID = 9 }, "нет счета 9"},
+		{"txn ids out of order", func(f *File) { f.Transactions[1].ID = 1 }, "по возрастанию"},
+		{"reversal of a later txn", func(f *File) { f.Transactions[4].ReversesID = 6 }, "неизвестную операцию 6"},
+		{"unknown transfer", func(f *File) { f.Transactions[2].TransferID = 7 }, "нет перевода 7"},
+		{"unknown import", func(f *File) { f.Transactions[3].ImportID = 2 }, "нет импорта 2"},
+		{"import of unknown account", func(f *File) { f.Imports[0].AccountID = 3 }, "нет счета 3"},
+		{"bad txn rate", func(f *File) { f.Transactions[2].Rate = "-1" }, "неверный курс"},
+		{"balance off by a cent", func(f *File) { f.Accounts[0].Balance = 701 }, "не равен сумме"},
+		{"balance of a lost txn", func(f *File) { f.Transactions = f.Transactions[:4] }, "не равен сумме"},
+		{"alias of unknown account", func(f *File) { f.Aliases[0].AccountID = 5 }, "нет счета 5"},
+		{"duplicate alias", func(f *File) { f.Aliases[1].Alias = "НАЛ" }, "указан дважды"},
+		{"alias naming another account", func(f *File) { f.Aliases[0].Alias = "карта" }, "другого счета"},
+		{"empty alias", func(f *File) { f.Aliases[0].Alias = " " }, "пустой"},
+		{"bad rate", func(f *File) { f.Rates[0].Rate = "0" }, "неверный курс"},
+		{"bad role", func(f *File) { f.Members[0].Role = "admin" }, "неверная роль"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := validFile()
+			tt.spoil(f)
+			err := f.Validate()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate() = %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Encode(&buf, validFile()); err != nil {
+		t.Fatal(err)
+	}
+	f, err := Decode(append([]byte("\ufeff"), buf.Bytes()...))
+	if err != nil {
+		t.Fatalf("Decode: %v", err)
+	}
+	if len(f.Accounts) != 2 || len(f.Transactions) != 5 || f.Transactions[2].Rate != "1/90" || !f.CreatedAt.Equal(validFile().CreatedAt) {
+		t.Errorf("decoded %+v", f)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	newer := validFile()
+	newer.Version = Version + 1
+	var buf bytes.Buffer
+	if err := Encode(&buf, newer); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not json", "date;amount\n", ErrNotBackup.Error()},
+		{"other json", `{"accounts": []}`, ErrNotBackup.Error()},
+		{"truncated", `{"format":"ledgerbot-backup","version":1,"accounts":[`, ErrNotBackup.Error()},
+		{"wrong types", `{"format":"ledgerbot-backup","version":1,"accounts":"all"}`, "поврежденный"},
+		{"newer version", buf.String(), "не поддерживается"},
+		{"invalid", `{"format":"ledgerbot-backup","version":1}`, "нет счетов"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decode([]byte(tt.data))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decode() = %v, want an error with %q", err, tt.want)
+			}
+		})
+	}
+	if _, err := Decode([]byte(`[1, 2]`)); !errors.Is(err, ErrNotBackup) {
+		t.Errorf("Decode of an array = %v, want ErrNotBackup", err)
+	}
+}
@@ -0,0 +1,386 @@
+// Package chart draws the PNG charts the bot sends: a balance line over
+// time and horizontal bars. Rendering is pure Go with the embedded Go
+// fonts and no randomness, so the same input always gives the same pixels.
+package chart
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	width  = 800
+	height = 450
+
+	marginLeft   = 80
+	marginRight  = 24
+	marginTop    = 44
+	marginBottom = 40
+
+	barHeight = 24
+	barGap    = 8
+	// MaxBars caps a bar chart; callers should fold the rest.
+	MaxBars = 15
+)
+
+var (
+	background = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	ink        = color.RGBA{0x22, 0x22, 0x22, 0xff}
+	grid       = color.RGBA{0xe3, 0xe3, 0xe3, 0xff}
+	axis       = color.RGBA{0x88, 0x88, 0x88, 0xff}
+
+	palette = []color.RGBA{
+		{0x1f, 0x77, 0xb4, 0xff},
+		{0xd6, 0x27, 0x28, 0xff},
+		{0x2c, 0xa0, 0x2c, 0xff},
+		{0xff, 0x7f, 0x0e, 0xff},
+		{0x94, 0x67, 0xbd, 0xff},
+		{0x8c, 0x56, 0x4b, 0xff},
+		{0xe3, 0x77, 0xc2, 0xff},
+		{0x17, 0xbe, 0xcf, 0xff},
+	}
+)
+
+// Point is a value from time T on, until the next point.
+type Point struct {
+	T time.Time
+	V float64
+}
+
+// Series is a named step line. Points must be in time order.
+type Series struct {
+	Name   string
+	Points []Point
+}
+
+// Bar is one labelled value of a bar chart.
+type Bar struct {
+	Label string
+	Value float64
+	// Text is printed next to the bar; the value is used when empty.
+	Text string
+}
+
+var (
+	faceOnce sync.Once
+	faces    struct {
+		regular, title font.Face
+	}
+	faceErr error
+)
+
+func loadFaces() error {
+	faceOnce.Do(func() {
+		f, err := opentype.Parse(goregular.TTF)
+		if err != nil {
+			faceErr = fmt.Errorf("parse font: %w", err)
+			return
+		}
+		newFace := func(size float64) font.Face {
+			face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: 72, Hinting: font.HintingFull})
+			if err != nil && faceErr == nil {
+				faceErr = fmt.Errorf("font face: %w", err)
+			}
+			return face
+		}
+		faces.regular = newFace(12)
+		faces.title = newFace(16)
+	})
+	return faceErr
+}
+
+// Line draws the series as step lines sharing one time and value axis,
+// with a legend when there is more than one. end extends every line to
+// that time; a zero end stops at the last point.
+func Line(title string, series []Series, end time.Time) (*image.RGBA, error) {
+	if err := loadFaces(); err != nil {
+		return nil, err
+	}
+	img := canvas(width, height)
+	drawText(img, faces.title, title, marginLeft, 26, ink)
+
+	var (
+		tMin, tMax = time.Time{}, end
+		vMin, vMax = math.Inf(1), math.Inf(-1)
+	)
+	for _, s := range series {
+		for _, p := range s.Points {
+			if tMin.IsZero() || p.T.Before(tMin) {
+				tMin = p.T
+			}
+			if p.T.After(tMax) {
+				tMax = p.T
+			}
+			vMin, vMax = math.Min(vMin, p.V), math.Max(vMax, p.V)
+		}
+	}
+	if math.IsInf(vMin, 0) {
+		drawText(img, faces.regular, "нет данных", width/2-30, height/2, axis)
+		return img, nil
+	}
+	if !tMax.After(tMin) {
+		tMin, tMax = tMin.Add(-12*time.Hour), tMin.Add(12*time.Hour)
+	}
+	ticks, step := niceTicks(vMin, vMax, 5)
+	vMin, vMax = ticks[0], ticks[len(ticks)-1]
+
+	plot := image.Rect(marginLeft, marginTop, width-marginRight, height-marginBottom)
+	x := func(t time.Time) int {
+		f := float64(t.Sub(tMin)) / float64(tMax.Sub(tMin))
+		return plot.Min.X + int(math.Round(f*float64(plot.Dx())))
+	}
+	y := func(v float64) int {
+		f := (v - vMin) / (vMax - vMin)
+		return plot.Max.Y - int(math.Round(f*float64(plot.Dy())))
+	}
+
+	for _, v := range ticks {
+		yy := y(v)
+		hline(img, plot.Min.X, plot.Max.X, yy, grid)
+		label := formatValue(v, step)
+		w := textWidth(faces.regular, label)
+		drawText(img, faces.regular, label, plot.Min.X-8-w, yy+4, ink)
+	}
+	if vMin < 0 && vMax > 0 {
+		hline(img, plot.Min.X, plot.Max.X, y(0), axis)
+	}
+	vline(img, plot.Min.X, plot.Min.Y, plot.Max.Y, axis)
+	hline(img, plot.Min.X, plot.Max.X, plot.Max.Y, axis)
+
+	layout := "02.01"
+	switch span := tMax.Sub(tMin); {
+	case span > 300*24*time.Hour:
+		layout = "02.01.06"
+	case span < 4*24*time.Hour:
+		// Ticks are less than a day apart.
+		layout = "02.01 15:04"
+	}
+	for i := 0; i <= 4; i++ {
+		t := tMin.Add(time.Duration(float64(tMax.Sub(tMin)) * float64(i) / 4))
+		label := t.Format(layout)
+		xx := x(t)
+		vline(img, xx, plot.Max.Y, plot.Max.Y+4, axis)
+		w := textWidth(faces.regular, label)
+		drawText(img, faces.regular, label, min(xx-w/2, width-4-w), plot.Max.Y+18, ink)
+	}
+
+	for i, s := range series {
+		c := palette[i%len(palette)]
+		for j, p := range s.Points {
+			next := end
+			if j+1 < len(s.Points) {
+				next = s.Points[j+1].T
+			}
+			if next.IsZero() || next.Before(p.T) {
+				next = p.T
+			}
+			thickLine(img, x(p.T), y(p.V), x(next), y(p.V), c)
+			if j+1 < len(s.Points) {
+				thickLine(img, x(next), y(p.V), x(next), y(s.Points[j+1].V), c)
+			}
+		}
+	}
+
+	if len(series) > 1 {
+		lx, ly := plot.Max.X-150, plot.Min.Y+4
+		for i, s := range series {
+			c := palette[i%len(palette)]
+			draw.Draw(img, image.Rect(lx, ly, lx+10, ly+10), image.NewUniform(c), image.Point{}, draw.Src)
+			drawText(img, faces.regular, s.Name, lx+16, ly+10, ink)
+			ly += 16
+		}
+	}
+	return img, nil
+}
+
+// Bars draws horizontal bars from a shared zero, largest magnitude setting
+// the scale. Only the first MaxBars bars are drawn.
+func Bars(title string, bars []Bar) (*image.RGBA, error) {
+	if err := loadFaces(); err != nil {
+		return nil, err
+	}
+	if len(bars) > MaxBars {
+		bars = bars[:MaxBars]
+	}
+	h := max(160, marginTop+len(bars)*(barHeight+barGap)+marginBottom)
+	img := canvas(width, h)
+	drawText(img, faces.title, title, 16, 26, ink)
+	if len(bars) == 0 {
+		drawText(img, faces.regular, "нет данных", width/2-30, h/2, axis)
+		return img, nil
+	}
+
+	labelW := 0
+	for _, b := range bars {
+		labelW = max(labelW, textWidth(faces.regular, b.Label))
+	}
+	labelW = min(labelW, width/3)
+
+	var top float64
+	for _, b := range bars {
+		top = math.Max(top, math.Abs(b.Value))
+	}
+	if top == 0 {
+		top = 1
+	}
+
+	left := 16 + labelW + 8
+	// Leave room for the value text after the longest bar.
+	span := width - marginRight - left - 110
+	for i, b := range bars {
+		yy := marginTop + i*(barHeight+barGap)
+		drawText(img, faces.regular, b.Label, 16, yy+barHeight/2+4, ink)
+
+		w := int(math.Round(math.Abs(b.Value) / top * float64(span)))
+		c := palette[i%len(palette)]
+		draw.Draw(img, image.Rect(left, yy, left+max(w, 1), yy+barHeight), image.NewUniform(c), image.Point{}, draw.Src)
+
+		text := b.Text
+		if text == "" {
+			text = formatValue(b.Value, 0.01)
+		}
+		drawText(img, faces.regular, text, left+w+6, yy+barHeight/2+4, ink)
+	}
+	vline(img, left, marginTop-4, marginTop+len(bars)*(barHeight+barGap)-barGap+4, axis)
+	return img, nil
+}
+
+// Encode writes img as PNG.
+func Encode(w io.Writer, img image.Image) error {
+	return png.Encode(w, img)
+}
+
+func canvas(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(background), image.Point{}, draw.Src)
+	return img
+}
+
+func drawText(img *image.RGBA, face font.Face, s string, x, y int, c color.Color) {
+	d := font.Drawer{Dst: img, Src: image.NewUniform(c), Face: face, Dot: fixed.P(x, y)}
+	d.DrawString(s)
+}
+
+func textWidth(face font.Face, s string) int {
+	return font.MeasureString(face, s).Round()
+}
+
+func hline(img *image.RGBA, x0, x1, y int, c color.Color) {
+	for x := x0; x <= x1; x++ {
+		img.Set(x, y, c)
+	}
+}
+
+func vline(img *image.RGBA, x, y0, y1 int, c color.Color) {
+	for y := y0; y <= y1; y++ {
+		img.Set(x, y, c)
+	}
+}
+
+// thickLine draws a two pixel wide line with Bresenham's algorithm.
+func thickLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := sign(x1-x0), sign(y1-y0)
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		img.Set(x0+1, y0, c)
+		img.Set(x0, y0+1, c)
+		img.Set(x0+1, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		if e2 := 2 * e; e2 >= dy {
+			e += dy
+			x0 += sx
+		} else {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// niceTicks spreads about n round values over [lo, hi]: steps are 1, 2 or
+// 5 times a power of ten and the ends are rounded outwards.
+func niceTicks(lo, hi float64, n int) ([]float64, float64) {
+	if lo == hi {
+		pad := math.Max(math.Abs(lo)*0.1, 1)
+		lo, hi = lo-pad, hi+pad
+	}
+	raw := (hi - lo) / float64(n)
+	mag := math.Pow(10, math.Floor(math.Log10(raw)))
+	step := 10 * mag
+	for _, m := range []float64{1, 2, 5} {
+		if m*mag >= raw {
+			step = m * mag
+			break
+		}
+	}
+	start := math.Floor(lo/step) * step
+	var ticks []float64
+	for v := start; ; v += step {
+		t := math.Round(v/step) * step
+		ticks = append(ticks, t)
+		if t >= hi {
+			return ticks, step
+		}
+	}
+}
+
+// formatValue prints v with thousands separated like the bot's tables and
+// as many decimals as step needs, at most two.
+func formatValue(v, step float64) string {
+	decimals := 0
+	if step < 1 {
+		decimals = min(2, int(math.Ceil(-math.Log10(step))))
+	}
+	s := strconv.FormatFloat(math.Abs(v), 'f', decimals, 64)
+	intPart, frac, _ := strings.Cut(s, ".")
+
+	var b strings.Builder
+	if v < 0 && math.Abs(v) >= math.Pow(10, -float64(decimals))/2 {
+		b.WriteByte('-')
+	}
+	for i, r := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			b.WriteRune('’')
+		}
+		b.WriteRune(r)
+	}
+	if frac != "" {
+		b.WriteByte('.')
+		b.WriteString(frac)
+	}
+	return b.String()
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func sign(v int) int {
+	switch {
+	case v < 0:
+		return -1
+	case v > 0:
+		return 1
+	}
+	return 0
+}
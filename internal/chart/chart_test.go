@@ -0,0 +1,137 @@
+package chart
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden images in testdata")
+
+var day0 = time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+
+func day(n int) time.Time { return day0.AddDate(0, 0, n) }
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		name   string
+		series []Series
+		end    time.Time
+	}{
+		{
+			name: "line_single",
+			series: []Series{{Name: "cash", Points: []Point{
+				{day(0), 100}, {day(3), 250.5}, {day(7), -40}, {day(12), 80},
+			}}},
+			end: day(14),
+		},
+		{
+			name: "line_multiple",
+			series: []Series{
+				{Name: "cash", Points: []Point{{day(0), 100}, {day(5), 300}, {day(9), 150}}},
+				{Name: "card", Points: []Point{{day(2), 1200}, {day(6), 900}}},
+				{Name: "usd", Points: []Point{{day(1), -50}, {day(8), 20}}},
+			},
+			end: day(10),
+		},
+		{
+			name:   "line_flat",
+			series: []Series{{Name: "cash", Points: []Point{{day(1), 500}, {day(4), 500}, {day(6), 500}}}},
+			end:    day(8),
+		},
+		{
+			name:   "line_one_point",
+			series: []Series{{Name: "cash", Points: []Point{{day(4).Add(9 * time.Hour), 500}}}},
+		},
+		{
+			name:   "line_empty",
+			series: []Series{{Name: "cash"}},
+			end:    day(10),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Line("Баланс", tt.series, tt.end)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.name, img)
+		})
+	}
+}
+
+func TestBars(t *testing.T) {
+	many := make([]Bar, MaxBars+5)
+	for i := range many {
+		many[i] = Bar{Label: fmt.Sprintf("#тег%d", i+1), Value: float64(1000 - i*60)}
+	}
+	tests := []struct {
+		name string
+		bars []Bar
+	}{
+		{name: "bars_over_max", bars: many},
+		{name: "bars_zero", bars: []Bar{
+			{Label: "еда", Value: 1520.25},
+			{Label: "такси", Value: 0},
+			{Label: "возврат", Value: -300, Text: "−300.00 RUB"},
+		}},
+		{name: "bars_all_zero", bars: []Bar{{Label: "еда", Value: 0}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := Bars("Расходы по тегам", tt.bars)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden(t, tt.name, img)
+		})
+	}
+}
+
+// golden compares img with testdata/<name>.png pixel by pixel, or rewrites
+// the file when the test runs with -update.
+func golden(t *testing.T, name string, img *image.RGBA) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".png")
+	if *update {
+		var buf bytes.Buffer
+		if err := Encode(&buf, img); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -update to create it", err)
+	}
+	defer f.Close()
+	decoded, err := png.Decode(f)
+	if err != nil {
+		t.Fatalf("decode %s: %v", path, err)
+	}
+	want := image.NewRGBA(decoded.Bounds())
+	draw.Draw(want, want.Bounds(), decoded, decoded.Bounds().Min, draw.Src)
+
+	if img.Bounds() != want.Bounds() {
+		t.Fatalf("size %v, golden %v", img.Bounds(), want.Bounds())
+	}
+	if !bytes.Equal(img.Pix, want.Pix) {
+		out := filepath.Join(t.TempDir(), name+".png")
+		var buf bytes.Buffer
+		if err := Encode(&buf, img); err == nil {
+			_ = os.WriteFile(out, buf.Bytes(), 0o644)
+		}
+		t.Errorf("image differs from %s, got %s; run go test -update if the change is intended", path, out)
+	}
+}
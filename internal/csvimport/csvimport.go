@@ -0,0 +1,377 @@
+// Package csvimport reads transaction history from spreadsheet CSV exports.
+//
+// The delimiter, the decimal separator and a header row are detected.
+// Columns are taken from the header by their usual names, from an explicit
+// mapping such as "date=1 amount=3 note=Описание", or else in the order
+// date, amount, note, author.
+package csvimport
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// MaxRows caps the rows of one file.
+const MaxRows = 10000
+
+// Field is a column role.
+type Field int
+
+const (
+	Date Field = iota
+	Amount
+	Note
+	Author
+	numFields
+)
+
+var fieldNames = [numFields]string{"дата", "сумма", "комментарий", "автор"}
+
+func (f Field) String() string { return fieldNames[f] }
+
+// synonyms are the header names and mapping keys of each field, compared
+// after lowercasing and dropping spaces, dashes and underscores.
+var synonyms = [numFields][]string{
+	Date:   {"date", "дата", "createdat", "time", "datetime", "время", "датавремя", "датаоперации"},
+	Amount: {"amount", "сумма", "sum", "eval", "value", "значение", "суммаоперации"},
+	Note:   {"note", "comment", "комментарий", "описание", "description", "memo", "примечание", "заметка", "назначение"},
+	Author: {"author", "автор", "user", "userid", "пользователь", "кто"},
+}
+
+// Mapping holds the 0-based column of each field, -1 when absent.
+type Mapping [numFields]int
+
+// Row is one transaction read from the file.
+type Row struct {
+	// Line is the 1-based record number in the file.
+	Line   int
+	Time   time.Time
+	Amount model.Money
+	Note   string
+	Author string
+}
+
+// File is a parsed import, with rows in time order.
+type File struct {
+	Delimiter rune
+	Decimal   byte
+	Header    bool
+	Mapping   Mapping
+	Rows      []Row
+}
+
+// LineError reports the record a file could not be read at.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string { return fmt.Sprintf("строка %d: %v", e.Line, e.Err) }
+
+func (e *LineError) Unwrap() error { return e.Err }
+
+var ErrNoRows = errors.New("в файле нет операций")
+
+// Parse reads data using the column mapping spec, which may be empty.
+// Times without a zone are in loc.
+func Parse(data []byte, spec string, loc *time.Location) (*File, error) {
+	data = bytes.TrimPrefix(data, []byte("\ufeff"))
+	f := &File{Delimiter: DetectDelimiter(data)}
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.Comma = f.Delimiter
+	r.FieldsPerRecord = -1
+	r.LazyQuotes = true
+	records, err := r.ReadAll()
+	if err != nil {
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			return nil, &LineError{Line: pe.Line, Err: pe.Err}
+		}
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, ErrNoRows
+	}
+
+	header, hasHeader := headerMapping(records[0])
+	m, err := parseSpec(spec, records[0], hasHeader)
+	if err != nil {
+		return nil, err
+	}
+	for i := range m {
+		if m[i] < 0 && hasHeader {
+			m[i] = header[i]
+		}
+	}
+	if !hasHeader && m == (Mapping{-1, -1, -1, -1}) {
+		for i := range m {
+			if i < len(records[0]) {
+				m[i] = i
+			} else {
+				m[i] = -1
+			}
+		}
+	}
+	if m[Date] < 0 || m[Amount] < 0 {
+		return nil, fmt.Errorf("не найдены колонки с датой и суммой, укажите их: date=1 amount=2")
+	}
+	f.Mapping = m
+
+	body := records
+	if hasHeader {
+		body, f.Header = records[1:], true
+	}
+	// A header the detection missed still fails to parse as an amount.
+	if !hasHeader && len(body) > 1 {
+		if _, err := parseAmount(cell(body[0], m[Amount]), '.'); err != nil {
+			if _, err := parseAmount(cell(body[0], m[Amount]), ','); err != nil {
+				body, f.Header = body[1:], true
+			}
+		}
+	}
+
+	amounts := make([]string, 0, len(body))
+	for _, rec := range body {
+		amounts = append(amounts, cell(rec, m[Amount]))
+	}
+	f.Decimal = detectDecimal(amounts, f.Delimiter)
+
+	first := 1
+	if f.Header {
+		first = 2
+	}
+	for i, rec := range body {
+		line := first + i
+		if blank(rec) {
+			continue
+		}
+		if len(f.Rows) == MaxRows {
+			return nil, fmt.Errorf("больше %d строк, разбейте файл на части", MaxRows)
+		}
+		row := Row{Line: line, Note: cell(rec, m[Note]), Author: cell(rec, m[Author])}
+		if row.Time, err = parseTime(cell(rec, m[Date]), loc); err != nil {
+			return nil, &LineError{Line: line, Err: err}
+		}
+		if row.Amount, err = parseAmount(cell(rec, m[Amount]), f.Decimal); err != nil {
+			return nil, &LineError{Line: line, Err: err}
+		}
+		if row.Amount == 0 {
+			return nil, &LineError{Line: line, Err: fmt.Errorf("нулевая сумма")}
+		}
+		f.Rows = append(f.Rows, row)
+	}
+	if len(f.Rows) == 0 {
+		return nil, ErrNoRows
+	}
+
+	sort.SliceStable(f.Rows, func(a, b int) bool { return f.Rows[a].Time.Before(f.Rows[b].Time) })
+	return f, nil
+}
+
+// MappingText describes the mapping as "дата=1, сумма=3".
+func (f *File) MappingText() string {
+	var parts []string
+	for i, col := range f.Mapping {
+		if col >= 0 {
+			parts = append(parts, fmt.Sprintf("%s=%d", Field(i), col+1))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+func key(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || r == '_' || r == '-' {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, s)
+}
+
+func fieldByName(name string) (Field, bool) {
+	k := key(name)
+	for f, names := range synonyms {
+		for _, n := range names {
+			if k == n {
+				return Field(f), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// headerMapping recognizes a header row by its column names.
+func headerMapping(rec []string) (Mapping, bool) {
+	m := Mapping{-1, -1, -1, -1}
+	found := false
+	for i, name := range rec {
+		if f, ok := fieldByName(name); ok && m[f] < 0 {
+			m[f] = i
+			found = true
+		}
+	}
+	return m, found
+}
+
+// parseSpec reads "field=column" pairs, where column is a 1-based number
+// or, with a header, a column name.
+func parseSpec(spec string, header []string, hasHeader bool) (Mapping, error) {
+	m := Mapping{-1, -1, -1, -1}
+	for _, pair := range strings.Fields(spec) {
+		name, col, ok := strings.Cut(pair, "=")
+		f, known := fieldByName(name)
+		if !ok || !known {
+			return m, fmt.Errorf("непонятная колонка %q, используйте date=, amount=, note=, author=", pair)
+		}
+		if n, err := strconv.Atoi(col); err == nil && n >= 1 {
+			m[f] = n - 1
+			continue
+		}
+		idx := -1
+		if hasHeader {
+			for i, h := range header {
+				if key(h) == key(col) {
+					idx = i
+					break
+				}
+			}
+		}
+		if idx < 0 {
+			return m, fmt.Errorf("нет колонки %q", col)
+		}
+		m[f] = idx
+	}
+	return m, nil
+}
+
+func cell(rec []string, i int) string {
+	if i < 0 || i >= len(rec) {
+		return ""
+	}
+	return strings.TrimSpace(rec[i])
+}
+
+func blank(rec []string) bool {
+	for _, c := range rec {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// DetectDelimiter picks the most frequent of ; tab and , in the first line
+// of a CSV file.
+func DetectDelimiter(data []byte) rune {
+	line, _, _ := bytes.Cut(data, []byte("\n"))
+	best, bestN := ',', 0
+	for _, c := range []rune{';', '\t', ','} {
+		if n := bytes.Count(line, []byte(string(c))); n > bestN {
+			best, bestN = c, n
+		}
+	}
+	return best
+}
+
+// cleanAmount drops grouping spaces, apostrophes and currency signs and
+// normalizes minus signs, leaving digits, signs, dots and commas.
+func cleanAmount(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= '0' && r <= '9', r == '.', r == ',', r == '+', r == '-':
+			return r
+		case r == '−' || r == '–':
+			return '-'
+		}
+		return -1
+	}, s)
+}
+
+// detectDecimal finds the decimal separator of the amounts: the later of
+// the two when a value has both, otherwise one followed by other than three
+// digits. Without a hint a comma is decimal unless it is the delimiter.
+func detectDecimal(values []string, delimiter rune) byte {
+	for _, v := range values {
+		v = cleanAmount(v)
+		dot, comma := strings.LastIndexByte(v, '.'), strings.LastIndexByte(v, ',')
+		switch {
+		case dot >= 0 && comma >= 0:
+			if dot > comma {
+				return '.'
+			}
+			return ','
+		case comma >= 0 && len(v)-comma-1 != 3:
+			return ','
+		case dot >= 0 && len(v)-dot-1 != 3:
+			return '.'
+		}
+	}
+	if delimiter == ',' {
+		return '.'
+	}
+	return ','
+}
+
+func parseAmount(s string, decimal byte) (model.Money, error) {
+	v := cleanAmount(s)
+	// Accounting negatives: (1 500,00). A sign inside the parentheses
+	// already says the same.
+	t := strings.TrimSpace(s)
+	if strings.HasPrefix(t, "(") && strings.HasSuffix(t, ")") && !strings.HasPrefix(v, "-") {
+		v = "-" + strings.TrimPrefix(v, "+")
+	}
+	group := ","
+	if decimal == ',' {
+		group = "."
+	}
+	v = strings.ReplaceAll(v, group, "")
+	v = strings.Replace(v, string(decimal), ".", 1)
+	m, err := model.ParseMoney(v)
+	if err != nil || v == "" {
+		return 0, fmt.Errorf("сумма %q", s)
+	}
+	return m, nil
+}
+
+// layouts are tried in order. Day and month take one or two digits.
+var layouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2.1.2006 15:04:05",
+	"2.1.2006 15:04",
+	"2.1.2006",
+	"2.1.06",
+	"2-1-2006 15:04:05",
+	"2-1-2006",
+	"2/1/2006 15:04:05",
+	"2/1/2006 15:04",
+	"2/1/2006",
+}
+
+func parseTime(s string, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	// Unix seconds, as in the bot's own database.
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil && len(s) >= 9 {
+		return time.Unix(sec, 0).In(loc), nil
+	}
+	return time.Time{}, fmt.Errorf("дата %q", s)
+}
@@ -0,0 +1,231 @@
+package csvimport
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+var msk = time.FixedZone("MSK", 3*60*60)
+
+func TestParseDetection(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		spec      string
+		delimiter rune
+		decimal   byte
+		header    bool
+		mapping   Mapping
+		amounts   []model.Money
+	}{
+		{
+			name:      "comma, dot decimal, english header",
+			data:      "date,amount,note\n2024-01-05,1500.50,обед\n2024-01-06,-20,такси\n",
+			delimiter: ',', decimal: '.', header: true,
+			mapping: Mapping{0, 1, 2, -1},
+			amounts: []model.Money{150050, -2000},
+		},
+		{
+			name:      "semicolon, comma decimal, russian header",
+			data:      "Дата;Описание;Сумма;Автор\n05.01.2024;обед;1 500,50;@ivan\n06.01.2024;такси;-20,00;\n",
+			delimiter: ';', decimal: ',', header: true,
+			mapping: Mapping{0, 2, 1, 3},
+			amounts: []model.Money{150050, -2000},
+		},
+		{
+			name:      "tab, no header, default order",
+			data:      "2024-01-05\t100\tобед\n2024-01-06\t-2.5\tтакси\n",
+			delimiter: '\t', decimal: '.', header: false,
+			mapping: Mapping{0, 1, 2, -1},
+			amounts: []model.Money{10000, -250},
+		},
+		{
+			name:      "semicolon without a decimal hint",
+			data:      "2024-01-05;1500\n2024-01-06;-200\n",
+			delimiter: ';', decimal: ',', header: false,
+			mapping: Mapping{0, 1, -1, -1},
+			amounts: []model.Money{150000, -20000},
+		},
+		{
+			name:      "thousands grouped with commas",
+			data:      "date;amount\n2024-01-05;1,500\n2024-01-06;2,000.25\n",
+			delimiter: ';', decimal: '.', header: true,
+			mapping: Mapping{0, 1, -1, -1},
+			amounts: []model.Money{150000, 200025},
+		},
+		{
+			name:      "thousands grouped with dots",
+			data:      "date;amount\n2024-01-05;1.500\n2024-01-06;2.000,25\n",
+			delimiter: ';', decimal: ',', header: true,
+			mapping: Mapping{0, 1, -1, -1},
+			amounts: []model.Money{150000, 200025},
+		},
+		{
+			name:      "accounting negatives and signs",
+			data:      "date;amount\n2024-01-05;(1 500,00)\n2024-01-06;−30,00 ₽\n2024-01-07;+7,5\n",
+			delimiter: ';', decimal: ',', header: true,
+			mapping: Mapping{0, 1, -1, -1},
+			amounts: []model.Money{-150000, -3000, 750},
+		},
+		{
+			name:      "accounting negatives with a sign inside",
+			data:      "date;amount\n2024-01-05;(-500)\n2024-01-06;(−1 500,00)\n2024-01-07;(+7,5)\n",
+			delimiter: ';', decimal: ',', header: true,
+			mapping: Mapping{0, 1, -1, -1},
+			amounts: []model.Money{-50000, -150000, -750},
+		},
+		{
+			name:      "unknown header skipped by its amount",
+			data:      "when,how much,what\n2024-01-05,10,обед\n2024-01-06,20,такси\n",
+			delimiter: ',', decimal: '.', header: true,
+			mapping: Mapping{0, 1, 2, -1},
+			amounts: []model.Money{1000, 2000},
+		},
+		{
+			name:      "explicit mapping by number",
+			data:      "x;2024-01-05;обед;10\nx;2024-01-06;такси;20\n",
+			spec:      "date=2 amount=4 note=3",
+			delimiter: ';', decimal: ',', header: false,
+			mapping: Mapping{1, 3, 2, -1},
+			amounts: []model.Money{1000, 2000},
+		},
+		{
+			name:      "explicit mapping by header name",
+			data:      "Когда;Описание;Итого\n2024-01-05;обед;10\n",
+			spec:      "date=Когда amount=Итого",
+			delimiter: ';', decimal: ',', header: true,
+			mapping: Mapping{0, 2, 1, -1},
+			amounts: []model.Money{1000},
+		},
+		{
+			name:      "bom and blank lines",
+			data:      "\ufeffdate,amount\n2024-01-05,10\n,\n2024-01-06,20\n",
+			delimiter: ',', decimal: '.', header: true,
+			mapping: Mapping{0, 1, -1, -1},
+			amounts: []model.Money{1000, 2000},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := Parse([]byte(tt.data), tt.spec, msk)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if f.Delimiter != tt.delimiter || f.Decimal != tt.decimal || f.Header != tt.header {
+				t.Errorf("delimiter %q, decimal %q, header %v; want %q, %q, %v",
+					f.Delimiter, f.Decimal, f.Header, tt.delimiter, tt.decimal, tt.header)
+			}
+			if f.Mapping != tt.mapping {
+				t.Errorf("mapping %v, want %v", f.Mapping, tt.mapping)
+			}
+			if len(f.Rows) != len(tt.amounts) {
+				t.Fatalf("%d rows, want %d", len(f.Rows), len(tt.amounts))
+			}
+			for i, r := range f.Rows {
+				if r.Amount != tt.amounts[i] {
+					t.Errorf("row %d: amount %s, want %s", i, r.Amount, tt.amounts[i])
+				}
+			}
+		})
+	}
+}
+
+func TestParseDates(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2024-03-07", time.Date(2024, 3, 7, 0, 0, 0, 0, msk)},
+		{"2024-03-07 14:30", time.Date(2024, 3, 7, 14, 30, 0, 0, msk)},
+		{"2024-03-07 14:30:15", time.Date(2024, 3, 7, 14, 30, 15, 0, msk)},
+		{"2024-03-07T14:30:15", time.Date(2024, 3, 7, 14, 30, 15, 0, msk)},
+		{"2024-03-07T14:30:15Z", time.Date(2024, 3, 7, 14, 30, 15, 0, time.UTC)},
+		{"07.03.2024", time.Date(2024, 3, 7, 0, 0, 0, 0, msk)},
+		{"7.3.2024", time.Date(2024, 3, 7, 0, 0, 0, 0, msk)},
+		{"07.03.2024 14:30", time.Date(2024, 3, 7, 14, 30, 0, 0, msk)},
+		{"07.03.24", time.Date(2024, 3, 7, 0, 0, 0, 0, msk)},
+		{"07/03/2024", time.Date(2024, 3, 7, 0, 0, 0, 0, msk)},
+		{"7/3/2024 9:05", time.Date(2024, 3, 7, 9, 5, 0, 0, msk)},
+		{"07-03-2024", time.Date(2024, 3, 7, 0, 0, 0, 0, msk)},
+		{"1709811015", time.Unix(1709811015, 0)},
+	}
+	for _, tt := range tests {
+		f, err := Parse([]byte(tt.in+";10\n"), "", msk)
+		if err != nil {
+			t.Errorf("%q: %v", tt.in, err)
+			continue
+		}
+		if got := f.Rows[0].Time; !got.Equal(tt.want) {
+			t.Errorf("%q: %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseSortsByTime(t *testing.T) {
+	f, err := Parse([]byte("date;amount;note\n03.01.2024;3;c\n01.01.2024;1;a\n02.01.2024;2;b\n"), "", msk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var notes string
+	for _, r := range f.Rows {
+		notes += r.Note
+	}
+	if notes != "abc" {
+		t.Errorf("rows in order %q, want abc", notes)
+	}
+	if f.Rows[0].Line != 3 {
+		t.Errorf("first row from line %d, want 3", f.Rows[0].Line)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		spec string
+		line int
+	}{
+		{name: "empty", data: ""},
+		{name: "header only", data: "date;amount\n"},
+		{name: "no date column", data: "note;amount\nобед;10\n"},
+		{name: "bad date", data: "date;amount\n2024-01-05;10\nвчера;20\n", line: 3},
+		{name: "bad amount", data: "date;amount\n2024-01-05;10\n2024-01-06;много\n", line: 3},
+		{name: "zero amount", data: "date;amount\n2024-01-05;0,00\n", line: 2},
+		{name: "unknown field", data: "2024-01-05;10\n", spec: "when=1"},
+		{name: "unknown column", data: "date;amount\n2024-01-05;10\n", spec: "note=Описание"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), tt.spec, msk)
+			if err == nil {
+				t.Fatal("Parse succeeded")
+			}
+			var le *LineError
+			switch {
+			case tt.line > 0 && !errors.As(err, &le):
+				t.Errorf("error %v is not a LineError", err)
+			case tt.line > 0 && le.Line != tt.line:
+				t.Errorf("error at line %d, want %d", le.Line, tt.line)
+			}
+		})
+	}
+}
+
+func TestDetectDelimiter(t *testing.T) {
+	tests := map[string]rune{
+		"a;b;c\n1,5;2,5;3":     ';',
+		"a\tb\tc\n1,5\t2":      '\t',
+		"a,b,c\n1;2;3":         ',',
+		"single":               ',',
+		"a;b,c;d\n":            ';',
+		"date,amount,note;x\n": ',',
+	}
+	for in, want := range tests {
+		if got := DetectDelimiter([]byte(in)); got != want {
+			t.Errorf("DetectDelimiter(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+// Package dispatch processes updates concurrently while keeping the updates
+// of any single chat in the order they were received.
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+)
+
+var ErrClosed = errors.New("dispatcher is closed")
+
+// Dispatcher routes every update to a worker chosen by its chat ID. Each
+// worker has its own bounded queue and handles updates one at a time, so a
+// chat is always served by the same worker in order, while different chats
+// proceed in parallel.
+type Dispatcher struct {
+	handle func(ctx context.Context, u api.Update)
+	queues []chan api.Update
+	wg     sync.WaitGroup
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New starts workers goroutines, each with a queue of queueSize updates.
+func New(workers, queueSize int, handle func(ctx context.Context, u api.Update)) *Dispatcher {
+	if workers < 1 {
+		workers = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+
+	d := &Dispatcher{
+		handle: handle,
+		queues: make([]chan api.Update, workers),
+	}
+	for i := range d.queues {
+		q := make(chan api.Update, queueSize)
+		d.queues[i] = q
+		d.wg.Add(1)
+		go d.work(q)
+	}
+	return d
+}
+
+// Submit enqueues u. When the chat's queue is full it blocks until there is
+// room or ctx is done, pushing back on the update source.
+func (d *Dispatcher) Submit(ctx context.Context, u api.Update) error {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if d.closed {
+		return ErrClosed
+	}
+
+	q := d.queues[shard(ChatID(u), len(d.queues))]
+	select {
+	case q <- u:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close stops accepting updates and waits until every queued one has been
+// handled.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if !d.closed {
+		d.closed = true
+		for _, q := range d.queues {
+			close(q)
+		}
+	}
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+func (d *Dispatcher) work(q <-chan api.Update) {
+	defer d.wg.Done()
+	for u := range q {
+		d.run(u)
+	}
+}
+
+func (d *Dispatcher) run(u api.Update) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("panic handling update %d: %v", u.UpdateID, r)
+		}
+	}()
+	d.handle(context.Background(), u)
+}
+
+// ChatID returns the chat an update belongs to, or 0 if it has none.
+func ChatID(u api.Update) int64 {
+	switch {
+	case u.Message != nil:
+		return u.Message.Chat.ID
+	case u.EditedMessage != nil:
+		return u.EditedMessage.Chat.ID
+	case u.CallbackQuery != nil && u.CallbackQuery.Message != nil:
+		return u.CallbackQuery.Message.Chat.ID
+	}
+	return 0
+}
+
+func shard(chatID int64, n int) int {
+	h := uint64(chatID)
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	return int(h % uint64(n))
+}
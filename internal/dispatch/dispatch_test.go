@@ -0,0 +1,184 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+)
+
+func update(id int, chatID int64) api.Update {
+	return api.Update{UpdateID: id, Message: &api.Message{Chat: api.Chat{ID: chatID}}}
+}
+
+// chatsOnTwoWorkers returns two chats served by different workers of a
+// dispatcher with n of them.
+func chatsOnTwoWorkers(t *testing.T, n int) (int64, int64) {
+	t.Helper()
+	for b := int64(2); b < 1000; b++ {
+		if shard(1, n) != shard(b, n) {
+			return 1, b
+		}
+	}
+	t.Fatal("every chat on one worker")
+	return 0, 0
+}
+
+func TestOrderPerChat(t *testing.T) {
+	a, b := chatsOnTwoWorkers(t, 4)
+
+	var (
+		mu  sync.Mutex
+		got = make(map[int64][]int)
+		// bSeen is closed once chat b has been handled. The first update of
+		// chat a waits for it, so the test only finishes when the chats run
+		// in parallel.
+		bSeen = make(chan struct{})
+		once  sync.Once
+	)
+	d := New(4, 2, func(ctx context.Context, u api.Update) {
+		chat := ChatID(u)
+		if chat == a && u.UpdateID == 0 {
+			select {
+			case <-bSeen:
+			case <-time.After(5 * time.Second):
+				t.Error("chat b was not handled while chat a was busy")
+			}
+		}
+		if chat == b {
+			once.Do(func() { close(bSeen) })
+		}
+		mu.Lock()
+		got[chat] = append(got[chat], u.UpdateID)
+		mu.Unlock()
+	})
+
+	const perChat = 50
+	var want []int
+	for i := 0; i < perChat; i++ {
+		want = append(want, 2*i, 2*i+1)
+	}
+	ctx := context.Background()
+	for _, id := range want {
+		chat := a
+		if id%2 == 1 {
+			chat = b
+		}
+		if err := d.Submit(ctx, update(id, chat)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+
+	for chat, parity := range map[int64]int{a: 0, b: 1} {
+		var exp []int
+		for _, id := range want {
+			if id%2 == parity {
+				exp = append(exp, id)
+			}
+		}
+		if !slices.Equal(got[chat], exp) {
+			t.Errorf("chat %d handled %v, want %v", chat, got[chat], exp)
+		}
+	}
+}
+
+func TestCloseDrains(t *testing.T) {
+	release := make(chan struct{})
+	var (
+		mu      sync.Mutex
+		handled int
+	)
+	d := New(2, 8, func(ctx context.Context, u api.Update) {
+		<-release
+		mu.Lock()
+		handled++
+		mu.Unlock()
+	})
+
+	ctx := context.Background()
+	const n = 10
+	for i := 0; i < n; i++ {
+		if err := d.Submit(ctx, update(i, int64(i%3))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	closed := make(chan struct{})
+	go func() {
+		d.Close()
+		close(closed)
+	}()
+	select {
+	case <-closed:
+		t.Fatal("Close returned with updates still queued")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(release)
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not return after the queue drained")
+	}
+	if handled != n {
+		t.Errorf("handled %d updates, want %d", handled, n)
+	}
+	if err := d.Submit(ctx, update(n, 1)); !errors.Is(err, ErrClosed) {
+		t.Errorf("Submit after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestSubmitBlocksWhenFull(t *testing.T) {
+	release := make(chan struct{})
+	d := New(1, 1, func(ctx context.Context, u api.Update) { <-release })
+	defer d.Close()
+	defer close(release)
+
+	ctx := context.Background()
+	// One update is being handled and one waits in the queue.
+	for i := 0; i < 2; i++ {
+		if err := d.Submit(ctx, update(i, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The worker may not have taken the first one yet, so allow a third.
+	short, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	var err error
+	for i := 2; i < 4 && err == nil; i++ {
+		err = d.Submit(short, update(i, 1))
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Submit to a full queue = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestPanicKeepsWorker(t *testing.T) {
+	var (
+		mu  sync.Mutex
+		got []int
+	)
+	d := New(1, 4, func(ctx context.Context, u api.Update) {
+		if u.UpdateID == 0 {
+			panic("boom")
+		}
+		mu.Lock()
+		got = append(got, u.UpdateID)
+		mu.Unlock()
+	})
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		if err := d.Submit(ctx, update(i, 1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.Close()
+	if !slices.Equal(got, []int{1, 2}) {
+		t.Errorf("handled %v after a panic, want [1 2]", got)
+	}
+}
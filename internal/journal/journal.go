@@ -0,0 +1,362 @@
+// Package journal renders a ledger as a plain-text accounting journal for
+// hledger (readable by ledger-cli too) or beancount.
+//
+// Every bot account becomes Assets:<name>. A transfer is one transaction
+// with a posting per leg, converted with a total price when the currencies
+// differ. Any other entry is balanced against Expenses:<tag> or
+// Income:<tag> by the first hashtag of its note, Uncategorized without
+// one; a reversal uses the account of the entry it reverses. A transfer
+// leg whose partner is missing, as after its account was purged, goes to
+// Equity:Transfers instead, being neither income nor an expense. The stored
+// running balances become balance assertions, except where entries were
+// back-dated and the balance column, kept in entry order, no longer
+// matches the journal's date order.
+package journal
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// Format is a journal dialect.
+type Format string
+
+const (
+	Hledger   Format = "hledger"
+	Beancount Format = "beancount"
+)
+
+// Ext is the usual file extension of the format.
+func (f Format) Ext() string {
+	if f == Beancount {
+		return "beancount"
+	}
+	return "journal"
+}
+
+// Entry is one stored transaction.
+type Entry struct {
+	ID         int
+	Account    string
+	Currency   string
+	Time       time.Time
+	Amount     model.Money
+	Balance    model.Money
+	Note       string
+	Expression string
+	TransferID int
+	ReversesID int
+}
+
+const (
+	uncategorized = "Uncategorized"
+	// noCurrency stands in for accounts without a currency in beancount,
+	// which needs one on every amount: XXX is ISO 4217 for "no currency".
+	noCurrency = "XXX"
+)
+
+// Write renders entries, given oldest first by ID, as a journal. title goes
+// into the header.
+func Write(w io.Writer, f Format, title string, entries []Entry) error {
+	j := &journal{
+		format:  f,
+		names:   make(map[string]string),
+		taken:   make(map[string]bool),
+		opened:  make(map[string]time.Time),
+		byID:    make(map[int]*Entry, len(entries)),
+		byGroup: make(map[int][]*Entry),
+		sums:    make(map[string]model.Money),
+	}
+
+	sorted := make([]*Entry, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		sorted[i] = e
+		j.byID[e.ID] = e
+		if e.TransferID != 0 {
+			j.byGroup[e.TransferID] = append(j.byGroup[e.TransferID], e)
+		}
+	}
+	// Journals are read in date order; within a day keep the stored order
+	// so that the running balances still hold.
+	sort.SliceStable(sorted, func(a, b int) bool { return day(sorted[a].Time).Before(day(sorted[b].Time)) })
+
+	var (
+		body strings.Builder
+		done = make(map[int]bool)
+		// dayEnd holds the last entry of each account on the current day,
+		// in order of first use.
+		dayEnd []*Entry
+	)
+	for i, e := range sorted {
+		if !done[e.ID] {
+			legs := []*Entry{e}
+			if g := j.byGroup[e.TransferID]; e.TransferID != 0 && len(g) == 2 {
+				legs = g
+			}
+			for _, l := range legs {
+				done[l.ID] = true
+			}
+			j.transaction(&body, legs)
+		}
+
+		if f != Beancount {
+			continue
+		}
+		if k := slices.IndexFunc(dayEnd, func(d *Entry) bool { return d.Account == e.Account }); k >= 0 {
+			dayEnd[k] = e
+		} else {
+			dayEnd = append(dayEnd, e)
+		}
+		if i+1 == len(sorted) || !day(sorted[i+1].Time).Equal(day(e.Time)) {
+			j.balances(&body, dayEnd)
+			dayEnd = dayEnd[:0]
+		}
+	}
+
+	bw := bufio.NewWriter(w)
+	j.header(bw, title)
+	_, _ = bw.WriteString(body.String())
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("write journal: %w", err)
+	}
+	return nil
+}
+
+type journal struct {
+	format Format
+	// names maps "Assets:cash"-style raw names to their written form,
+	// taken holds the written forms to keep them unique.
+	names map[string]string
+	taken map[string]bool
+	// opened is the first day each written account is used.
+	opened  map[string]time.Time
+	order   []string
+	byID    map[int]*Entry
+	byGroup map[int][]*Entry
+	// sums are the running balances of the bot accounts in written order.
+	sums map[string]model.Money
+}
+
+func (j *journal) header(w *bufio.Writer, title string) {
+	switch j.format {
+	case Beancount:
+		fmt.Fprintf(w, "option \"title\" %s\n\n", quote(title))
+		for _, acc := range j.order {
+			fmt.Fprintf(w, "%s open %s\n", j.opened[acc].Format(time.DateOnly), acc)
+		}
+	default:
+		fmt.Fprintf(w, "; %s\n\n", oneLine(title))
+		for _, acc := range j.order {
+			fmt.Fprintf(w, "account %s\n", acc)
+		}
+	}
+	w.WriteString("\n")
+}
+
+func (j *journal) transaction(b *strings.Builder, legs []*Entry) {
+	first := legs[0]
+	date := first.Time.Format(time.DateOnly)
+	desc := first.Note
+	if first.ReversesID != 0 {
+		desc = fmt.Sprintf("Отмена операции %d", first.ReversesID)
+	}
+
+	switch j.format {
+	case Beancount:
+		fmt.Fprintf(b, "%s * %s", date, quote(oneLine(desc)))
+		for _, t := range model.ParseTags(first.Note) {
+			if beancountTag(t) {
+				b.WriteString(" #" + t)
+			}
+		}
+		b.WriteString("\n")
+		fmt.Fprintf(b, "  id: %d\n", first.ID)
+		if first.Expression != "" && first.ReversesID == 0 {
+			fmt.Fprintf(b, "  expr: %s\n", quote(first.Expression))
+		}
+	default:
+		fmt.Fprintf(b, "%s (%d)", date, first.ID)
+		if desc = strings.ReplaceAll(oneLine(desc), ";", ","); desc != "" {
+			b.WriteString(" " + desc)
+		}
+		if first.Expression != "" && first.ReversesID == 0 {
+			fmt.Fprintf(b, "  ; expr:%s", oneLine(first.Expression))
+		}
+		b.WriteString("\n")
+	}
+
+	if len(legs) == 2 {
+		for i, l := range legs {
+			posting := j.amount(l.Amount, l.Currency)
+			if other := legs[1-i]; i == 0 && other.Currency != l.Currency {
+				total := other.Amount
+				if total < 0 {
+					total = -total
+				}
+				posting += " @@ " + j.amount(total, other.Currency)
+			}
+			j.posting(b, j.account("Assets", l.Account, l.Time), posting, l)
+		}
+	} else {
+		j.posting(b, j.account("Assets", first.Account, first.Time), j.amount(first.Amount, first.Currency), first)
+		fmt.Fprintf(b, "%s%s\n", j.indent(), j.account(j.counterAccount(first)))
+	}
+	b.WriteString("\n")
+}
+
+// posting writes a posting of an asset account, with the running balance
+// as an assertion in hledger.
+func (j *journal) posting(b *strings.Builder, account, amount string, e *Entry) {
+	j.sums[e.Account] += e.Amount
+	if j.format == Beancount || !j.holds(e) {
+		fmt.Fprintf(b, "%s%-40s %s\n", j.indent(), account, amount)
+		return
+	}
+	fmt.Fprintf(b, "%s%-40s %s = %s\n", j.indent(), account, amount, j.amount(e.Balance, e.Currency))
+}
+
+// holds reports whether the stored balance of e is the running balance of
+// its account so far in the journal.
+func (j *journal) holds(e *Entry) bool {
+	return j.sums[e.Account] == e.Balance
+}
+
+func (j *journal) indent() string {
+	if j.format == Beancount {
+		return "  "
+	}
+	return "    "
+}
+
+// counterAccount is the Expenses or Income account balancing e, or
+// Equity:Transfers for a transfer leg written on its own.
+func (j *journal) counterAccount(e *Entry) (string, string, time.Time) {
+	src := e
+	if orig, ok := j.byID[e.ReversesID]; ok {
+		src = orig
+	}
+	if e.TransferID != 0 || src.TransferID != 0 {
+		return "Equity", "Transfers", e.Time
+	}
+	name := uncategorized
+	if tags := model.ParseTags(src.Note); len(tags) > 0 {
+		name = tags[0]
+	}
+	if src.Amount < 0 {
+		return "Expenses", name, e.Time
+	}
+	return "Income", name, e.Time
+}
+
+// balances writes beancount balance directives for the last entries of a
+// day's accounts, dated the next day: beancount checks balances at the
+// start of a day.
+func (j *journal) balances(b *strings.Builder, last []*Entry) {
+	written := false
+	for _, e := range last {
+		if !j.holds(e) {
+			continue
+		}
+		next := day(e.Time).AddDate(0, 0, 1).Format(time.DateOnly)
+		fmt.Fprintf(b, "%s balance %-40s %s\n", next, j.account("Assets", e.Account, e.Time), j.amount(e.Balance, e.Currency))
+		written = true
+	}
+	if written {
+		b.WriteString("\n")
+	}
+}
+
+// account returns the written name of root:name, registering it as used
+// from t on.
+func (j *journal) account(root, name string, t time.Time) string {
+	raw := root + ":" + name
+	if acc, ok := j.names[raw]; ok {
+		return acc
+	}
+	base := root + ":" + j.component(name)
+	acc := base
+	for i := 2; j.taken[acc]; i++ {
+		acc = fmt.Sprintf("%s-%d", base, i)
+	}
+	j.names[raw] = acc
+	j.taken[acc] = true
+	j.opened[acc] = day(t)
+	j.order = append(j.order, acc)
+	return acc
+}
+
+// component makes name usable as one segment of an account name: no
+// colons or double spaces for hledger, and for beancount only letters,
+// digits and dashes, starting with a capital letter or a digit.
+func (j *journal) component(name string) string {
+	if j.format != Beancount {
+		name = strings.Join(strings.Fields(strings.ReplaceAll(name, ":", "-")), " ")
+		if name == "" {
+			name = "-"
+		}
+		return name
+	}
+
+	var b strings.Builder
+	for _, r := range name {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('-')
+		}
+	}
+	rs := []rune(b.String())
+	if len(rs) == 0 || !(unicode.IsLetter(rs[0]) || unicode.IsDigit(rs[0])) {
+		rs = append([]rune("X"), rs...)
+	}
+	rs[0] = unicode.ToUpper(rs[0])
+	return string(rs)
+}
+
+func (j *journal) amount(v model.Money, currency string) string {
+	switch {
+	case j.format == Beancount && currency == "":
+		currency = noCurrency
+	case j.format == Beancount && !unicode.IsLetter(rune(currency[0])):
+		currency = "X" + currency
+	case currency == "":
+		return v.String()
+	case strings.IndexFunc(currency, func(r rune) bool { return !unicode.IsLetter(r) }) >= 0:
+		// hledger needs quotes around commodities that are not just letters.
+		currency = `"` + currency + `"`
+	}
+	return v.String() + " " + currency
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func quote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// beancountTag reports whether t is valid as a beancount tag, which only
+// allows ASCII letters, digits and -_/.
+func beancountTag(t string) bool {
+	for _, r := range t {
+		if !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("-_/.", r))) {
+			return false
+		}
+	}
+	return t != ""
+}
@@ -0,0 +1,70 @@
+package journal
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden journals in testdata")
+
+var msk = time.FixedZone("MSK", 3*60*60)
+
+func at(day, hour int) time.Time {
+	return time.Date(2024, 3, day, hour, 0, 0, 0, msk)
+}
+
+// entries is a small ledger with every kind of entry the bot stores.
+func entries() []Entry {
+	return []Entry{
+		{ID: 1, Account: "Наличные", Currency: "RUB", Time: at(1, 10), Amount: 100000, Balance: 100000, Note: "зарплата #доход", Expression: "1000"},
+		// A transfer converted from rubles to dollars.
+		{ID: 2, Account: "Наличные", Currency: "RUB", Time: at(2, 12), Amount: -30000, Balance: 70000, Expression: "-300", TransferID: 2},
+		{ID: 3, Account: "Карта: USD", Currency: "USD", Time: at(2, 12), Amount: 333, Balance: 333, Expression: "3.33", TransferID: 2},
+		// An undone entry and its reversal.
+		{ID: 4, Account: "Наличные", Currency: "RUB", Time: at(3, 9), Amount: -5000, Balance: 65000, Note: "обед #еда", Expression: "-50"},
+		{ID: 5, Account: "Наличные", Currency: "RUB", Time: at(3, 18), Amount: 5000, Balance: 70000, Expression: "-50", ReversesID: 4},
+		// A transfer whose other leg was deleted with its account.
+		{ID: 6, Account: "Наличные", Currency: "RUB", Time: at(4, 8), Amount: -10000, Balance: 60000, Note: "в копилку", Expression: "-100", TransferID: 99},
+		// No currency, a name beancount can't take as is and an ASCII tag.
+		{ID: 7, Account: "мой кошелек", Time: at(4, 20), Amount: 1050, Balance: 1050, Note: `бонус #food "кэшбэк"`, Expression: "10.5"},
+		// Dated before the entries it follows, so its balance is not
+		// asserted.
+		{ID: 8, Account: "Наличные", Currency: "RUB", Time: at(1, 8), Amount: -1000, Balance: 59000, Note: "такси; #транспорт", Expression: "-10"},
+	}
+}
+
+func TestWrite(t *testing.T) {
+	for _, f := range []Format{Hledger, Beancount} {
+		t.Run(string(f), func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, f, `Учет чата "Дом"`, entries()); err != nil {
+				t.Fatal(err)
+			}
+			golden(t, "ledger."+f.Ext(), buf.Bytes())
+		})
+	}
+}
+
+// golden compares got with testdata/<name>, or rewrites the file when the
+// test runs with -update.
+func golden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v; run go test -update to create it", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s; run go test -update if the change is intended\ngot:\n%s", path, got)
+	}
+}
@@ -8,33 +8,225 @@ import (
 type ID string
 
 const (
-	Start                 ID = "start"
-	AccountCreated        ID = "account_created"
-	NoAccountName         ID = "no_name"
-	NoAccountsYet         ID = "no_accounts"
-	NoExpression          ID = "no_expression"
-	InvalidExpression     ID = "invalid_expression"
-	AccDoesNotExist       ID = "acc_does_not_exist"
-	AccAlreadyExist       ID = "acc_already_exist"
-	AccRemoved            ID = "acc_removed"
-	BalanceUpdated        ID = "balance_updated"
-	BalanceReverted       ID = "balance_reverted"
-	UnsuccessfulOperation ID = "unsuccessful_operation"
+	Start                    ID = "start"
+	AccountCreated           ID = "account_created"
+	NoAccountName            ID = "no_name"
+	NoAccountsYet            ID = "no_accounts"
+	NoExpression             ID = "no_expression"
+	InvalidExpression        ID = "invalid_expression"
+	DivisionByZero           ID = "division_by_zero"
+	AmountOverflow           ID = "amount_overflow"
+	AccDoesNotExist          ID = "acc_does_not_exist"
+	AccAlreadyExist          ID = "acc_already_exist"
+	AccRemoved               ID = "acc_removed"
+	BalanceUpdated           ID = "balance_updated"
+	BalanceReverted          ID = "balance_reverted"
+	UnsuccessfulOperation    ID = "unsuccessful_operation"
+	TransferUsage            ID = "transfer_usage"
+	TransferSameAccount      ID = "transfer_same_account"
+	TransferNotPositive      ID = "transfer_not_positive"
+	TransferDone             ID = "transfer_done"
+	TransferReverted         ID = "transfer_reverted"
+	TransferUndoneToast      ID = "transfer_undone_toast"
+	TransferUndoneMark       ID = "transfer_undone_mark"
+	AccountBalance           ID = "account_balance"
+	AlreadyReverted          ID = "already_reverted"
+	TransactionEdited        ID = "transaction_edited"
+	EditAccountChanged       ID = "edit_account_changed"
+	LedgerConsistent         ID = "ledger_consistent"
+	LedgerInconsistent       ID = "ledger_inconsistent"
+	LedgerDiscrepancy        ID = "ledger_discrepancy"
+	LedgerFixed              ID = "ledger_fixed"
+	LedgerFixHint            ID = "ledger_fix_hint"
+	StatementPickPeriod      ID = "statement_pick_period"
+	StatementBadPeriod       ID = "statement_bad_period"
+	AccountCreatedCurrency   ID = "account_created_currency"
+	InvalidCurrency          ID = "invalid_currency"
+	TransferCurrencyMismatch ID = "transfer_currency_mismatch"
+	TransferConvertedDone    ID = "transfer_converted_done"
+	RateUsage                ID = "rate_usage"
+	InvalidRate              ID = "invalid_rate"
+	RateSaved                ID = "rate_saved"
+	NoRatesYet               ID = "no_rates"
+	RateMissing              ID = "rate_missing"
+	RateImportFailed         ID = "rate_import_failed"
+	RatesImported            ID = "rates_imported"
+	RatesMissingFor          ID = "rates_missing_for"
+	PermissionDenied         ID = "permission_denied"
+	UndoNotYours             ID = "undo_not_yours"
+	RoleUsage                ID = "role_usage"
+	RoleSet                  ID = "role_set"
+	RoleLastOwner            ID = "role_last_owner"
+	RolesList                ID = "roles_list"
+	DelConfirm               ID = "del_confirm"
+	DelCancelled             ID = "del_cancelled"
+	AccArchived              ID = "acc_archived"
+	RestoreUsage             ID = "restore_usage"
+	AccRestored              ID = "acc_restored"
+	NotArchived              ID = "not_archived"
+	PurgeNothing             ID = "purge_nothing"
+	PurgeConfirm             ID = "purge_confirm"
+	Purged                   ID = "purged"
+	PurgeCancelled           ID = "purge_cancelled"
+	ArchivedReadOnly         ID = "archived_read_only"
+	RenameUsage              ID = "rename_usage"
+	AccRenamed               ID = "acc_renamed"
+	MergeUsage               ID = "merge_usage"
+	MergeCurrencyMismatch    ID = "merge_currency_mismatch"
+	AccMerged                ID = "acc_merged"
+	AccSuggest               ID = "acc_suggest"
+	AccPicked                ID = "acc_picked"
+	PickNotYours             ID = "pick_not_yours"
+	PickGone                 ID = "pick_gone"
+	AliasUsage               ID = "alias_usage"
+	AliasTaken               ID = "alias_taken"
+	AliasAdded               ID = "alias_added"
+	AliasRemoved             ID = "alias_removed"
+	AliasNotFound            ID = "alias_not_found"
+	NoAliasesYet             ID = "no_aliases"
+	AlreadyApplied           ID = "already_applied"
+	HistoryUsage             ID = "history_usage"
+	NoHistory                ID = "no_history"
+	FindUsage                ID = "find_usage"
+	NothingFound             ID = "nothing_found"
+	FindGone                 ID = "find_gone"
+	ReportUsage              ID = "report_usage"
+	NoTransactionsInPeriod   ID = "no_transactions_in_period"
+	UnknownTag               ID = "unknown_tag"
+	ChartUsage               ID = "chart_usage"
+	ExportUsage              ID = "export_usage"
+	ExportCaption            ID = "export_caption"
+	ImportUsage              ID = "import_usage"
+	ImportFailed             ID = "import_failed"
+	ImportUnknownAuthors     ID = "import_unknown_authors"
+	ImportGone               ID = "import_gone"
+	ImportNotYours           ID = "import_not_yours"
+	ImportCancelled          ID = "import_cancelled"
+	ImportAlreadyDone        ID = "import_already_done"
+	ImportBackdated          ID = "import_backdated"
+	ImportDone               ID = "import_done"
+	ImportReverted           ID = "import_reverted"
+	BackupCaption            ID = "backup_caption"
+	BackupConfirm            ID = "backup_confirm"
+	BackupSummary            ID = "backup_summary"
+	BackupMembersKept        ID = "backup_members_kept"
+	BackupOtherChat          ID = "backup_other_chat"
+	BackupConflict           ID = "backup_conflict"
+	BackupInvalid            ID = "backup_invalid"
+	BackupInconsistent       ID = "backup_inconsistent"
+	BackupCancelled          ID = "backup_cancelled"
+	BackupRestored           ID = "backup_restored"
 )
 
 var rus = map[ID]string{
-	Start:                 "Привет",
-	AccountCreated:        "Счет %s создан",
-	NoAccountName:         "Не указано имя счета. Пример: /<команда> <имя_счета>",
-	NoAccountsYet:         "У вас пока нет счетов. Используйте /new <имя_счета>",
-	NoExpression:          "Неверный формат комманды. Используйте /<имя счета> <выражение> [комментарий]",
-	InvalidExpression:     "Некорректное выражение.",
-	AccDoesNotExist:       "Счет %s не существует.❌",
-	AccAlreadyExist:       "Счет с таким именем уже существует",
-	AccRemoved:            "Счет %s удален",
-	BalanceUpdated:        "Запомнил %s на счет %s\nКомментарий к транзакции: %s\nБаланс: %s",
-	BalanceReverted:       "Транзакция была успешно отменена.\nЗапомнил %s на счет %s\nБаланс: %s",
-	UnsuccessfulOperation: "Неудалось выполнить операцию",
+	Start:                    "Привет",
+	AccountCreated:           "Счет %s создан",
+	NoAccountName:            "Не указано имя счета. Пример: /<команда> <имя_счета>",
+	NoAccountsYet:            "У вас пока нет счетов. Используйте /new <имя_счета>",
+	NoExpression:             "Неверный формат комманды. Используйте /<имя счета> <выражение> [комментарий]",
+	InvalidExpression:        "Некорректное выражение.",
+	DivisionByZero:           "Некорректное выражение: деление на ноль.",
+	AmountOverflow:           "Слишком большая сумма.",
+	AccDoesNotExist:          "Счет %s не существует.❌",
+	AccAlreadyExist:          "Счет с таким именем уже существует",
+	AccRemoved:               "Счет %s перенесен в архив. Вернуть его: /restore %s",
+	BalanceUpdated:           "Запомнил %s на счет %s\nКомментарий к транзакции: %s\nБаланс: %s",
+	BalanceReverted:          "Транзакция была успешно отменена.\nЗапомнил %s на счет %s\nБаланс: %s",
+	UnsuccessfulOperation:    "Неудалось выполнить операцию",
+	TransferUsage:            "Неверный формат комманды. Используйте /transfer <со счета> <на счет> <выражение> [комментарий]",
+	TransferSameAccount:      "Нельзя перевести средства на тот же счет",
+	TransferNotPositive:      "Сумма перевода должна быть положительной",
+	TransferDone:             "Перевел %s со счета %s на счет %s\nКомментарий к переводу: %s\nБаланс %s: %s\nБаланс %s: %s",
+	TransferReverted:         "Перевод был успешно отменен.",
+	TransferUndoneToast:      "Перевод отменен",
+	TransferUndoneMark:       "Данный перевод отменен ✅",
+	AccountBalance:           "Баланс %s: %s",
+	AlreadyReverted:          "Это изменение уже отменено",
+	TransactionEdited:        "✏️ Исправлено по отредактированному сообщению",
+	EditAccountChanged:       "Счет транзакции нельзя изменить редактированием. Транзакция осталась на счете %s",
+	LedgerConsistent:         "Балансы всех счетов сходятся с историей транзакций ✅",
+	LedgerInconsistent:       "Найдены расхождения:",
+	LedgerDiscrepancy:        "• %s: баланс %s, сумма транзакций %s, неверных промежуточных остатков: %d",
+	LedgerFixed:              "Балансы пересчитаны по истории транзакций ✅",
+	LedgerFixHint:            "Чтобы пересчитать балансы по истории транзакций, используйте /check fix",
+	StatementPickPeriod:      "За какой период сформировать выписку?",
+	StatementBadPeriod:       "Не понял период %q. Примеры: 2025-01, прошлая неделя, 01.03-15.03",
+	AccountCreatedCurrency:   "Счет %s в валюте %s создан",
+	InvalidCurrency:          "Некорректная валюта %q. Используйте код вроде RUB, USD или USDT",
+	TransferCurrencyMismatch: "Счета в разных валютах (%s и %s). Перевод между ними невозможен",
+	TransferConvertedDone:    "Перевел %s со счета %s, зачислил %s на счет %s по курсу %s\nКомментарий к переводу: %s\nБаланс %s: %s\nБаланс %s: %s",
+	RateUsage:                "Используйте /rate <валюта> <валюта> <курс> [дата], например /rate USD RUB 92.5. Чтобы загрузить курсы из файла, отправьте CSV с подписью /rate",
+	InvalidRate:              "Некорректный курс %q",
+	RateSaved:                "Запомнил курс: 1 %s = %s %s с %s",
+	NoRatesYet:               "Курсов пока нет. Используйте /rate USD RUB 92.5",
+	RateMissing:              "Нет курса %s/%s. Задайте его через /rate или укажите в переводе: /transfer <со счета> <на счет> <сумма> @<курс>",
+	RateImportFailed:         "Не удалось загрузить курсы (строка %d): %s",
+	RatesImported:            "Загружено курсов: %d",
+	RatesMissingFor:          "Нет курса для %s → %s, такие счета не вошли в итог",
+	PermissionDenied:         "Недостаточно прав: нужна роль «%s». Обратитесь к владельцу чата",
+	UndoNotYours:             "Откатить чужую операцию может только владелец",
+	RoleUsage:                "Ответьте на сообщение участника командой /role <owner|editor|viewer> или укажите его ID: /role <id> <роль>",
+	RoleSet:                  "%s теперь %s",
+	RoleLastOwner:            "Нельзя снять последнего владельца чата",
+	RolesList:                "<b>Роли участников</b> (остальные — %s):\n",
+	DelConfirm:               "Перенести счет %s в архив? Он пропадет из /get и станет доступен только для чтения, история сохранится",
+	DelCancelled:             "Удаление отменено",
+	AccArchived:              "Счет %s в архиве. Вернуть его: /restore %s",
+	RestoreUsage:             "Используйте /restore <имя счета>. Чтобы восстановить резервную копию, отправьте файл /backup с подписью /restore",
+	AccRestored:              "Счет %s возвращен из архива",
+	NotArchived:              "В архиве нет счета %s",
+	PurgeNothing:             "Нечего удалять: счета хранятся в архиве %d дн. после удаления",
+	PurgeConfirm:             "Удалить навсегда вместе со всей историей: %s?",
+	Purged:                   "Удалены навсегда: %s",
+	PurgeCancelled:           "Очистка архива отменена",
+	ArchivedReadOnly:         "Счет в архиве и доступен только для чтения",
+	RenameUsage:              "Используйте /rename <старое имя> <новое имя>",
+	AccRenamed:               "Счет %s переименован в %s",
+	MergeUsage:               "Используйте /merge <откуда> <куда>: все операции первого счета перейдут во второй, а первый уйдет в архив",
+	MergeCurrencyMismatch:    "Нельзя объединить счета в разных валютах: %s и %s",
+	AccMerged:                "Счет %s объединен с %s: перенесено операций %d, баланс %s",
+	AccSuggest:               "Счета %s нет. Возможно, вы имели в виду:",
+	AccPicked:                "%s → %s",
+	PickNotYours:             "Выбрать счет может только автор операции",
+	PickGone:                 "Исходное сообщение недоступно, отправьте операцию заново",
+	AliasUsage:               "Используйте /alias <счет> <псевдоним>, например /alias cash нал. Удалить псевдоним: /unalias <псевдоним>",
+	AliasTaken:               "Имя %s уже занято",
+	AliasAdded:               "Теперь счет %s можно называть %s",
+	AliasRemoved:             "Псевдоним %s удален",
+	AliasNotFound:            "Псевдонима %s нет",
+	NoAliasesYet:             "Псевдонимов пока нет. Добавить: /alias <счет> <псевдоним>",
+	AlreadyApplied:           "Эта операция уже записана",
+	HistoryUsage:             "Используйте /history [счет] [количество], например /history cash 20",
+	NoHistory:                "Операций пока нет",
+	FindUsage:                "Используйте /find <текст> [счет] [период] [amount>100], например /find сантехник cash 2025-01",
+	NothingFound:             "Ничего не найдено",
+	FindGone:                 "Исходный запрос недоступен, повторите /find",
+	ReportUsage:              "Используйте /report [период] [счет], например /report прошлый месяц cash, или /report tags [период] для отчета по тегам",
+	NoTransactionsInPeriod:   "Нет операций %s",
+	UnknownTag:               "Тега %s еще нет",
+	ChartUsage:               "Используйте /chart [счет] [период], например /chart cash 2025, или /chart tags [период] для расходов по тегам",
+	ExportUsage:              "Используйте /export ledger для журнала hledger/ledger или /export beancount",
+	ExportCaption:            "Журнал %s: счета как Assets:<имя>, остатки проверяются утверждениями баланса",
+	ImportUsage:              "Отправьте CSV-файл с подписью /import <счет>. Колонки дата, сумма, комментарий и автор находятся по заголовку или идут в этом порядке; задать их явно: /import cash date=1 amount=3 note=Описание",
+	ImportFailed:             "Не удалось прочитать файл: %s",
+	ImportUnknownAuthors:     "Авторы не найдены среди участников с ролями, их операции будут записаны на вас: %s",
+	ImportGone:               "Файл недоступен, отправьте его заново",
+	ImportNotYours:           "Подтвердить может только тот, кто отправил файл",
+	ImportCancelled:          "Импорт отменен",
+	ImportAlreadyDone:        "Этот файл уже импортирован",
+	ImportBackdated:          "В счете %s есть операции от %s, а файл начинается с %s. Историю можно загрузить только в счет без более поздних записей",
+	ImportDone:               "Импортировано операций: %d на счет %s\nБаланс: %s",
+	ImportReverted:           "Импорт отменен, откачено операций: %d ✅",
+	BackupCaption:            "Резервная копия: счетов %d, операций %d. Чтобы восстановить ее, отправьте этот файл с подписью /restore",
+	BackupConfirm:            "Восстановить копию от %s в этот чат? Будет добавлено:\n%s",
+	BackupSummary:            "• счетов: %d, в архиве: %d\n• операций: %d\n• импортов: %d\n• псевдонимов: %d\n• курсов: %d\n• ролей участников: %d",
+	BackupMembersKept:        "У %d участников роль в этом чате уже есть, она не изменится",
+	BackupOtherChat:          "Копия сделана в другом чате: исправить восстановленные операции редактированием старых сообщений не получится",
+	BackupConflict:           "Нельзя восстановить копию: в чате уже есть %s. Переименуйте их или восстановите копию в пустой чат",
+	BackupInvalid:            "Не удалось прочитать копию: %s",
+	BackupInconsistent:       "Копия не прошла проверку: %s. Такую копию нельзя будет восстановить; запустите /check, чтобы найти расхождения",
+	BackupCancelled:          "Восстановление отменено",
+	BackupRestored:           "Копия восстановлена ✅\n%s",
 }
 
 func T(id ID, args ...any) string {
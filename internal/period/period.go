@@ -0,0 +1,244 @@
+// Package period parses the loose date ranges users type into commands,
+// such as "2025-01", "last week", "прошлый месяц" or "01.03-15.03".
+package period
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Range is a half-open interval [From, To). A zero bound is unbounded.
+type Range struct {
+	From time.Time
+	To   time.Time
+}
+
+// All is the unbounded range.
+var All = Range{}
+
+// IsAll reports whether neither bound is set.
+func (r Range) IsAll() bool { return r.From.IsZero() && r.To.IsZero() }
+
+// Label formats the range for humans with an inclusive end day, including
+// the leading preposition: "за 01.03.2025–15.03.2025".
+func (r Range) Label() string {
+	const layout = "02.01.2006"
+	switch {
+	case r.IsAll():
+		return "за все время"
+	case r.To.IsZero():
+		return "с " + r.From.Format(layout)
+	case r.From.IsZero():
+		return "по " + r.To.AddDate(0, 0, -1).Format(layout)
+	}
+	last := r.To.AddDate(0, 0, -1)
+	if last.Equal(r.From) {
+		return "за " + r.From.Format(layout)
+	}
+	return "за " + r.From.Format(layout) + "–" + last.Format(layout)
+}
+
+// Key encodes the range compactly for callback data; see FromKey.
+func (r Range) Key() string {
+	if r.IsAll() {
+		return "all"
+	}
+	return strconv.FormatInt(unix(r.From), 10) + "-" + strconv.FormatInt(unix(r.To), 10)
+}
+
+// FromKey decodes a range produced by Key.
+func FromKey(key string, loc *time.Location) (Range, error) {
+	if key == "all" {
+		return All, nil
+	}
+	a, b, ok := strings.Cut(key, "-")
+	if !ok {
+		return Range{}, fmt.Errorf("bad period key %q", key)
+	}
+	from, err1 := strconv.ParseInt(a, 10, 64)
+	to, err2 := strconv.ParseInt(b, 10, 64)
+	if err1 != nil || err2 != nil {
+		return Range{}, fmt.Errorf("bad period key %q", key)
+	}
+	return Range{From: fromUnix(from, loc), To: fromUnix(to, loc)}, nil
+}
+
+func unix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnix(v int64, loc *time.Location) time.Time {
+	if v == 0 {
+		return time.Time{}
+	}
+	return time.Unix(v, 0).In(loc)
+}
+
+// Day returns the range covering the calendar day of t.
+func Day(t time.Time) Range {
+	from := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return Range{From: from, To: from.AddDate(0, 0, 1)}
+}
+
+// Week returns the Monday-based week containing t.
+func Week(t time.Time) Range {
+	d := Day(t).From
+	offset := (int(d.Weekday()) + 6) % 7
+	from := d.AddDate(0, 0, -offset)
+	return Range{From: from, To: from.AddDate(0, 0, 7)}
+}
+
+// Month returns the calendar month containing t.
+func Month(t time.Time) Range {
+	from := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	return Range{From: from, To: from.AddDate(0, 1, 0)}
+}
+
+// Year returns the calendar year containing t.
+func Year(t time.Time) Range {
+	from := time.Date(t.Year(), 1, 1, 0, 0, 0, 0, t.Location())
+	return Range{From: from, To: from.AddDate(1, 0, 0)}
+}
+
+var keywords = map[string]func(now time.Time) Range{
+	"all":            func(time.Time) Range { return All },
+	"all time":       func(time.Time) Range { return All },
+	"все":            func(time.Time) Range { return All },
+	"всё":            func(time.Time) Range { return All },
+	"все время":      func(time.Time) Range { return All },
+	"за все время":   func(time.Time) Range { return All },
+	"today":          Day,
+	"сегодня":        Day,
+	"yesterday":      func(now time.Time) Range { return Day(now.AddDate(0, 0, -1)) },
+	"вчера":          func(now time.Time) Range { return Day(now.AddDate(0, 0, -1)) },
+	"week":           Week,
+	"this week":      Week,
+	"неделя":         Week,
+	"эта неделя":     Week,
+	"last week":      func(now time.Time) Range { return Week(now.AddDate(0, 0, -7)) },
+	"прошлая неделя": func(now time.Time) Range { return Week(now.AddDate(0, 0, -7)) },
+	"month":          Month,
+	"this month":     Month,
+	"месяц":          Month,
+	"этот месяц":     Month,
+	"last month":     func(now time.Time) Range { return Month(Month(now).From.AddDate(0, -1, 0)) },
+	"прошлый месяц":  func(now time.Time) Range { return Month(Month(now).From.AddDate(0, -1, 0)) },
+	"year":           Year,
+	"this year":      Year,
+	"год":            Year,
+	"этот год":       Year,
+	"last year":      func(now time.Time) Range { return Year(now.AddDate(-1, 0, 0)) },
+	"прошлый год":    func(now time.Time) Range { return Year(now.AddDate(-1, 0, 0)) },
+}
+
+var (
+	reYear     = regexp.MustCompile(`^(\d{4})$`)
+	reISOMonth = regexp.MustCompile(`^(\d{4})-(\d{1,2})$`)
+	reISODay   = regexp.MustCompile(`^(\d{4})-(\d{1,2})-(\d{1,2})$`)
+	reRuMonth  = regexp.MustCompile(`^(\d{1,2})[./](\d{4})$`)
+	reRuDay    = regexp.MustCompile(`^(\d{1,2})[./](\d{1,2})(?:[./](\d{2}|\d{4}))?$`)
+	spaces     = regexp.MustCompile(`\s+`)
+)
+
+// Parse understands keywords ("today", "last week", "прошлый месяц", "all"),
+// single dates that expand to their whole period ("2025", "2025-01",
+// "03.2025", "2025-01-15", "15.01.2025", "15.01") and ranges of two such
+// dates joined by "-", "–", ".." or a space, e.g. "01.03-15.03". Dates are
+// interpreted in now's location.
+func Parse(s string, now time.Time) (Range, error) {
+	s = strings.ToLower(strings.TrimSpace(spaces.ReplaceAllString(s, " ")))
+	if s == "" {
+		return Range{}, fmt.Errorf("empty period")
+	}
+	if fn, ok := keywords[s]; ok {
+		return fn(now), nil
+	}
+	if r, ok := parseDate(s, now); ok {
+		return r, nil
+	}
+
+	for _, sep := range []string{"..", "–", "—", " - "} {
+		if a, b, ok := strings.Cut(s, sep); ok {
+			return joinDates(a, b, now)
+		}
+	}
+	if a, b, ok := strings.Cut(s, " "); ok {
+		if r, err := joinDates(a, b, now); err == nil {
+			return r, nil
+		}
+	}
+	// A bare "-" may also be part of an ISO date, so try every split.
+	for i := strings.IndexByte(s, '-'); i >= 0; {
+		if r, err := joinDates(s[:i], s[i+1:], now); err == nil {
+			return r, nil
+		}
+		j := strings.IndexByte(s[i+1:], '-')
+		if j < 0 {
+			break
+		}
+		i += j + 1
+	}
+	return Range{}, fmt.Errorf("unknown period %q", s)
+}
+
+func joinDates(a, b string, now time.Time) (Range, error) {
+	ra, okA := parseDate(strings.TrimSpace(a), now)
+	rb, okB := parseDate(strings.TrimSpace(b), now)
+	if !okA || !okB {
+		return Range{}, fmt.Errorf("unknown period %q-%q", a, b)
+	}
+	if !rb.To.After(ra.From) {
+		return Range{}, fmt.Errorf("period ends before it starts")
+	}
+	return Range{From: ra.From, To: rb.To}, nil
+}
+
+func parseDate(s string, now time.Time) (Range, bool) {
+	loc := now.Location()
+	atoi := func(v string) int { n, _ := strconv.Atoi(v); return n }
+
+	if m := reYear.FindStringSubmatch(s); m != nil {
+		return Year(time.Date(atoi(m[1]), 1, 1, 0, 0, 0, 0, loc)), true
+	}
+	if m := reISOMonth.FindStringSubmatch(s); m != nil {
+		return month(atoi(m[1]), atoi(m[2]), loc)
+	}
+	if m := reRuMonth.FindStringSubmatch(s); m != nil {
+		return month(atoi(m[2]), atoi(m[1]), loc)
+	}
+	if m := reISODay.FindStringSubmatch(s); m != nil {
+		return day(atoi(m[1]), atoi(m[2]), atoi(m[3]), loc)
+	}
+	if m := reRuDay.FindStringSubmatch(s); m != nil {
+		y := now.Year()
+		switch len(m[3]) {
+		case 2:
+			y = 2000 + atoi(m[3])
+		case 4:
+			y = atoi(m[3])
+		}
+		return day(y, atoi(m[2]), atoi(m[1]), loc)
+	}
+	return Range{}, false
+}
+
+func month(y, m int, loc *time.Location) (Range, bool) {
+	if m < 1 || m > 12 {
+		return Range{}, false
+	}
+	return Month(time.Date(y, time.Month(m), 1, 0, 0, 0, 0, loc)), true
+}
+
+func day(y, m, d int, loc *time.Location) (Range, bool) {
+	t := time.Date(y, time.Month(m), d, 0, 0, 0, 0, loc)
+	if m < 1 || m > 12 || t.Day() != d {
+		return Range{}, false
+	}
+	return Day(t), true
+}
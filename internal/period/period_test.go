@@ -0,0 +1,119 @@
+package period
+
+import (
+	"testing"
+	"time"
+)
+
+var msk = time.FixedZone("MSK", 3*60*60)
+
+func date(y int, m time.Month, d int) time.Time {
+	return time.Date(y, m, d, 0, 0, 0, 0, msk)
+}
+
+func TestParse(t *testing.T) {
+	// A Wednesday at 02:30, still the day before in UTC: bounds computed in
+	// UTC would be a day off.
+	now := time.Date(2025, 1, 15, 2, 30, 0, 0, msk)
+
+	tests := []struct {
+		in       string
+		from, to time.Time
+	}{
+		{"all", time.Time{}, time.Time{}},
+		{"за все время", time.Time{}, time.Time{}},
+		{"today", date(2025, 1, 15), date(2025, 1, 16)},
+		{"Вчера", date(2025, 1, 14), date(2025, 1, 15)},
+		{"this week", date(2025, 1, 13), date(2025, 1, 20)},
+		{"last  week", date(2025, 1, 6), date(2025, 1, 13)},
+		{"месяц", date(2025, 1, 1), date(2025, 2, 1)},
+		{"прошлый месяц", date(2024, 12, 1), date(2025, 1, 1)},
+		{"год", date(2025, 1, 1), date(2026, 1, 1)},
+		{"last year", date(2024, 1, 1), date(2025, 1, 1)},
+		{"2024", date(2024, 1, 1), date(2025, 1, 1)},
+		{"2024-12", date(2024, 12, 1), date(2025, 1, 1)},
+		{"2024-2", date(2024, 2, 1), date(2024, 3, 1)},
+		{"02.2024", date(2024, 2, 1), date(2024, 3, 1)},
+		{"2024-02-29", date(2024, 2, 29), date(2024, 3, 1)},
+		{"31.12.2024", date(2024, 12, 31), date(2025, 1, 1)},
+		{"31.12.24", date(2024, 12, 31), date(2025, 1, 1)},
+		{"15.01", date(2025, 1, 15), date(2025, 1, 16)},
+		{"01.03-15.03", date(2025, 3, 1), date(2025, 3, 16)},
+		{"01.12.2024 – 15.01", date(2024, 12, 1), date(2025, 1, 16)},
+		{"2024-11..2025-01", date(2024, 11, 1), date(2025, 2, 1)},
+		{"2024-12-30-2025-01-02", date(2024, 12, 30), date(2025, 1, 3)},
+		{"2023 2024", date(2023, 1, 1), date(2025, 1, 1)},
+		{"01.01 - 01.01", date(2025, 1, 1), date(2025, 1, 2)},
+	}
+	for _, tt := range tests {
+		r, err := Parse(tt.in, now)
+		if err != nil {
+			t.Errorf("Parse(%q): %v", tt.in, err)
+			continue
+		}
+		if !r.From.Equal(tt.from) || !r.To.Equal(tt.to) {
+			t.Errorf("Parse(%q) = %v – %v, want %v – %v", tt.in, r.From, r.To, tt.from, tt.to)
+		}
+		if !r.From.IsZero() && r.From.Location() != msk {
+			t.Errorf("Parse(%q) in %v, want now's location", tt.in, r.From.Location())
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	now := time.Date(2025, 1, 15, 12, 0, 0, 0, msk)
+	for _, in := range []string{
+		"",
+		"  ",
+		"завтра",
+		"2024-13",
+		"13.2024",
+		"29.02.2025",
+		"2025-04-31",
+		"32.01",
+		"15.03-01.03",
+		"2025..2024",
+		"01.03-",
+		"1.2.3.4",
+	} {
+		if r, err := Parse(in, now); err == nil {
+			t.Errorf("Parse(%q) = %v – %v, want an error", in, r.From, r.To)
+		}
+	}
+}
+
+func TestLabel(t *testing.T) {
+	tests := []struct {
+		r    Range
+		want string
+	}{
+		{All, "за все время"},
+		{Day(date(2025, 3, 1)), "за 01.03.2025"},
+		{Month(date(2025, 2, 10)), "за 01.02.2025–28.02.2025"},
+		{Range{From: date(2025, 3, 1)}, "с 01.03.2025"},
+		{Range{To: date(2025, 3, 1)}, "по 28.02.2025"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.Label(); got != tt.want {
+			t.Errorf("Label() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestKey(t *testing.T) {
+	for _, r := range []Range{All, Week(date(2024, 12, 31)), {From: date(2025, 1, 1)}, {To: date(2025, 1, 1)}} {
+		got, err := FromKey(r.Key(), msk)
+		if err != nil {
+			t.Errorf("FromKey(%q): %v", r.Key(), err)
+			continue
+		}
+		if !got.From.Equal(r.From) || !got.To.Equal(r.To) {
+			t.Errorf("FromKey(%q) = %v – %v, want %v – %v", r.Key(), got.From, got.To, r.From, r.To)
+		}
+	}
+	for _, key := range []string{"", "1-", "x-1", "123"} {
+		if _, err := FromKey(key, msk); err == nil {
+			t.Errorf("FromKey(%q) succeeded", key)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// Package webhook receives Telegram updates over HTTP.
+//
+// The handler can be exercised locally without Telegram by POSTing a
+// recorded update:
+//
+//	curl -H 'X-Telegram-Bot-Api-Secret-Token: <secret>' \
+//	     -d @update.json http://localhost:8080/telegram
+package webhook
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+)
+
+const secretHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// maxBodySize is well above any update Telegram sends.
+const maxBodySize = 1 << 20
+
+// Handler decodes updates posted by Telegram and passes them to Dispatch.
+// When Dispatch fails the request is answered with 503 so Telegram retries.
+type Handler struct {
+	// Secret must match the secret_token given to setWebhook. Requests with
+	// a missing or different header are rejected, and when Secret is empty
+	// every request is rejected.
+	Secret   string
+	Dispatch func(ctx context.Context, u api.Update) error
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	got := r.Header.Get(secretHeader)
+	if h.Secret == "" || subtle.ConstantTimeCompare([]byte(got), []byte(h.Secret)) != 1 {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	var u api.Update
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&u); err != nil {
+		http.Error(w, "bad update", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.Dispatch(r.Context(), u); err != nil {
+		log.Printf("dispatch update %d: %v", u.UpdateID, err)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// NewSecret returns a random secret token for setWebhook, made of the
+// characters Telegram allows in one.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Server serves a Handler until its context is cancelled.
+type Server struct {
+	Addr     string
+	Path     string
+	CertFile string
+	KeyFile  string
+	Handler  *Handler
+}
+
+// Run listens on s.Addr, over TLS when both CertFile and KeyFile are set,
+// and shuts down gracefully once ctx is done, letting in-flight requests
+// finish.
+func (s *Server) Run(ctx context.Context) error {
+	mux := http.NewServeMux()
+	mux.Handle(s.Path, s.Handler)
+
+	srv := &http.Server{
+		Addr:              s.Addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		var err error
+		if s.CertFile != "" && s.KeyFile != "" {
+			err = srv.ListenAndServeTLS(s.CertFile, s.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		errCh <- err
+	}()
+	log.Printf("webhook listening on %s%s", s.Addr, s.Path)
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	api "github.com/OvyFlash/telegram-bot-api"
+)
+
+const testSecret = "s3cret-token_1"
+
+func recordedUpdate(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile("testdata/update.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func post(h http.Handler, body []byte, secret string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/telegram", bytes.NewReader(body))
+	if secret != "" {
+		req.Header.Set(secretHeader, secret)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandlerDispatchesRecordedUpdate(t *testing.T) {
+	var got []api.Update
+	h := &Handler{Secret: testSecret, Dispatch: func(ctx context.Context, u api.Update) error {
+		got = append(got, u)
+		return nil
+	}}
+
+	rec := post(h, recordedUpdate(t), testSecret)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusOK)
+	}
+	if len(got) != 1 {
+		t.Fatalf("dispatched %d updates, want 1", len(got))
+	}
+	u := got[0]
+	if u.UpdateID != 815093322 || u.Message == nil {
+		t.Fatalf("unexpected update %+v", u)
+	}
+	if u.Message.Chat.ID != -1002093751142 || u.Message.Command() != "cash" {
+		t.Errorf("message = chat %d command %q", u.Message.Chat.ID, u.Message.Command())
+	}
+}
+
+func TestHandlerRejectsBadSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler string
+		header  string
+	}{
+		{"missing header", testSecret, ""},
+		{"wrong header", testSecret, "not-the-secret"},
+		{"prefix of secret", testSecret, testSecret[:5]},
+		{"no secret configured", "", ""},
+		{"no secret configured, header sent", "", "anything"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called := false
+			h := &Handler{Secret: tt.handler, Dispatch: func(ctx context.Context, u api.Update) error {
+				called = true
+				return nil
+			}}
+			rec := post(h, recordedUpdate(t), tt.header)
+			if rec.Code != http.StatusForbidden {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusForbidden)
+			}
+			if called {
+				t.Error("update was dispatched")
+			}
+		})
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	failing := &Handler{Secret: testSecret, Dispatch: func(ctx context.Context, u api.Update) error {
+		return errors.New("queue closed")
+	}}
+	if rec := post(failing, recordedUpdate(t), testSecret); rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("failed dispatch: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+
+	ok := &Handler{Secret: testSecret, Dispatch: func(ctx context.Context, u api.Update) error { return nil }}
+	if rec := post(ok, []byte("{not json"), testSecret); rec.Code != http.StatusBadRequest {
+		t.Errorf("bad body: status = %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/telegram", nil)
+	req.Header.Set(secretHeader, testSecret)
+	rec := httptest.NewRecorder()
+	ok.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestNewSecret(t *testing.T) {
+	a, err := NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := NewSecret()
+	if a == b || len(a) != 64 {
+		t.Errorf("secrets %q and %q", a, b)
+	}
+}
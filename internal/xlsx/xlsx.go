@@ -0,0 +1,342 @@
+// Package xlsx writes minimal Office Open XML workbooks: text, number,
+// date and formula cells, a bold frozen header row and column widths.
+// Strings are stored inline, so a workbook is just the sheets and one
+// fixed stylesheet.
+package xlsx
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type style int
+
+// Cell styles; the indexes are positions in cellXfs of styles.xml.
+const (
+	styleGeneral style = iota
+	styleBold
+	styleAmount
+	styleBoldAmount
+	styleDate
+)
+
+type kind int
+
+const (
+	kindEmpty kind = iota
+	kindText
+	kindNumber
+	kindFormula
+)
+
+// Cell is one value of a row. The zero Cell is empty.
+type Cell struct {
+	kind    kind
+	text    string
+	number  float64
+	formula string
+	style   style
+}
+
+// Text is a string cell.
+func Text(s string) Cell {
+	if s == "" {
+		return Cell{}
+	}
+	return Cell{kind: kindText, text: s}
+}
+
+// Int is a whole number cell, such as an ID.
+func Int(v int64) Cell {
+	return Cell{kind: kindNumber, number: float64(v)}
+}
+
+// Amount is a number cell shown with two decimals and grouped thousands.
+func Amount(v float64) Cell {
+	return Cell{kind: kindNumber, number: v, style: styleAmount}
+}
+
+// Date is a date and time cell in t's location.
+func Date(t time.Time) Cell {
+	return Cell{kind: kindNumber, number: serial(t), style: styleDate}
+}
+
+// Formula is an amount cell computed by formula, written without the
+// leading "=". cached is stored as its value for viewers that do not
+// recalculate; spreadsheet programs recalculate on load.
+func Formula(formula string, cached float64) Cell {
+	return Cell{kind: kindFormula, formula: formula, number: cached, style: styleAmount}
+}
+
+// Bold returns the cell in bold.
+func (c Cell) Bold() Cell {
+	switch c.style {
+	case styleGeneral:
+		c.style = styleBold
+	case styleAmount:
+		c.style = styleBoldAmount
+	}
+	return c
+}
+
+// Sheet is a worksheet. Rows are numbered from 1; the header, when
+// FreezeHeader is set, is row 1.
+type Sheet struct {
+	name string
+	// Widths are column widths in characters; zero keeps the default.
+	Widths       []float64
+	FreezeHeader bool
+	rows         [][]Cell
+}
+
+// Name is the sheet name as stored, after cleaning and deduplication.
+func (s *Sheet) Name() string { return s.name }
+
+// Append adds a row and returns its 1-based number.
+func (s *Sheet) Append(cells ...Cell) int {
+	s.rows = append(s.rows, cells)
+	return len(s.rows)
+}
+
+// Rows is the number of rows appended so far.
+func (s *Sheet) Rows() int { return len(s.rows) }
+
+// Workbook is a set of sheets in tab order.
+type Workbook struct {
+	sheets []*Sheet
+	names  map[string]bool
+}
+
+// AddSheet adds a sheet named name, with characters Excel forbids replaced,
+// cut to 31 characters and suffixed when the name is already taken.
+func (wb *Workbook) AddSheet(name string) *Sheet {
+	if wb.names == nil {
+		wb.names = make(map[string]bool)
+	}
+	base := sheetName(name, 31)
+	name = base
+	for i := 2; wb.names[strings.ToLower(name)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		name = sheetName(base, 31-utf8.RuneCountInString(suffix)) + suffix
+	}
+	wb.names[strings.ToLower(name)] = true
+
+	s := &Sheet{name: name}
+	wb.sheets = append(wb.sheets, s)
+	return s
+}
+
+// Column returns the letters of the 0-based column i: A, B, …, Z, AA.
+func Column(i int) string {
+	var b []byte
+	for i++; i > 0; i = (i - 1) / 26 {
+		b = append([]byte{byte('A' + (i-1)%26)}, b...)
+	}
+	return string(b)
+}
+
+// Range refers to rows from..to of column col on sheet s, for use in
+// formulas on another sheet.
+func Range(s *Sheet, col, from, to int) string {
+	return fmt.Sprintf("'%s'!%s%d:%s%d", strings.ReplaceAll(s.name, "'", "''"), Column(col), from, Column(col), to)
+}
+
+// Write writes the workbook as an .xlsx file.
+func (wb *Workbook) Write(w io.Writer) error {
+	if len(wb.sheets) == 0 {
+		wb.AddSheet("Sheet1")
+	}
+	zw := zip.NewWriter(w)
+	parts := []struct {
+		name string
+		body string
+	}{
+		{"[Content_Types].xml", wb.contentTypes()},
+		{"_rels/.rels", rootRels},
+		{"xl/workbook.xml", wb.workbook()},
+		{"xl/_rels/workbook.xml.rels", wb.workbookRels()},
+		{"xl/styles.xml", stylesXML},
+	}
+	for _, p := range parts {
+		if err := writePart(zw, p.name, p.body); err != nil {
+			return err
+		}
+	}
+	for i, s := range wb.sheets {
+		if err := writePart(zw, fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), s.xml()); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("close xlsx: %w", err)
+	}
+	return nil
+}
+
+func writePart(zw *zip.Writer, name, body string) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return fmt.Errorf("create %s: %w", name, err)
+	}
+	if _, err := io.WriteString(f, body); err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+const (
+	xmlHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n"
+	nsMain    = "http://schemas.openxmlformats.org/spreadsheetml/2006/main"
+	nsRel     = "http://schemas.openxmlformats.org/officeDocument/2006/relationships"
+
+	rootRels = xmlHeader + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="` + nsRel + `/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`
+
+	stylesXML = xmlHeader + `<styleSheet xmlns="` + nsMain + `">` +
+		`<numFmts count="2">` +
+		`<numFmt numFmtId="164" formatCode="#,##0.00"/>` +
+		`<numFmt numFmtId="165" formatCode="dd.mm.yyyy hh:mm"/>` +
+		`</numFmts>` +
+		`<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="5">` +
+		`<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+		`<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>` +
+		`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`<xf numFmtId="164" fontId="1" fillId="0" borderId="0" xfId="0" applyNumberFormat="1" applyFont="1"/>` +
+		`<xf numFmtId="165" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>` +
+		`</cellXfs>` +
+		`</styleSheet>`
+)
+
+func (wb *Workbook) contentTypes() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">`)
+	b.WriteString(`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>`)
+	b.WriteString(`<Default Extension="xml" ContentType="application/xml"/>`)
+	b.WriteString(`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	b.WriteString(`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	for i := range wb.sheets {
+		fmt.Fprintf(&b, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, i+1)
+	}
+	b.WriteString(`</Types>`)
+	return b.String()
+}
+
+func (wb *Workbook) workbook() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<workbook xmlns="` + nsMain + `" xmlns:r="` + nsRel + `"><sheets>`)
+	for i, s := range wb.sheets {
+		fmt.Fprintf(&b, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, escape(s.name), i+1, i+1)
+	}
+	b.WriteString(`</sheets><calcPr fullCalcOnLoad="1"/></workbook>`)
+	return b.String()
+}
+
+func (wb *Workbook) workbookRels() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+	for i := range wb.sheets {
+		fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/worksheet" Target="worksheets/sheet%d.xml"/>`, i+1, nsRel, i+1)
+	}
+	fmt.Fprintf(&b, `<Relationship Id="rId%d" Type="%s/styles" Target="styles.xml"/>`, len(wb.sheets)+1, nsRel)
+	b.WriteString(`</Relationships>`)
+	return b.String()
+}
+
+func (s *Sheet) xml() string {
+	var b strings.Builder
+	b.WriteString(xmlHeader)
+	b.WriteString(`<worksheet xmlns="` + nsMain + `">`)
+	if s.FreezeHeader {
+		b.WriteString(`<sheetViews><sheetView workbookViewId="0">` +
+			`<pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/>` +
+			`</sheetView></sheetViews>`)
+	}
+	if len(s.Widths) > 0 {
+		b.WriteString(`<cols>`)
+		for i, w := range s.Widths {
+			if w > 0 {
+				fmt.Fprintf(&b, `<col min="%d" max="%d" width="%s" customWidth="1"/>`, i+1, i+1, strconv.FormatFloat(w, 'f', -1, 64))
+			}
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	for i, row := range s.rows {
+		fmt.Fprintf(&b, `<row r="%d">`, i+1)
+		for j, c := range row {
+			c.writeXML(&b, Column(j)+strconv.Itoa(i+1))
+		}
+		b.WriteString(`</row>`)
+	}
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.String()
+}
+
+func (c Cell) writeXML(b *strings.Builder, ref string) {
+	attrs := fmt.Sprintf(`r="%s"`, ref)
+	if c.style != styleGeneral {
+		attrs += fmt.Sprintf(` s="%d"`, c.style)
+	}
+	num := strconv.FormatFloat(c.number, 'f', -1, 64)
+	switch c.kind {
+	case kindText:
+		fmt.Fprintf(b, `<c %s t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, attrs, escape(c.text))
+	case kindNumber:
+		fmt.Fprintf(b, `<c %s><v>%s</v></c>`, attrs, num)
+	case kindFormula:
+		fmt.Fprintf(b, `<c %s><f>%s</f><v>%s</v></c>`, attrs, escape(c.formula), num)
+	default:
+		if c.style != styleGeneral {
+			fmt.Fprintf(b, `<c %s/>`, attrs)
+		}
+	}
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	_ = xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// sheetName replaces the characters Excel does not allow in sheet names
+// and cuts the name to n characters.
+func sheetName(name string, n int) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) || r < ' ' {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	name = strings.Trim(name, "'")
+	if utf8.RuneCountInString(name) > n {
+		name = string([]rune(name)[:n])
+	}
+	if name == "" {
+		name = "_"
+	}
+	return name
+}
+
+// epoch is day zero of Excel's 1900 date system, as adjusted for its
+// fictitious 29 February 1900.
+var epoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// serial converts the wall clock time of t to an Excel date serial.
+func serial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	return wall.Sub(epoch).Seconds() / 86400
+}
@@ -4,9 +4,13 @@ import (
 	"context"
 	"flag"
 	"log"
+	"os/signal"
+	"syscall"
 
 	api "github.com/OvyFlash/telegram-bot-api"
 	"github.com/maxBezel/ledgerbot/commands"
+	"github.com/maxBezel/ledgerbot/internal/dispatch"
+	"github.com/maxBezel/ledgerbot/internal/webhook"
 	sql "github.com/maxBezel/ledgerbot/storage"
 )
 
@@ -15,10 +19,27 @@ const sqlitePath = "data/data.db"
 func main() {
 	// token
 	token := flag.String("token", "", "token provided by @BotFather")
+	evalBackend := flag.String("eval", "native", "expression evaluator: native or qalc")
+
+	// webhook
+	mode := flag.String("mode", "polling", "how to receive updates: polling or webhook")
+	listen := flag.String("listen", ":8080", "webhook server address")
+	hookPath := flag.String("webhook-path", "/telegram", "webhook server path")
+	hookURL := flag.String("webhook-url", "", "public webhook URL to register with Telegram; empty skips registration")
+	secret := flag.String("webhook-secret", "", "secret token Telegram sends in X-Telegram-Bot-Api-Secret-Token; generated when registering without one")
+	tlsCert := flag.String("tls-cert", "", "TLS certificate file for the webhook server")
+	tlsKey := flag.String("tls-key", "", "TLS key file for the webhook server")
+
+	// dispatch
+	workers := flag.Int("workers", 8, "number of chats processed in parallel")
+	queueSize := flag.Int("queue", 64, "pending updates per worker before intake blocks")
 	flag.Parse()
 	if *token == "" {
 		log.Fatal("no token given")
 	}
+	if *mode != "polling" && *mode != "webhook" {
+		log.Fatalf("unknown mode %q", *mode)
+	}
 
 	// sql
 	storage, err := sql.New(sqlitePath)
@@ -26,7 +47,9 @@ func main() {
 		log.Fatal("failed to connect to db")
 	}
 
-	storage.Init(context.TODO())
+	if err := storage.Init(context.TODO()); err != nil {
+		log.Fatal(err)
+	}
 
 	// bot
 	bot, err := api.NewBotAPI(*token)
@@ -34,7 +57,17 @@ func main() {
 		log.Fatal("failed to create bot API")
 	}
 
-	deps := commands.Deps{Bot: bot, Storage: storage}
+	var eval commands.Evaluator
+	switch *evalBackend {
+	case "native":
+		eval = commands.NativeEvaluator{}
+	case "qalc":
+		eval = commands.QalcEvaluator{Precision: 20}
+	default:
+		log.Fatalf("unknown evaluator %q", *evalBackend)
+	}
+
+	deps := commands.Deps{Bot: bot, Storage: storage, Eval: eval}
 	reg := commands.NewRegistry(deps)
 
 	reg.Register(commands.Start())
@@ -42,23 +75,100 @@ func main() {
 	reg.Register(commands.Del())
 	reg.Register(commands.Transaction())
 	reg.Register(commands.Get())
+	reg.Register(commands.Transfer())
+	reg.Register(commands.Check())
+	reg.Register(commands.Statement())
+	reg.Register(commands.Rate())
+	reg.Register(commands.Role())
+	reg.Register(commands.Restore())
+	reg.Register(commands.Purge())
+	reg.Register(commands.Rename())
+	reg.Register(commands.Merge())
+	reg.Register(commands.Alias())
+	reg.Register(commands.Unalias())
+	reg.Register(commands.History())
+	reg.Register(commands.Find())
+	reg.Register(commands.Report())
+	reg.Register(commands.Chart())
+	reg.Register(commands.Export())
+	reg.Register(commands.Import())
+	reg.Register(commands.Backup())
 
 	if _, err := bot.Request(api.NewSetMyCommands(reg.BotCommands()...)); err != nil {
 		log.Fatal(err)
 	}
 
-	config := api.NewUpdate(0)
-	updates := bot.GetUpdatesChan(config)
-	ctx := context.Background()
-
-	for u := range updates {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
+	disp := dispatch.New(*workers, *queueSize, func(ctx context.Context, u api.Update) {
 		if u.CallbackQuery != nil {
 			commands.HandleCallback(ctx, deps, u.CallbackQuery)
-			continue
+			return
 		}
 		if u.Message != nil {
 			reg.Handle(ctx, u.Message)
+			return
+		}
+		if u.EditedMessage != nil {
+			reg.HandleEdit(ctx, u.EditedMessage)
+		}
+	})
+	// Runs after the update source has stopped, handling what is queued.
+	defer disp.Close()
+
+	if *mode == "webhook" {
+		// Without a secret anyone who reaches the port could post updates.
+		// A registered webhook gets a fresh one; an unregistered one must
+		// be given the secret it was registered with.
+		if *secret == "" {
+			if *hookURL == "" {
+				log.Fatal("webhook mode needs -webhook-secret, or -webhook-url to register with a generated one")
+			}
+			if *secret, err = webhook.NewSecret(); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if *hookURL != "" {
+			wh, err := api.NewWebhook(*hookURL)
+			if err != nil {
+				log.Fatal(err)
+			}
+			wh.SecretToken = *secret
+			if _, err := bot.Request(wh); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		srv := &webhook.Server{
+			Addr:     *listen,
+			Path:     *hookPath,
+			CertFile: *tlsCert,
+			KeyFile:  *tlsKey,
+			Handler:  &webhook.Handler{Secret: *secret, Dispatch: disp.Submit},
+		}
+		if err := srv.Run(ctx); err != nil {
+			log.Print(err)
+		}
+		return
+	}
+
+	// getUpdates is refused while a webhook is registered.
+	if _, err := bot.Request(api.DeleteWebhookConfig{}); err != nil {
+		log.Fatal(err)
+	}
+
+	config := api.NewUpdate(0)
+	updates := bot.GetUpdatesChan(config)
+	go func() {
+		<-ctx.Done()
+		bot.StopReceivingUpdates()
+	}()
+
+	// Updates already received are still queued after a shutdown signal.
+	for u := range updates {
+		if err := disp.Submit(context.Background(), u); err != nil {
+			log.Print(err)
 		}
 	}
 }
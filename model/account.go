@@ -10,7 +10,8 @@ type Account struct {
 	Id        int
 	Name      string
 	ChatId    int64
-	Balance   float64
+	Balance   Money
+	Currency  string
 	CreatedAt string
 }
 
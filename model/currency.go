@@ -0,0 +1,22 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// NormalizeCurrency upper-cases an ISO 4217 code or a custom ticker such as
+// USDT and checks that it is 2 to 10 Latin letters or digits.
+func NormalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if n := len(code); n < 2 || n > 10 {
+		return "", fmt.Errorf("invalid currency %q", code)
+	}
+	for _, r := range code {
+		if !(r >= 'A' && r <= 'Z') && !unicode.IsDigit(r) {
+			return "", fmt.Errorf("invalid currency %q", code)
+		}
+	}
+	return code, nil
+}
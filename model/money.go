@@ -0,0 +1,99 @@
+package model
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MinorUnits is the number of minor units (kopecks, cents) in one major unit.
+const MinorUnits = 100
+
+// Money is an exact amount stored as an integer number of minor units.
+type Money int64
+
+// ParseMoney parses a plain decimal string such as "-1234.5" into minor units.
+// Digits beyond the second fractional place are rounded half away from zero.
+func ParseMoney(s string) (Money, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, fmt.Errorf("empty amount")
+	}
+
+	neg := false
+	switch s[0] {
+	case '-':
+		neg = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	intPart, frac := s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		intPart, frac = s[:dot], s[dot+1:]
+	}
+	if intPart == "" && frac == "" {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	if intPart == "" {
+		intPart = "0"
+	}
+
+	for _, r := range intPart + frac {
+		if r < '0' || r > '9' {
+			return 0, fmt.Errorf("invalid amount %q", s)
+		}
+	}
+
+	roundUp := false
+	if len(frac) > 2 {
+		roundUp = frac[2] >= '5'
+		frac = frac[:2]
+	}
+	frac += strings.Repeat("0", 2-len(frac))
+
+	major, err := strconv.ParseInt(intPart, 10, 64)
+	if err != nil || major > math.MaxInt64/MinorUnits-1 {
+		return 0, fmt.Errorf("amount %q out of range", s)
+	}
+	minor, _ := strconv.ParseInt(frac, 10, 64)
+
+	v := major*MinorUnits + minor
+	if roundUp {
+		v++
+	}
+	if neg {
+		v = -v
+	}
+	return Money(v), nil
+}
+
+// Major returns the whole part of the amount, truncated toward zero.
+func (m Money) Major() int64 { return int64(m) / MinorUnits }
+
+// Minor returns the absolute fractional part in minor units.
+func (m Money) Minor() int64 {
+	r := int64(m) % MinorUnits
+	if r < 0 {
+		r = -r
+	}
+	return r
+}
+
+// Float returns an approximate float64 value, for display-only purposes.
+func (m Money) Float() float64 { return float64(m) / MinorUnits }
+
+// String formats the amount with exactly two fractional digits, e.g. "-12.50".
+func (m Money) String() string {
+	sign := ""
+	if m < 0 {
+		sign = "-"
+	}
+	major := m.Major()
+	if major < 0 {
+		major = -major
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, major, m.Minor())
+}
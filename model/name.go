@@ -0,0 +1,15 @@
+package model
+
+import (
+	"strings"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// NormalizeName folds an account name or alias for matching: compatibility
+// forms are unified (NFKC), case is folded and ё is read as е.
+func NormalizeName(s string) string {
+	s = norm.NFKC.String(strings.TrimSpace(s))
+	s = strings.ToLower(s)
+	return strings.ReplaceAll(s, "ё", "е")
+}
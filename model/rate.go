@@ -0,0 +1,32 @@
+package model
+
+import (
+	"math/big"
+	"strconv"
+	"time"
+)
+
+// Rate says how many units of Quote one unit of Base is worth, starting at
+// ValidFrom (unix seconds) until a later rate for the same pair replaces it.
+type Rate struct {
+	Id        int
+	ChatId    int64
+	Base      string
+	Quote     string
+	Rate      *big.Rat
+	ValidFrom string
+	CreatedBy int64
+	CreatedAt string
+}
+
+func NewRate(chatID int64, base, quote string, rate *big.Rat, validFrom time.Time, createdBy int64) *Rate {
+	return &Rate{
+		ChatId:    chatID,
+		Base:      base,
+		Quote:     quote,
+		Rate:      rate,
+		ValidFrom: strconv.FormatInt(validFrom.UTC().Unix(), 10),
+		CreatedBy: createdBy,
+		CreatedAt: strconv.FormatInt(time.Now().UTC().Unix(), 10),
+	}
+}
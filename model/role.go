@@ -0,0 +1,46 @@
+package model
+
+import "strings"
+
+// Role is what a chat member may do with the chat's books. Higher roles
+// include everything the lower ones may do.
+type Role int
+
+const (
+	RoleViewer Role = iota + 1
+	RoleEditor
+	RoleOwner
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return "viewer"
+	case RoleEditor:
+		return "editor"
+	case RoleOwner:
+		return "owner"
+	}
+	return "none"
+}
+
+// ParseRole accepts the English role names.
+func ParseRole(s string) (Role, bool) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "viewer":
+		return RoleViewer, true
+	case "editor":
+		return RoleEditor, true
+	case "owner":
+		return RoleOwner, true
+	}
+	return 0, false
+}
+
+type ChatMember struct {
+	ChatId    int64
+	UserId    int64
+	Name      string
+	Role      Role
+	UpdatedAt string
+}
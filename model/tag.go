@@ -0,0 +1,26 @@
+package model
+
+import "regexp"
+
+type Tag struct {
+	Id     int
+	ChatId int64
+	Name   string
+}
+
+var hashtag = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+// ParseTags returns the hashtags of a note normalized with NormalizeName,
+// without the leading # and in order of first appearance.
+func ParseTags(note string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, m := range hashtag.FindAllStringSubmatch(note, -1) {
+		tag := NormalizeName(m[1])
+		if !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
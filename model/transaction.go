@@ -7,24 +7,34 @@ import (
 )
 
 type Transaction struct {
-	Id        int
-	AccountId int
-	Amount    float64
-	Expression string
-	Note      string
-	Balance   float64
-	CreatedAt string
-	CreatedBy int64
+	Id          int
+	AccountId   int
+	Amount      Money
+	Expression  string
+	Note        string
+	Balance     Money
+	CreatedAt   string
+	CreatedBy   int64
+	TransferId  int
+	ReversesId  int
+	Reverted    bool
+	SourceMsgId int
+	ReplyMsgId  int
+	// Rate is the exchange rate applied to a leg of a converting transfer,
+	// as an exact fraction such as "185/2".
+	Rate string
+	// ImportId links the transactions loaded by one CSV import.
+	ImportId int
 }
 
-func NewTransaction(accountId int, amount float64, note string, balance float64, expression string, createdBy int64) *Transaction {
+func NewTransaction(accountId int, amount Money, note string, balance Money, expression string, createdBy int64) *Transaction {
 	return &Transaction{
-		AccountId: accountId,
-		Amount: amount,
+		AccountId:  accountId,
+		Amount:     amount,
 		Expression: expression,
-		Note: strings.TrimSpace(note),
-		Balance: balance,
-		CreatedBy: createdBy,
-		CreatedAt: strconv.FormatInt(time.Now().UTC().Unix(), 10),
+		Note:       strings.TrimSpace(note),
+		Balance:    balance,
+		CreatedBy:  createdBy,
+		CreatedAt:  strconv.FormatInt(time.Now().UTC().Unix(), 10),
 	}
 }
@@ -0,0 +1,171 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// Alias is another name an account can be addressed by.
+type Alias struct {
+	Alias   string
+	Account string
+}
+
+// AddAlias links alias to an account of the chat. Aliases are matched by
+// model.NormalizeName; ErrAccountExists is returned when the alias is
+// already in use.
+func (s *Storage) AddAlias(ctx context.Context, chatID int64, accountID int, alias string) error {
+	key := model.NormalizeName(alias)
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var taken int
+		const sel = `SELECT COUNT(*) FROM account_aliases WHERE chat_id = ? AND alias_key = ?`
+		if err := tx.QueryRowContext(ctx, sel, chatID, key).Scan(&taken); err != nil {
+			return fmt.Errorf("check alias: %w", err)
+		}
+		if taken > 0 {
+			return ErrAccountExists
+		}
+
+		const ins = `
+			INSERT INTO account_aliases(chat_id, alias_key, alias, account_id, created_at)
+			VALUES(?, ?, ?, ?, ?)
+		`
+		now := strconv.FormatInt(time.Now().UTC().Unix(), 10)
+		if _, err := tx.ExecContext(ctx, ins, chatID, key, alias, accountID, now); err != nil {
+			return fmt.Errorf("insert alias: %w", err)
+		}
+		return nil
+	})
+}
+
+// NameUse is an account a name already refers to.
+type NameUse struct {
+	Account  string
+	Archived bool
+	// Alias is set when the name is an alias of the account rather than
+	// its name.
+	Alias bool
+}
+
+// NameInUse returns the account that name already refers to once
+// normalized, by its name or an alias, or ErrNotFound when it is free.
+// Archived accounts count.
+func (s *Storage) NameInUse(ctx context.Context, chatID int64, name string) (*NameUse, error) {
+	return nameInUse(ctx, s.db, chatID, name, 0)
+}
+
+// nameInUse is NameInUse ignoring the account with id except, so an
+// account can be renamed to a spelling of its own name or alias.
+func nameInUse(ctx context.Context, q queryer, chatID int64, name string, except int) (*NameUse, error) {
+	key := model.NormalizeName(name)
+
+	rows, err := q.QueryContext(ctx, `SELECT id, name, archived_at IS NOT NULL FROM accounts WHERE chat_id = ?`, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("query accounts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			id  int
+			use NameUse
+		)
+		if err := rows.Scan(&id, &use.Account, &use.Archived); err != nil {
+			return nil, fmt.Errorf("scan account: %w", err)
+		}
+		if id != except && model.NormalizeName(use.Account) == key {
+			return &use, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	rows.Close()
+
+	const alias = `
+		SELECT a.name, a.archived_at IS NOT NULL
+		FROM account_aliases al
+		JOIN accounts a ON a.id = al.account_id
+		WHERE al.chat_id = ? AND al.alias_key = ? AND a.id != ?
+	`
+	use := NameUse{Alias: true}
+	err = q.QueryRowContext(ctx, alias, chatID, key, except).Scan(&use.Account, &use.Archived)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("check alias: %w", err)
+	}
+	return &use, nil
+}
+
+// RemoveAlias deletes an alias of the chat or returns ErrNotFound.
+func (s *Storage) RemoveAlias(ctx context.Context, chatID int64, alias string) error {
+	const q = `DELETE FROM account_aliases WHERE chat_id = ? AND alias_key = ?`
+
+	res, err := s.db.ExecContext(ctx, q, chatID, model.NormalizeName(alias))
+	if err != nil {
+		return fmt.Errorf("delete alias: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ResolveAlias returns the name of the active account an alias points to,
+// or ErrNotFound.
+func (s *Storage) ResolveAlias(ctx context.Context, chatID int64, alias string) (string, error) {
+	const q = `
+		SELECT a.name
+		FROM account_aliases al
+		JOIN accounts a ON a.id = al.account_id
+		WHERE al.chat_id = ? AND al.alias_key = ? AND a.archived_at IS NULL
+	`
+	var name string
+	err := s.db.QueryRowContext(ctx, q, chatID, model.NormalizeName(alias)).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("resolve alias: %w", err)
+	}
+	return name, nil
+}
+
+// ListAliases returns the aliases of the chat's active accounts.
+func (s *Storage) ListAliases(ctx context.Context, chatID int64) ([]Alias, error) {
+	const q = `
+		SELECT al.alias, a.name
+		FROM account_aliases al
+		JOIN accounts a ON a.id = al.account_id
+		WHERE al.chat_id = ? AND a.archived_at IS NULL
+		ORDER BY a.created_at ASC, al.alias ASC
+	`
+	rows, err := s.db.QueryContext(ctx, q, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("query aliases: %w", err)
+	}
+	defer rows.Close()
+
+	var out []Alias
+	for rows.Next() {
+		var a Alias
+		if err := rows.Scan(&a.Alias, &a.Account); err != nil {
+			return nil, fmt.Errorf("scan alias: %w", err)
+		}
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// ArchiveAccount hides an active account of the chat and makes it read-only.
+// Its transactions are kept. The account name is returned.
+func (s *Storage) ArchiveAccount(ctx context.Context, chatID int64, accountID int) (string, error) {
+	const q = `
+		UPDATE accounts
+		   SET archived_at = ?
+		 WHERE id = ? AND chat_id = ? AND archived_at IS NULL
+		 RETURNING name
+	`
+	var name string
+	err := s.db.QueryRowContext(ctx, q, time.Now().UTC().Unix(), accountID, chatID).Scan(&name)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("archive account: %w", err)
+	}
+	return name, nil
+}
+
+// RestoreAccount makes an archived account active again, or returns
+// ErrNotFound when the chat has no archived account with this name.
+func (s *Storage) RestoreAccount(ctx context.Context, chatID int64, name string) error {
+	const q = `UPDATE accounts SET archived_at = NULL WHERE chat_id = ? AND name = ? AND archived_at IS NOT NULL`
+
+	res, err := s.db.ExecContext(ctx, q, chatID, name)
+	if err != nil {
+		return fmt.Errorf("restore account: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("rows affected: %w", err)
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ArchivedAccount is an account together with the time it was archived.
+type ArchivedAccount struct {
+	model.Account
+	ArchivedAt time.Time
+}
+
+// ListArchived returns the archived accounts of the chat, oldest first.
+func (s *Storage) ListArchived(ctx context.Context, chatID int64) ([]ArchivedAccount, error) {
+	const q = `
+		SELECT id, name, chat_id, balance, currency, created_at, archived_at
+		FROM accounts
+		WHERE chat_id = ? AND archived_at IS NOT NULL
+		ORDER BY archived_at ASC, id ASC
+	`
+	rows, err := s.db.QueryContext(ctx, q, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("query archived: %w", err)
+	}
+	defer rows.Close()
+
+	var out []ArchivedAccount
+	for rows.Next() {
+		var (
+			a  ArchivedAccount
+			at int64
+		)
+		if err := rows.Scan(&a.Id, &a.Name, &a.ChatId, &a.Balance, &a.Currency, &a.CreatedAt, &at); err != nil {
+			return nil, fmt.Errorf("scan archived: %w", err)
+		}
+		a.ArchivedAt = time.Unix(at, 0)
+		out = append(out, a)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
+
+// PurgeArchived deletes the chat's accounts archived at or before the given
+// time, together with their transactions, and returns their names. Transfers
+// with a leg in a surviving account are unlinked first: transfer_id has no
+// foreign key, and the leg left behind becomes a plain entry.
+func (s *Storage) PurgeArchived(ctx context.Context, chatID int64, before time.Time) ([]string, error) {
+	var names []string
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		const unlink = `
+			UPDATE account_txns SET transfer_id = NULL
+			 WHERE transfer_id IN (
+				SELECT t.transfer_id FROM account_txns t
+				JOIN accounts a ON a.id = t.account_id
+				WHERE a.chat_id = ? AND a.archived_at IS NOT NULL AND a.archived_at <= ?
+				  AND t.transfer_id IS NOT NULL
+			 )
+		`
+		if _, err := tx.ExecContext(ctx, unlink, chatID, before.UTC().Unix()); err != nil {
+			return fmt.Errorf("unlink transfers: %w", err)
+		}
+
+		const q = `
+			DELETE FROM accounts
+			 WHERE chat_id = ? AND archived_at IS NOT NULL AND archived_at <= ?
+			 RETURNING name
+		`
+		rows, err := tx.QueryContext(ctx, q, chatID, before.UTC().Unix())
+		if err != nil {
+			return fmt.Errorf("purge accounts: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return fmt.Errorf("scan purged: %w", err)
+			}
+			names = append(names, name)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return names, nil
+}
@@ -0,0 +1,85 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func TestPurgeUnlinksTransfers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	src := addTestAccount(t, s, 1, "src")
+	addTestAccount(t, s, 1, "dst")
+
+	// Both directions, so the purged account holds the outgoing leg of one
+	// transfer and the incoming leg of the other.
+	out := model.NewTransaction(0, -1000, "", 0, "-10", 1)
+	in := model.NewTransaction(0, 1000, "", 0, "10", 1)
+	if _, err := s.Transfer(ctx, 1, "src", "dst", out, in); err != nil {
+		t.Fatal(err)
+	}
+	back := model.NewTransaction(0, -300, "", 0, "-3", 1)
+	got := model.NewTransaction(0, 300, "", 0, "3", 1)
+	if _, err := s.Transfer(ctx, 1, "dst", "src", back, got); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.ArchiveAccount(ctx, 1, src.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PurgeArchived(ctx, 1, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeArchived: %v", err)
+	}
+
+	for _, id := range []int{in.Id, back.Id} {
+		txn, err := s.GetTransaction(ctx, int64(id))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txn.TransferId != 0 {
+			t.Errorf("surviving leg %d still in transfer %d", id, txn.TransferId)
+		}
+	}
+
+	f, err := s.Backup(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("backup after purge: %v", err)
+	}
+}
+
+func TestMigrateUnlinkPurgedTransfers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	addTestAccount(t, s, 1, "src")
+	addTestAccount(t, s, 1, "dst")
+	out := model.NewTransaction(0, -1000, "", 0, "-10", 1)
+	in := model.NewTransaction(0, 1000, "", 0, "10", 1)
+	if _, err := s.Transfer(ctx, 1, "src", "dst", out, in); err != nil {
+		t.Fatal(err)
+	}
+
+	// A purge from before the fix deleted the leg and kept the link.
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM account_txns WHERE id = ?`, out.Id); err != nil {
+			return err
+		}
+		return migrateUnlinkPurgedTransfers(ctx, tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txn, err := s.GetTransaction(ctx, int64(in.Id))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txn.TransferId != 0 {
+		t.Errorf("leg of a deleted transfer still in transfer %d", txn.TransferId)
+	}
+}
@@ -0,0 +1,326 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/internal/backup"
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// ErrRestoreConflict is returned when names in a backup are already used in
+// the chat it is restored to.
+var ErrRestoreConflict = errors.New("backup names are taken in the chat")
+
+// errDryRun rolls back a restore that was only a rehearsal.
+var errDryRun = errors.New("dry run")
+
+// RestoreSummary counts what a restore adds to the chat.
+type RestoreSummary struct {
+	Accounts     int
+	Archived     int
+	Transactions int
+	Aliases      int
+	Rates        int
+	Members      int
+	Imports      int
+	// KeptMembers already had a role in the chat, which is left as is.
+	KeptMembers int
+	// Conflicts are the account names and aliases of the backup that the
+	// chat already uses.
+	Conflicts []string
+	// SameChat is set when the backup was made in this chat, so message
+	// links of transactions were kept.
+	SameChat bool
+}
+
+// Backup reads every record of the chat into a backup, in one read
+// transaction so that balances and transactions agree without holding up
+// the writes of other chats. A transfer link whose leg no longer exists is
+// left out, as backup.File.Validate would reject it.
+func (s *Storage) Backup(ctx context.Context, chatID int64) (*backup.File, error) {
+	f := &backup.File{
+		Format:    backup.Format,
+		Version:   backup.Version,
+		Schema:    migrations[len(migrations)-1].version,
+		ChatID:    chatID,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+	}
+	err := s.readTx(ctx, func(tx queryer) error {
+		const accounts = `
+			SELECT id, name, currency, balance, created_at, COALESCE(archived_at, 0)
+			FROM accounts WHERE chat_id = ? ORDER BY id
+		`
+		err := eachRow(ctx, tx, accounts, chatID, func(rows *sql.Rows) error {
+			var a backup.Account
+			err := rows.Scan(&a.ID, &a.Name, &a.Currency, &a.Balance, &a.CreatedAt, &a.ArchivedAt)
+			f.Accounts = append(f.Accounts, a)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("backup accounts: %w", err)
+		}
+
+		const txns = `
+			SELECT t.id, t.account_id, t.amount, t.balance, t.expression, COALESCE(t.note, ''), t.created_at,
+			       COALESCE(t.created_by, 0), COALESCE(p.id, 0), COALESCE(t.reverses_id, 0), t.reverted,
+			       COALESCE(t.source_msg_id, 0), COALESCE(t.reply_msg_id, 0), COALESCE(t.rate, ''), COALESCE(t.import_id, 0)
+			FROM account_txns t JOIN accounts a ON a.id = t.account_id
+			LEFT JOIN account_txns p ON p.id = t.transfer_id
+			WHERE a.chat_id = ? ORDER BY t.id
+		`
+		err = eachRow(ctx, tx, txns, chatID, func(rows *sql.Rows) error {
+			var t backup.Transaction
+			err := rows.Scan(&t.ID, &t.AccountID, &t.Amount, &t.Balance, &t.Expression, &t.Note, &t.CreatedAt,
+				&t.CreatedBy, &t.TransferID, &t.ReversesID, &t.Reverted, &t.SourceMsgID, &t.ReplyMsgID, &t.Rate, &t.ImportID)
+			f.Transactions = append(f.Transactions, t)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("backup transactions: %w", err)
+		}
+
+		const aliases = `SELECT alias, account_id, created_at FROM account_aliases WHERE chat_id = ? ORDER BY alias_key`
+		err = eachRow(ctx, tx, aliases, chatID, func(rows *sql.Rows) error {
+			var a backup.Alias
+			err := rows.Scan(&a.Alias, &a.AccountID, &a.CreatedAt)
+			f.Aliases = append(f.Aliases, a)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("backup aliases: %w", err)
+		}
+
+		const rates = `
+			SELECT base, quote, rate, valid_from, COALESCE(created_by, 0), created_at
+			FROM rates WHERE chat_id = ? ORDER BY id
+		`
+		err = eachRow(ctx, tx, rates, chatID, func(rows *sql.Rows) error {
+			var r backup.Rate
+			err := rows.Scan(&r.Base, &r.Quote, &r.Rate, &r.ValidFrom, &r.CreatedBy, &r.CreatedAt)
+			f.Rates = append(f.Rates, r)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("backup rates: %w", err)
+		}
+
+		const members = `SELECT user_id, name, role, updated_at FROM chat_members WHERE chat_id = ? ORDER BY user_id`
+		err = eachRow(ctx, tx, members, chatID, func(rows *sql.Rows) error {
+			var m backup.Member
+			var role model.Role
+			err := rows.Scan(&m.UserID, &m.Name, &role, &m.UpdatedAt)
+			m.Role = role.String()
+			f.Members = append(f.Members, m)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("backup members: %w", err)
+		}
+
+		const imports = `
+			SELECT id, account_id, source_msg_id, file_name, row_count, COALESCE(created_by, 0), created_at, reverted
+			FROM imports WHERE chat_id = ? AND account_id IS NOT NULL ORDER BY id
+		`
+		err = eachRow(ctx, tx, imports, chatID, func(rows *sql.Rows) error {
+			var im backup.Import
+			err := rows.Scan(&im.ID, &im.AccountID, &im.SourceMsgID, &im.FileName, &im.Rows, &im.CreatedBy, &im.CreatedAt, &im.Reverted)
+			f.Imports = append(f.Imports, im)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("backup imports: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// RestoreBackup adds the books of a validated backup to the chat, in one
+// transaction and under new ids. The chat may already have books of its
+// own, but none of the backup's account names or aliases: those are listed
+// in Conflicts and fail the restore with ErrRestoreConflict. Roles are only
+// added for users without one. Message ids mean nothing outside the chat
+// the backup was made in, so elsewhere transactions lose their message
+// links. With dryRun the restore is carried out and rolled back, so the
+// summary is exactly what a real run would do.
+func (s *Storage) RestoreBackup(ctx context.Context, chatID int64, f *backup.File, dryRun bool) (RestoreSummary, error) {
+	var sum RestoreSummary
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		sum = RestoreSummary{SameChat: f.ChatID == chatID}
+
+		// Names are compared as the bot resolves them, so neither a
+		// spelling of an existing name nor an alias can end up naming
+		// two accounts.
+		names := make([]string, 0, len(f.Accounts)+len(f.Aliases))
+		for _, a := range f.Accounts {
+			names = append(names, a.Name)
+		}
+		for _, al := range f.Aliases {
+			names = append(names, al.Alias)
+		}
+		for _, name := range names {
+			_, err := nameInUse(ctx, tx, chatID, name, 0)
+			if err == nil {
+				sum.Conflicts = append(sum.Conflicts, name)
+			} else if !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		if len(sum.Conflicts) > 0 {
+			return ErrRestoreConflict
+		}
+
+		accounts := make(map[int]int, len(f.Accounts))
+		for _, a := range f.Accounts {
+			const q = `
+				INSERT INTO accounts(name, chat_id, balance, currency, created_at, archived_at)
+				VALUES(?, ?, ?, ?, ?, ?)
+			`
+			archived := sql.NullInt64{Int64: a.ArchivedAt, Valid: a.ArchivedAt != 0}
+			res, err := tx.ExecContext(ctx, q, a.Name, chatID, a.Balance, a.Currency, a.CreatedAt, archived)
+			if err != nil {
+				return fmt.Errorf("insert account: %w", err)
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("last insert id: %w", err)
+			}
+			accounts[a.ID] = int(id)
+			if archived.Valid {
+				sum.Archived++
+			} else {
+				sum.Accounts++
+			}
+		}
+
+		imports := make(map[int]int, len(f.Imports))
+		for _, im := range f.Imports {
+			// Elsewhere the file's message id becomes a negative number no
+			// message has: minus one past the largest import id. Every
+			// earlier such number belongs to a row with an id at least as
+			// large, so it is still unique.
+			const q = `
+				INSERT INTO imports(chat_id, account_id, source_msg_id, file_name, row_count, created_by, created_at, reverted)
+				VALUES(?, ?, CASE WHEN ? THEN ? ELSE (SELECT -COALESCE(MAX(id), 0) - 1 FROM imports) END, ?, ?, ?, ?, ?)
+			`
+			res, err := tx.ExecContext(ctx, q, chatID, accounts[im.AccountID], sum.SameChat, im.SourceMsgID,
+				im.FileName, im.Rows, im.CreatedBy, im.CreatedAt, im.Reverted)
+			if err != nil {
+				return fmt.Errorf("insert import: %w", err)
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("last insert id: %w", err)
+			}
+			imports[im.ID] = int(id)
+			sum.Imports++
+		}
+
+		txns := make(map[int]int, len(f.Transactions))
+		for _, t := range f.Transactions {
+			txs := &model.Transaction{
+				AccountId:  accounts[t.AccountID],
+				Amount:     t.Amount,
+				Expression: t.Expression,
+				Note:       t.Note,
+				Balance:    t.Balance,
+				CreatedAt:  t.CreatedAt,
+				CreatedBy:  t.CreatedBy,
+				ReversesId: txns[t.ReversesID],
+				Rate:       t.Rate,
+				ImportId:   imports[t.ImportID],
+			}
+			if sum.SameChat {
+				txs.SourceMsgId, txs.ReplyMsgId = t.SourceMsgID, t.ReplyMsgID
+			}
+			id, err := s.addTransactionTx(ctx, tx, txs)
+			if err != nil {
+				return err
+			}
+			txns[t.ID] = int(id)
+			sum.Transactions++
+		}
+		// Transfer links may point forward, so they are set once every
+		// transaction has its new id.
+		for _, t := range f.Transactions {
+			if t.TransferID == 0 && !t.Reverted {
+				continue
+			}
+			const q = `UPDATE account_txns SET transfer_id = ?, reverted = ? WHERE id = ?`
+			if _, err := tx.ExecContext(ctx, q, nullID(txns[t.TransferID]), t.Reverted, txns[t.ID]); err != nil {
+				return fmt.Errorf("link transaction: %w", err)
+			}
+		}
+
+		for _, al := range f.Aliases {
+			const q = `
+				INSERT INTO account_aliases(chat_id, alias_key, alias, account_id, created_at)
+				VALUES(?, ?, ?, ?, ?)
+			`
+			if _, err := tx.ExecContext(ctx, q, chatID, model.NormalizeName(al.Alias), al.Alias, accounts[al.AccountID], al.CreatedAt); err != nil {
+				return fmt.Errorf("insert alias: %w", err)
+			}
+			sum.Aliases++
+		}
+
+		for _, r := range f.Rates {
+			const q = `
+				INSERT INTO rates(chat_id, base, quote, rate, valid_from, created_by, created_at)
+				VALUES(?, ?, ?, ?, ?, ?, ?)
+			`
+			if _, err := tx.ExecContext(ctx, q, chatID, r.Base, r.Quote, r.Rate, r.ValidFrom, r.CreatedBy, r.CreatedAt); err != nil {
+				return fmt.Errorf("insert rate: %w", err)
+			}
+			sum.Rates++
+		}
+
+		for _, m := range f.Members {
+			role, _ := model.ParseRole(m.Role)
+			const q = `
+				INSERT INTO chat_members(chat_id, user_id, name, role, updated_at)
+				VALUES(?, ?, ?, ?, ?)
+				ON CONFLICT(chat_id, user_id) DO NOTHING
+			`
+			res, err := tx.ExecContext(ctx, q, chatID, m.UserID, m.Name, role, m.UpdatedAt)
+			if err != nil {
+				return fmt.Errorf("insert member: %w", err)
+			}
+			if n, _ := res.RowsAffected(); n > 0 {
+				sum.Members++
+			} else {
+				sum.KeptMembers++
+			}
+		}
+
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	return sum, err
+}
+
+// eachRow runs a query with one argument and calls fn for every row.
+func eachRow(ctx context.Context, tx queryer, q string, arg any, fn func(rows *sql.Rows) error) error {
+	rows, err := tx.QueryContext(ctx, q, arg)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
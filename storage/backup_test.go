@@ -0,0 +1,279 @@
+package sqlite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/internal/backup"
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// fillBackupChat gives chat 1 a record of every kind a backup holds.
+func fillBackupChat(t *testing.T, s *Storage) {
+	t.Helper()
+	ctx := context.Background()
+	cash := addTestAccount(t, s, 1, "Наличные")
+	card := model.NewAccount("Карта", 1)
+	card.Currency = "USD"
+	if err := s.AddAccount(ctx, card); err != nil {
+		t.Fatal(err)
+	}
+
+	salary := model.NewTransaction(0, 0, "зарплата #доход", 0, "1000", 42)
+	salary.SourceMsgId = 100
+	if _, _, err := s.ApplyDeltaAndLog(ctx, 1, "Наличные", 100000, salary); err != nil {
+		t.Fatal(err)
+	}
+	out := model.NewTransaction(0, -30000, "", 0, "-300", 42)
+	in := model.NewTransaction(0, 333, "", 0, "3.33", 42)
+	in.Rate = "1/90"
+	if _, err := s.Transfer(ctx, 1, "Наличные", "Карта", out, in); err != nil {
+		t.Fatal(err)
+	}
+	lunch := model.NewTransaction(0, 0, "обед #еда", 0, "50", 42)
+	_, lunchID, err := s.ApplyDeltaAndLog(ctx, 1, "Наличные", -5000, lunch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.RevertTransaction(ctx, lunchID, 42); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.ImportTransactions(ctx, 1, cash.Id, 200, "old.csv", 42, importRows(time.Now().Add(time.Hour), 1250, -750)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.AddAlias(ctx, 1, cash.Id, "нал"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.AddRates(ctx, model.NewRate(1, "USD", "RUB", big.NewRat(90, 1), time.Now(), 42)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetRoles(ctx, model.ChatMember{ChatId: 1, UserId: 42, Name: "@ivan", Role: model.RoleOwner, UpdatedAt: "1700000000"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ArchiveAccount(ctx, 1, card.Id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// backupRecords lists the records of a backup without the ids of the
+// database it was made from: references are written as positions.
+func backupRecords(f *backup.File) []string {
+	accounts := make(map[int]string)
+	var out []string
+	for _, a := range f.Accounts {
+		accounts[a.ID] = a.Name
+		out = append(out, fmt.Sprintf("account %s %q %s archived=%v", a.Name, a.Currency, a.Balance, a.ArchivedAt != 0))
+	}
+	pos := make(map[int]int)
+	for i, t := range f.Transactions {
+		pos[t.ID] = i + 1
+	}
+	imports := make(map[int]int)
+	for i, im := range f.Imports {
+		imports[im.ID] = i + 1
+		out = append(out, fmt.Sprintf("import %s %q rows=%d reverted=%v", accounts[im.AccountID], im.FileName, im.Rows, im.Reverted))
+	}
+	for _, t := range f.Transactions {
+		out = append(out, fmt.Sprintf("txn %s %s=%s %q %q by=%d transfer=%d reverses=%d reverted=%v rate=%s import=%d at=%s",
+			accounts[t.AccountID], t.Expression, t.Amount, t.Balance, t.Note, t.CreatedBy,
+			pos[t.TransferID], pos[t.ReversesID], t.Reverted, t.Rate, imports[t.ImportID], t.CreatedAt))
+	}
+	for _, al := range f.Aliases {
+		out = append(out, fmt.Sprintf("alias %s %s", al.Alias, accounts[al.AccountID]))
+	}
+	for _, r := range f.Rates {
+		out = append(out, fmt.Sprintf("rate %s/%s %s from %s", r.Base, r.Quote, r.Rate, r.ValidFrom))
+	}
+	for _, m := range f.Members {
+		out = append(out, fmt.Sprintf("member %d %s %s", m.UserID, m.Name, m.Role))
+	}
+	return out
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	fillBackupChat(t, s)
+
+	src, err := s.Backup(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := backup.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	f, err := backup.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode of a fresh backup: %v", err)
+	}
+
+	want := RestoreSummary{Accounts: 1, Archived: 1, Transactions: 7, Aliases: 1, Rates: 1, Members: 1, Imports: 1}
+	sum, err := s.RestoreBackup(ctx, 2, f, true)
+	if err != nil || !summaryEqual(sum, want) {
+		t.Fatalf("dry run = %+v, %v; want %+v", sum, err, want)
+	}
+	if names, err := s.GetAll(ctx, 2); err != nil || len(names) != 0 {
+		t.Fatalf("dry run left accounts %v, %v", names, err)
+	}
+
+	sum, err = s.RestoreBackup(ctx, 2, f, false)
+	if err != nil || !summaryEqual(sum, want) {
+		t.Fatalf("restore = %+v, %v; want %+v", sum, err, want)
+	}
+
+	restored, err := s.Backup(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := backupRecords(restored), backupRecords(src); !slices.Equal(got, want) {
+		t.Errorf("restored records:\n%q\nwant:\n%q", got, want)
+	}
+	for _, txn := range restored.Transactions {
+		if txn.SourceMsgID != 0 || txn.ReplyMsgID != 0 {
+			t.Errorf("txn %d keeps message ids of another chat", txn.ID)
+		}
+	}
+	for _, im := range restored.Imports {
+		if im.SourceMsgID >= 0 {
+			t.Errorf("import keeps message id %d of another chat", im.SourceMsgID)
+		}
+	}
+	if ds, err := s.Reconcile(ctx, 2, false); err != nil || len(ds) != 0 {
+		t.Errorf("Reconcile of the restored chat = %+v, %v", ds, err)
+	}
+	if _, err := s.GetTag(ctx, 2, "доход"); err != nil {
+		t.Errorf("tag of a restored note: %v", err)
+	}
+
+	// The account and the import can be undone like the originals.
+	if _, _, err := s.RevertTransaction(ctx, int64(restored.Transactions[0].ID), 42); err != nil {
+		t.Errorf("undo of a restored transaction: %v", err)
+	}
+	if n, err := s.RevertImport(ctx, 2, int64(restored.Imports[0].ID), 42); err != nil || n != 2 {
+		t.Errorf("RevertImport of the restored import = %d, %v", n, err)
+	}
+}
+
+func summaryEqual(a, b RestoreSummary) bool {
+	return a.Accounts == b.Accounts && a.Archived == b.Archived && a.Transactions == b.Transactions &&
+		a.Aliases == b.Aliases && a.Rates == b.Rates && a.Members == b.Members && a.Imports == b.Imports &&
+		a.KeptMembers == b.KeptMembers && len(a.Conflicts) == len(b.Conflicts)
+}
+
+func TestRestoreConflicts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	fillBackupChat(t, s)
+	f, err := s.Backup(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sum, err := s.RestoreBackup(ctx, 1, f, true)
+	if !errors.Is(err, ErrRestoreConflict) || !slices.Equal(sum.Conflicts, []string{"Наличные", "Карта", "нал"}) {
+		t.Errorf("restore into the same chat = %q, %v", sum.Conflicts, err)
+	}
+
+	// Names clash once normalized, and with aliases as well as names.
+	other := addTestAccount(t, s, 3, "НАЛ")
+	if err := s.AddAlias(ctx, 3, other.Id, "карта"); err != nil {
+		t.Fatal(err)
+	}
+	sum, err = s.RestoreBackup(ctx, 3, f, false)
+	if !errors.Is(err, ErrRestoreConflict) || !slices.Equal(sum.Conflicts, []string{"Карта", "нал"}) {
+		t.Errorf("restore over normalized names = %q, %v", sum.Conflicts, err)
+	}
+	if names, err := s.GetAll(ctx, 3); err != nil || len(names) != 1 {
+		t.Errorf("failed restore left accounts %v, %v", names, err)
+	}
+}
+
+func TestBackupKeepsWritersGoing(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	fillBackupChat(t, s)
+
+	// A write while the backup's read transaction is open must not wait
+	// for it, and the backup must not see it.
+	var written bool
+	err := s.readTx(ctx, func(q queryer) error {
+		var n int
+		if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM account_txns`).Scan(&n); err != nil {
+			return err
+		}
+		wctx, cancel := context.WithTimeout(ctx, time.Second)
+		defer cancel()
+		txs := model.NewTransaction(0, 0, "", 0, "1", 42)
+		if _, _, err := s.ApplyDeltaAndLog(wctx, 1, "Наличные", 100, txs); err != nil {
+			return fmt.Errorf("write during a read transaction: %w", err)
+		}
+		written = true
+
+		var after int
+		if err := q.QueryRowContext(ctx, `SELECT COUNT(*) FROM account_txns`).Scan(&after); err != nil {
+			return err
+		}
+		if after != n {
+			return fmt.Errorf("read transaction saw %d rows, then %d", n, after)
+		}
+		return nil
+	})
+	if err != nil || !written {
+		t.Fatal(err)
+	}
+}
+
+func TestBackupAfterPurge(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	fillBackupChat(t, s)
+
+	// Карта is archived and takes one leg of the transfer with it.
+	purged, err := s.PurgeArchived(ctx, 1, time.Now().Add(time.Minute))
+	if err != nil || len(purged) != 1 {
+		t.Fatalf("PurgeArchived = %v, %v", purged, err)
+	}
+	// A link left dangling by a purge from before transfers were unlinked.
+	if _, err := s.db.ExecContext(ctx, `UPDATE account_txns SET transfer_id = 999 WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := s.Backup(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, txn := range src.Transactions {
+		if txn.TransferID != 0 {
+			t.Errorf("txn %d keeps transfer %d", txn.ID, txn.TransferID)
+		}
+	}
+	var buf bytes.Buffer
+	if err := backup.Encode(&buf, src); err != nil {
+		t.Fatal(err)
+	}
+	f, err := backup.Decode(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Decode of a backup after purge: %v", err)
+	}
+	if _, err := s.RestoreBackup(ctx, 2, f, false); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	restored, err := s.Backup(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := backupRecords(restored), backupRecords(src); !slices.Equal(got, want) {
+		t.Errorf("restored records:\n%q\nwant:\n%q", got, want)
+	}
+	if ds, err := s.Reconcile(ctx, 2, false); err != nil || len(ds) != 0 {
+		t.Errorf("Reconcile of the restored chat = %+v, %v", ds, err)
+	}
+}
@@ -0,0 +1,71 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// BalancePoint is an account's running balance right after a transaction.
+type BalancePoint struct {
+	At      time.Time
+	Balance model.Money
+}
+
+// BalanceSeries returns the running balance snapshots of an account over
+// [from, to), oldest first. Zero bounds are open. When from is set, the
+// series starts with the balance carried into the period, dated from, so
+// the line begins at the left edge even before the first transaction.
+func (s *Storage) BalanceSeries(ctx context.Context, accountID int, from, to time.Time) ([]BalancePoint, error) {
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	if !from.IsZero() {
+		lo = from.Unix()
+	}
+	if !to.IsZero() {
+		hi = to.Unix()
+	}
+
+	var out []BalancePoint
+	if !from.IsZero() {
+		var opening model.Money
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COALESCE((
+				SELECT balance FROM account_txns
+				WHERE account_id = ? AND CAST(created_at AS INTEGER) < ?
+				ORDER BY id DESC LIMIT 1
+			), 0)`, accountID, lo).Scan(&opening)
+		if err != nil {
+			return nil, fmt.Errorf("query opening balance: %w", err)
+		}
+		out = append(out, BalancePoint{At: from, Balance: opening})
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT CAST(created_at AS INTEGER), balance
+		FROM account_txns
+		WHERE account_id = ? AND CAST(created_at AS INTEGER) >= ? AND CAST(created_at AS INTEGER) < ?
+		ORDER BY id ASC`, accountID, lo, hi)
+	if err != nil {
+		return nil, fmt.Errorf("query balances: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			ts int64
+			p  BalancePoint
+		)
+		if err := rows.Scan(&ts, &p.Balance); err != nil {
+			return nil, fmt.Errorf("scan balance: %w", err)
+		}
+		p.At = time.Unix(ts, 0)
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
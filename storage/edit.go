@@ -0,0 +1,146 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// SetReplyMessage remembers the bot's confirmation message for a
+// transaction so it can be edited later.
+func (s *Storage) SetReplyMessage(ctx context.Context, txsId int64, msgID int) error {
+	const q = `UPDATE account_txns SET reply_msg_id = ? WHERE id = ?`
+	if _, err := s.db.ExecContext(ctx, q, msgID, txsId); err != nil {
+		return fmt.Errorf("set reply message: %w", err)
+	}
+	return nil
+}
+
+// FindBySourceMessage returns the transaction created from the given chat
+// message together with its account name, or ErrNotFound.
+func (s *Storage) FindBySourceMessage(ctx context.Context, chatID int64, msgID int) (*model.Transaction, string, error) {
+	const q = `
+		SELECT a.name, ` + txnColumns + `
+		FROM account_txns t
+		JOIN accounts a ON a.id = t.account_id
+		WHERE a.chat_id = ? AND t.source_msg_id = ? AND t.reverses_id IS NULL
+		ORDER BY t.id ASC
+		LIMIT 1
+	`
+
+	var name string
+	txs, err := scanTransaction(s.db.QueryRowContext(ctx, q, chatID, msgID), &name)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("select tx by message: %w", err)
+	}
+	return txs, name, nil
+}
+
+// EditTransaction replaces the amount, expression and note of txs.Id. The
+// difference to the old amount is added to the running balance of the
+// transaction and of every later one on the account, and to the account
+// balance. txs.Balance is updated.
+func (s *Storage) EditTransaction(ctx context.Context, txs *model.Transaction) error {
+	if txs == nil {
+		return fmt.Errorf("nil transaction")
+	}
+
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var (
+			oldAmount model.Money
+			accountID int
+			reverted  bool
+			archived  bool
+		)
+		const sel = `
+			SELECT t.amount, t.account_id, t.reverted, a.archived_at IS NOT NULL
+			FROM account_txns t
+			JOIN accounts a ON a.id = t.account_id
+			WHERE t.id = ?
+		`
+		if err := tx.QueryRowContext(ctx, sel, txs.Id).Scan(&oldAmount, &accountID, &reverted, &archived); err != nil {
+			return fmt.Errorf("select tx: %w", err)
+		}
+		if reverted {
+			return ErrAlreadyReverted
+		}
+		if archived {
+			return ErrArchived
+		}
+		diff := txs.Amount - oldAmount
+
+		const upd = `
+			UPDATE account_txns
+			   SET amount = ?, expression = ?, note = ?, balance = balance + ?
+			 WHERE id = ?
+			 RETURNING balance
+		`
+		if err := tx.QueryRowContext(ctx, upd, txs.Amount, txs.Expression, txs.Note, diff, txs.Id).Scan(&txs.Balance); err != nil {
+			return fmt.Errorf("update tx: %w", err)
+		}
+		if err := setTxnTagsTx(ctx, tx, int64(txs.Id), accountID, txs.Note); err != nil {
+			return err
+		}
+
+		if diff == 0 {
+			return nil
+		}
+
+		const later = `UPDATE account_txns SET balance = balance + ? WHERE account_id = ? AND id > ?`
+		if _, err := tx.ExecContext(ctx, later, diff, accountID, txs.Id); err != nil {
+			return fmt.Errorf("shift running balances: %w", err)
+		}
+
+		const acc = `UPDATE accounts SET balance = balance + ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, acc, diff, accountID); err != nil {
+			return fmt.Errorf("update balance: %w", err)
+		}
+		return nil
+	})
+}
+
+// txnColumns lists account_txns columns in the order scanTransaction reads
+// them; queries alias the table as t.
+const txnColumns = `t.id, t.account_id, t.amount, t.expression, t.note, t.balance, t.created_at,
+	t.created_by, t.transfer_id, t.reverses_id, t.reverted, t.source_msg_id, t.reply_msg_id, t.rate, t.import_id`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanTransaction reads txnColumns, preceded by any extra leading columns.
+func scanTransaction(row rowScanner, leading ...any) (*model.Transaction, error) {
+	var (
+		txs        model.Transaction
+		note       sql.NullString
+		createdBy  sql.NullInt64
+		transferID sql.NullInt64
+		reversesID sql.NullInt64
+		sourceMsg  sql.NullInt64
+		replyMsg   sql.NullInt64
+		rate       sql.NullString
+		importID   sql.NullInt64
+	)
+	dest := append(leading,
+		&txs.Id, &txs.AccountId, &txs.Amount, &txs.Expression, &note, &txs.Balance, &txs.CreatedAt,
+		&createdBy, &transferID, &reversesID, &txs.Reverted, &sourceMsg, &replyMsg, &rate, &importID,
+	)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+
+	txs.Note = note.String
+	txs.CreatedBy = createdBy.Int64
+	txs.TransferId = int(transferID.Int64)
+	txs.ReversesId = int(reversesID.Int64)
+	txs.SourceMsgId = int(sourceMsg.Int64)
+	txs.ReplyMsgId = int(replyMsg.Int64)
+	txs.Rate = rate.String
+	txs.ImportId = int(importID.Int64)
+	return &txs, nil
+}
@@ -0,0 +1,57 @@
+package sqlite
+
+import (
+	"strings"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// TxnFilter narrows down the transactions of one chat. Zero-valued fields
+// do not filter; To is exclusive.
+type TxnFilter struct {
+	ChatID    int64
+	AccountID int
+	From      time.Time
+	To        time.Time
+	// MinAmount and MaxAmount bound the absolute amount, inclusive.
+	MinAmount *model.Money
+	MaxAmount *model.Money
+	TagID     int
+}
+
+// where renders the filter as a WHERE clause over account_txns t joined
+// with accounts a.
+func (f TxnFilter) where() (string, []any) {
+	conds := []string{"a.chat_id = ?"}
+	args := []any{f.ChatID}
+
+	if f.AccountID != 0 {
+		conds = append(conds, "t.account_id = ?")
+		args = append(args, f.AccountID)
+	}
+	if !f.From.IsZero() {
+		conds = append(conds, "CAST(t.created_at AS INTEGER) >= ?")
+		args = append(args, f.From.Unix())
+	}
+	if !f.To.IsZero() {
+		conds = append(conds, "CAST(t.created_at AS INTEGER) < ?")
+		args = append(args, f.To.Unix())
+	}
+
+	if f.MinAmount != nil {
+		conds = append(conds, "ABS(t.amount) >= ?")
+		args = append(args, *f.MinAmount)
+	}
+	if f.MaxAmount != nil {
+		conds = append(conds, "ABS(t.amount) <= ?")
+		args = append(args, *f.MaxAmount)
+	}
+
+	if f.TagID != 0 {
+		conds = append(conds, "t.id IN (SELECT txn_id FROM txn_tags WHERE tag_id = ?)")
+		args = append(args, f.TagID)
+	}
+
+	return "WHERE " + strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,159 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// HistoryEntry is a transaction with the names needed to display it.
+type HistoryEntry struct {
+	*model.Transaction
+	Account  string
+	Currency string
+	// Author is the name of the member or of the user as last seen, empty
+	// when unknown.
+	Author string
+}
+
+// authorColumn and authorJoin read the name of a transaction's author: the
+// member's stored name, or else the one the user was last seen with.
+const (
+	authorColumn = `COALESCE(NULLIF(m.name, ''), u.name, '')`
+	authorJoin   = `
+		LEFT JOIN chat_members m ON m.chat_id = a.chat_id AND m.user_id = t.created_by
+		LEFT JOIN chat_users u ON u.chat_id = a.chat_id AND u.user_id = t.created_by`
+)
+
+// HistoryPage is one page of transactions, newest first.
+type HistoryPage struct {
+	Entries  []HistoryEntry
+	HasOlder bool
+	HasNewer bool
+}
+
+// History returns up to limit transactions matching filter using keyset
+// pagination on the transaction id: with before set, the page ends just
+// below that id; with after set, it starts just above it; with neither,
+// it is the newest page.
+func (s *Storage) History(ctx context.Context, filter TxnFilter, before, after int64, limit int) (HistoryPage, error) {
+	where, args := filter.where()
+	return s.historyPage(ctx, where, args, before, after, limit)
+}
+
+// historyPage is History over an arbitrary WHERE clause on account_txns t
+// joined with accounts a.
+func (s *Storage) historyPage(ctx context.Context, where string, args []any, before, after int64, limit int) (HistoryPage, error) {
+	base, baseArgs := where, args
+
+	order := "DESC"
+	switch {
+	case before > 0:
+		where += " AND t.id < ?"
+		args = append(slices.Clone(args), before)
+	case after > 0:
+		where += " AND t.id > ?"
+		args = append(slices.Clone(args), after)
+		order = "ASC"
+	}
+
+	q := `
+		SELECT a.name, a.currency, ` + authorColumn + `, ` + txnColumns + `
+		FROM account_txns t
+		JOIN accounts a ON a.id = t.account_id` + authorJoin + `
+		` + where + `
+		ORDER BY t.id ` + order + `
+		LIMIT ?
+	`
+	rows, err := s.db.QueryContext(ctx, q, append(args, limit+1)...)
+	if err != nil {
+		return HistoryPage{}, fmt.Errorf("query history: %w", err)
+	}
+	defer rows.Close()
+
+	var page HistoryPage
+	for rows.Next() {
+		var e HistoryEntry
+		if e.Transaction, err = scanTransaction(rows, &e.Account, &e.Currency, &e.Author); err != nil {
+			return HistoryPage{}, fmt.Errorf("scan history: %w", err)
+		}
+		page.Entries = append(page.Entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return HistoryPage{}, fmt.Errorf("rows error: %w", err)
+	}
+
+	more := len(page.Entries) > limit
+	if more {
+		page.Entries = page.Entries[:limit]
+	}
+	if order == "ASC" {
+		slices.Reverse(page.Entries)
+		page.HasNewer = more
+	} else {
+		page.HasOlder = more
+	}
+	if len(page.Entries) == 0 {
+		return page, nil
+	}
+
+	// The newest page has nothing newer; otherwise look past the end we
+	// did not walk towards.
+	if order == "ASC" {
+		page.HasOlder, err = s.txnExists(ctx, base, baseArgs, "t.id < ?", page.Entries[len(page.Entries)-1].Id)
+	} else if before > 0 {
+		page.HasNewer, err = s.txnExists(ctx, base, baseArgs, "t.id > ?", page.Entries[0].Id)
+	}
+	if err != nil {
+		return HistoryPage{}, err
+	}
+	return page, nil
+}
+
+func (s *Storage) txnExists(ctx context.Context, where string, args []any, cond string, id int) (bool, error) {
+	q := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM account_txns t
+			JOIN accounts a ON a.id = t.account_id
+			` + where + ` AND ` + cond + `
+		)
+	`
+	var ok bool
+	if err := s.db.QueryRowContext(ctx, q, append(slices.Clone(args), id)...).Scan(&ok); err != nil {
+		return false, fmt.Errorf("check more history: %w", err)
+	}
+	return ok, nil
+}
+
+// Transactions returns every transaction matching filter, oldest first.
+func (s *Storage) Transactions(ctx context.Context, filter TxnFilter) ([]HistoryEntry, error) {
+	where, args := filter.where()
+	q := `
+		SELECT a.name, a.currency, ` + authorColumn + `, ` + txnColumns + `
+		FROM account_txns t
+		JOIN accounts a ON a.id = t.account_id` + authorJoin + `
+		` + where + `
+		ORDER BY t.id ASC
+	`
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	var out []HistoryEntry
+	for rows.Next() {
+		var e HistoryEntry
+		if e.Transaction, err = scanTransaction(rows, &e.Account, &e.Currency, &e.Author); err != nil {
+			return nil, fmt.Errorf("scan transaction: %w", err)
+		}
+		out = append(out, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
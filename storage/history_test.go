@@ -0,0 +1,50 @@
+package sqlite
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func TestHistoryAuthors(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	addTestAccount(t, s, 1, "cash")
+
+	// 41 has a role, 42 was only seen and 43 never.
+	if err := s.SetRoles(ctx, model.ChatMember{ChatId: 1, UserId: 41, Name: "@owner", Role: model.RoleOwner}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SeenUser(ctx, 1, 41, "Owner Elsewhere"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SeenUser(ctx, 1, 42, "Иван"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SeenUser(ctx, 1, 42, "@ivan"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SeenUser(ctx, 2, 43, "@other_chat"); err != nil {
+		t.Fatal(err)
+	}
+	for _, by := range []int64{41, 42, 43} {
+		txn := model.NewTransaction(0, 100, "", 0, "1", by)
+		if _, _, err := s.ApplyDeltaAndLog(ctx, 1, "cash", 100, txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := s.Transactions(ctx, TxnFilter{ChatID: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Author)
+	}
+	if want := []string{"@owner", "@ivan", ""}; !slices.Equal(got, want) {
+		t.Errorf("authors %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,201 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+var (
+	// ErrAlreadyImported is returned when the file of a message was
+	// imported before.
+	ErrAlreadyImported = errors.New("file already imported")
+	// ErrBackdated is returned for an import with rows older than the
+	// latest transaction of the account.
+	ErrBackdated = errors.New("import predates the latest transaction")
+)
+
+// Import is a batch of transactions loaded from one uploaded file.
+type Import struct {
+	Id     int64
+	ChatId int64
+	// AccountId is 0 once the account has been purged.
+	AccountId   int
+	SourceMsgId int
+	FileName    string
+	Rows        int
+	CreatedBy   int64
+	Reverted    bool
+}
+
+// ImportTransactions appends txs to the account, in the given order, as
+// one batch continuing its running balance. sourceMsgID is the message
+// with the file; a second import of it fails with ErrAlreadyImported.
+// Running balances, charts and journals follow id order, so history can
+// only go after what the account already has: a row dated before its
+// latest transaction fails the import with ErrBackdated. The batch id and
+// the new balance are returned, and AccountId, ImportId, Balance and Id of
+// every transaction are filled in.
+func (s *Storage) ImportTransactions(ctx context.Context, chatID int64, accountID, sourceMsgID int, fileName string, createdBy int64, txs []*model.Transaction) (importID int64, balance model.Money, err error) {
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		var archived bool
+		const acc = `SELECT balance, archived_at IS NOT NULL FROM accounts WHERE id = ? AND chat_id = ?`
+		if err := tx.QueryRowContext(ctx, acc, accountID, chatID).Scan(&balance, &archived); err != nil {
+			if err == sql.ErrNoRows {
+				return ErrNotFound
+			}
+			return fmt.Errorf("select account: %w", err)
+		}
+		if archived {
+			return ErrArchived
+		}
+
+		var latest int64
+		if err := tx.QueryRowContext(ctx, latestTxnQuery, accountID).Scan(&latest); err != nil {
+			return fmt.Errorf("select latest txn: %w", err)
+		}
+		for _, t := range txs {
+			if at, _ := strconv.ParseInt(t.CreatedAt, 10, 64); at < latest {
+				return ErrBackdated
+			}
+		}
+
+		var exists bool
+		const dup = `SELECT EXISTS (SELECT 1 FROM imports WHERE chat_id = ? AND source_msg_id = ?)`
+		if err := tx.QueryRowContext(ctx, dup, chatID, sourceMsgID).Scan(&exists); err != nil {
+			return fmt.Errorf("check import: %w", err)
+		}
+		if exists {
+			return ErrAlreadyImported
+		}
+
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO imports(chat_id, account_id, source_msg_id, file_name, row_count, created_by, created_at)
+			VALUES(?, ?, ?, ?, ?, ?, ?)`,
+			chatID, accountID, sourceMsgID, fileName, len(txs), createdBy, strconv.FormatInt(time.Now().UTC().Unix(), 10),
+		)
+		if err != nil {
+			return fmt.Errorf("insert import: %w", err)
+		}
+		if importID, err = res.LastInsertId(); err != nil {
+			return fmt.Errorf("last insert id: %w", err)
+		}
+
+		for _, t := range txs {
+			balance += t.Amount
+			t.AccountId = accountID
+			t.ImportId = int(importID)
+			t.Balance = balance
+			if _, err := s.addTransactionTx(ctx, tx, t); err != nil {
+				return err
+			}
+		}
+
+		const upd = `UPDATE accounts SET balance = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, upd, balance, accountID); err != nil {
+			return fmt.Errorf("update balance: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return importID, balance, nil
+}
+
+const latestTxnQuery = `SELECT COALESCE(MAX(CAST(created_at AS INTEGER)), 0) FROM account_txns WHERE account_id = ?`
+
+// LatestTransactionTime returns when the latest transaction of an account
+// was made, or the zero time for an account without any.
+func (s *Storage) LatestTransactionTime(ctx context.Context, accountID int) (time.Time, error) {
+	var latest int64
+	if err := s.db.QueryRowContext(ctx, latestTxnQuery, accountID).Scan(&latest); err != nil {
+		return time.Time{}, fmt.Errorf("select latest txn: %w", err)
+	}
+	if latest == 0 {
+		return time.Time{}, nil
+	}
+	return time.Unix(latest, 0), nil
+}
+
+// GetImport returns an import of the chat by id, or ErrNotFound.
+func (s *Storage) GetImport(ctx context.Context, chatID, importID int64) (*Import, error) {
+	const q = `
+		SELECT id, chat_id, COALESCE(account_id, 0), source_msg_id, file_name, row_count, COALESCE(created_by, 0), reverted
+		FROM imports
+		WHERE id = ? AND chat_id = ?
+	`
+	var im Import
+	err := s.db.QueryRowContext(ctx, q, importID, chatID).Scan(
+		&im.Id, &im.ChatId, &im.AccountId, &im.SourceMsgId, &im.FileName, &im.Rows, &im.CreatedBy, &im.Reverted,
+	)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select import: %w", err)
+	}
+	return &im, nil
+}
+
+// RevertImport reverses every transaction of an import that is not
+// reverted yet, newest first, with reversal entries as undo does, and
+// marks the import reverted. It returns how many were reversed and fails
+// with ErrAlreadyReverted on a second call.
+func (s *Storage) RevertImport(ctx context.Context, chatID, importID, revertedBy int64) (reverted int, err error) {
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		const mark = `UPDATE imports SET reverted = 1 WHERE id = ? AND chat_id = ? AND reverted = 0`
+		res, err := tx.ExecContext(ctx, mark, importID, chatID)
+		if err != nil {
+			return fmt.Errorf("mark import reverted: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			var exists bool
+			const q = `SELECT EXISTS (SELECT 1 FROM imports WHERE id = ? AND chat_id = ?)`
+			if err := tx.QueryRowContext(ctx, q, importID, chatID).Scan(&exists); err != nil {
+				return fmt.Errorf("check import: %w", err)
+			}
+			if !exists {
+				return ErrNotFound
+			}
+			return ErrAlreadyReverted
+		}
+
+		const sel = `
+			SELECT id FROM account_txns
+			WHERE import_id = ? AND reverted = 0 AND reverses_id IS NULL
+			ORDER BY id DESC
+		`
+		rows, err := tx.QueryContext(ctx, sel, importID)
+		if err != nil {
+			return fmt.Errorf("query import txs: %w", err)
+		}
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan tx: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("rows error: %w", err)
+		}
+
+		for _, id := range ids {
+			if _, err := s.reverseTx(ctx, tx, id, revertedBy); err != nil {
+				return err
+			}
+		}
+		reverted = len(ids)
+		return nil
+	})
+	return reverted, err
+}
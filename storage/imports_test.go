@@ -0,0 +1,138 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func newTestStorage(t *testing.T) *Storage {
+	t.Helper()
+	s, err := New(filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	if err := s.Init(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func addTestAccount(t *testing.T, s *Storage, chatID int64, name string) *model.Account {
+	t.Helper()
+	acc := model.NewAccount(name, chatID)
+	if err := s.AddAccount(context.Background(), acc); err != nil {
+		t.Fatal(err)
+	}
+	return acc
+}
+
+func importRows(at time.Time, amounts ...model.Money) []*model.Transaction {
+	txs := make([]*model.Transaction, len(amounts))
+	for i, a := range amounts {
+		t := model.NewTransaction(0, a, "", 0, a.String(), 1)
+		t.CreatedAt = strconv.FormatInt(at.Add(time.Duration(i)*time.Hour).Unix(), 10)
+		txs[i] = t
+	}
+	return txs
+}
+
+func TestImportMergePurge(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	addTestAccount(t, s, 1, "old")
+	dst := addTestAccount(t, s, 1, "main")
+	src, err := s.GetAccount(ctx, 1, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	importID, _, err := s.ImportTransactions(ctx, 1, src.Id, 10, "old.csv", 1, importRows(time.Now().Add(-48*time.Hour), 100, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MergeAccounts(ctx, 1, "old", "main"); err != nil {
+		t.Fatal(err)
+	}
+	im, err := s.GetImport(ctx, 1, importID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.AccountId != dst.Id {
+		t.Errorf("import on account %d after merge, want %d", im.AccountId, dst.Id)
+	}
+
+	purged, err := s.PurgeArchived(ctx, 1, time.Now().Add(time.Minute))
+	if err != nil {
+		t.Fatalf("PurgeArchived: %v", err)
+	}
+	if len(purged) != 1 || purged[0] != "old" {
+		t.Errorf("purged %v, want [old]", purged)
+	}
+	if n, err := s.RevertImport(ctx, 1, importID, 1); err != nil || n != 2 {
+		t.Errorf("RevertImport = %d, %v; want 2 rows", n, err)
+	}
+}
+
+func TestPurgeKeepsImport(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	acc := addTestAccount(t, s, 1, "cash")
+
+	importID, _, err := s.ImportTransactions(ctx, 1, acc.Id, 10, "cash.csv", 1, importRows(time.Now().Add(-time.Hour), 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ArchiveAccount(ctx, 1, acc.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.PurgeArchived(ctx, 1, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("PurgeArchived: %v", err)
+	}
+
+	im, err := s.GetImport(ctx, 1, importID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if im.AccountId != 0 {
+		t.Errorf("import on account %d after purge, want 0", im.AccountId)
+	}
+	other := addTestAccount(t, s, 1, "bank")
+	if _, _, err := s.ImportTransactions(ctx, 1, other.Id, 10, "cash.csv", 1, importRows(time.Now(), 100)); !errors.Is(err, ErrAlreadyImported) {
+		t.Errorf("second import of the message: %v, want ErrAlreadyImported", err)
+	}
+}
+
+func TestImportBackdated(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	acc := addTestAccount(t, s, 1, "cash")
+
+	now := time.Now().Truncate(time.Second)
+	if _, _, err := s.ImportTransactions(ctx, 1, acc.Id, 10, "", 1, importRows(now.Add(-time.Hour), 100)); err != nil {
+		t.Fatal(err)
+	}
+	latest, err := s.LatestTransactionTime(ctx, acc.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !latest.Equal(now.Add(-time.Hour)) {
+		t.Errorf("LatestTransactionTime = %v, want %v", latest, now.Add(-time.Hour))
+	}
+
+	if _, _, err := s.ImportTransactions(ctx, 1, acc.Id, 11, "", 1, importRows(now.Add(-2*time.Hour), 100, 100)); !errors.Is(err, ErrBackdated) {
+		t.Errorf("back-dated import: %v, want ErrBackdated", err)
+	}
+	if _, _, err := s.ImportTransactions(ctx, 1, acc.Id, 12, "", 1, importRows(now.Add(-time.Hour), 100)); err != nil {
+		t.Errorf("import at the latest time: %v", err)
+	}
+	if bal, err := s.GetCurrentBalance(ctx, acc.Id); err != nil || bal != 200 {
+		t.Errorf("balance %s, %v; want 2.00", bal, err)
+	}
+}
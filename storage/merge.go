@@ -0,0 +1,116 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+var (
+	ErrAccountExists    = errors.New("account already exists")
+	ErrCurrencyMismatch = errors.New("accounts have different currencies")
+)
+
+// RenameAccount changes the name of an active account. Its id and
+// transactions are kept. It fails with ErrNotFound when there is no such
+// account and ErrAccountExists when the new name, once normalized, is the
+// name or an alias of another account, archived accounts included.
+func (s *Storage) RenameAccount(ctx context.Context, chatID int64, oldName, newName string) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		var id int
+		const sel = `SELECT id FROM accounts WHERE chat_id = ? AND name = ? AND archived_at IS NULL`
+		err := tx.QueryRowContext(ctx, sel, chatID, oldName).Scan(&id)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("select account: %w", err)
+		}
+
+		_, err = nameInUse(ctx, tx, chatID, newName, id)
+		if err == nil {
+			return ErrAccountExists
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		const upd = `UPDATE accounts SET name = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, upd, newName, id); err != nil {
+			return fmt.Errorf("rename account: %w", err)
+		}
+		return nil
+	})
+}
+
+// MergeResult describes a completed merge.
+type MergeResult struct {
+	Moved   int
+	Balance model.Money
+}
+
+// MergeAccounts moves every transaction, alias and import of src into dst,
+// rebuilds the running balances of dst in id order and archives src with a
+// zero balance. Both accounts must be active and share a currency.
+func (s *Storage) MergeAccounts(ctx context.Context, chatID int64, src, dst string) (MergeResult, error) {
+	var out MergeResult
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var accs [2]model.Account
+		for i, name := range []string{src, dst} {
+			const q = `SELECT id, currency FROM accounts WHERE chat_id = ? AND name = ? AND archived_at IS NULL`
+			err := tx.QueryRowContext(ctx, q, chatID, name).Scan(&accs[i].Id, &accs[i].Currency)
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("%s: %w", name, ErrNotFound)
+			}
+			if err != nil {
+				return fmt.Errorf("select account: %w", err)
+			}
+		}
+		if accs[0].Currency != accs[1].Currency {
+			return ErrCurrencyMismatch
+		}
+		srcID, dstID := accs[0].Id, accs[1].Id
+
+		const move = `UPDATE account_txns SET account_id = ? WHERE account_id = ?`
+		res, err := tx.ExecContext(ctx, move, dstID, srcID)
+		if err != nil {
+			return fmt.Errorf("move txs: %w", err)
+		}
+		moved, _ := res.RowsAffected()
+		out.Moved = int(moved)
+
+		const aliases = `UPDATE account_aliases SET account_id = ? WHERE account_id = ?`
+		if _, err := tx.ExecContext(ctx, aliases, dstID, srcID); err != nil {
+			return fmt.Errorf("move aliases: %w", err)
+		}
+		const imports = `UPDATE imports SET account_id = ? WHERE account_id = ?`
+		if _, err := tx.ExecContext(ctx, imports, dstID, srcID); err != nil {
+			return fmt.Errorf("move imports: %w", err)
+		}
+
+		_, sum, err := rebuildRunningBalancesTx(ctx, tx, dstID, true)
+		if err != nil {
+			return err
+		}
+		out.Balance = sum
+
+		const setDst = `UPDATE accounts SET balance = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, setDst, sum, dstID); err != nil {
+			return fmt.Errorf("update balance: %w", err)
+		}
+		const archive = `UPDATE accounts SET balance = 0, archived_at = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, archive, time.Now().UTC().Unix(), srcID); err != nil {
+			return fmt.Errorf("archive source: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return MergeResult{}, err
+	}
+	return out, nil
+}
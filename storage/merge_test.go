@@ -0,0 +1,76 @@
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestNameInUse(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	cash := addTestAccount(t, s, 1, "Наличные")
+	card := addTestAccount(t, s, 1, "Карта")
+	if err := s.AddAlias(ctx, 1, cash.Id, "нал"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.ArchiveAccount(ctx, 1, card.Id); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		want *NameUse
+	}{
+		{"наличные", &NameUse{Account: "Наличные"}},
+		{" НАЛИЧНЫЕ ", &NameUse{Account: "Наличные"}},
+		{"Нал", &NameUse{Account: "Наличные", Alias: true}},
+		{"карта", &NameUse{Account: "Карта", Archived: true}},
+		{"банк", nil},
+	}
+	for _, tt := range tests {
+		got, err := s.NameInUse(ctx, 1, tt.name)
+		if tt.want == nil {
+			if !errors.Is(err, ErrNotFound) {
+				t.Errorf("NameInUse(%q) = %v, %v; want ErrNotFound", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || *got != *tt.want {
+			t.Errorf("NameInUse(%q) = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := s.NameInUse(ctx, 2, "наличные"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("name of another chat: %v, want ErrNotFound", err)
+	}
+}
+
+func TestRenameAccountConflicts(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	cash := addTestAccount(t, s, 1, "Наличные")
+	addTestAccount(t, s, 1, "Карта")
+	if err := s.AddAlias(ctx, 1, cash.Id, "нал"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"карта", "КАРТА", " Карта"} {
+		if err := s.RenameAccount(ctx, 1, "Наличные", name); !errors.Is(err, ErrAccountExists) {
+			t.Errorf("rename to %q: %v, want ErrAccountExists", name, err)
+		}
+	}
+	if err := s.RenameAccount(ctx, 1, "Карта", "Нал"); !errors.Is(err, ErrAccountExists) {
+		t.Errorf("rename to an alias of another account: %v, want ErrAccountExists", err)
+	}
+
+	// A new spelling of the account's own name or alias is not a conflict.
+	if err := s.RenameAccount(ctx, 1, "Наличные", "наличные"); err != nil {
+		t.Errorf("rename to own name in lower case: %v", err)
+	}
+	if err := s.RenameAccount(ctx, 1, "наличные", "Нал"); err != nil {
+		t.Errorf("rename to own alias: %v", err)
+	}
+	if err := s.RenameAccount(ctx, 1, "Наличные", "x"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("rename of a missing account: %v, want ErrNotFound", err)
+	}
+}
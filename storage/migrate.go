@@ -0,0 +1,475 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// ErrSchemaTooNew is returned by Init when the database has migrations
+// applied that this binary does not know about.
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+type migration struct {
+	version int
+	name    string
+	up      func(ctx context.Context, tx *sql.Tx) error
+}
+
+// migrations are applied in order, each in its own transaction. Append new
+// steps to the end and never edit or reorder the ones already released.
+var migrations = []migration{
+	{1, "initial schema", migrateInitialSchema},
+	{2, "money as integer minor units", migrateMinorUnits},
+	{3, "transfer links", migrateTransferLinks},
+	{4, "reversal entries", migrateReversals},
+	{5, "source messages", migrateSourceMessages},
+	{6, "account currency", migrateAccountCurrency},
+	{7, "exchange rates", migrateRates},
+	{8, "chat member roles", migrateRoles},
+	{9, "archived accounts", migrateArchivedAccounts},
+	{10, "account aliases", migrateAliases},
+	{11, "transactions by account", migrateTxnAccountIndex},
+	{12, "transaction tags", migrateTags},
+	{13, "csv imports", migrateImports},
+	{14, "imports outlive accounts", migrateImportAccountSetNull},
+	{15, "unlink purged transfer legs", migrateUnlinkPurgedTransfers},
+	{16, "chat user names", migrateChatUsers},
+}
+
+// migrate brings the schema up to the latest version. Steps run on a single
+// connection with foreign keys disabled, so tables can be rebuilt without
+// triggering ON DELETE CASCADE.
+func (s *Storage) migrate(ctx context.Context) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get conn: %w", err)
+	}
+	defer conn.Close()
+
+	const createQ = `
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		name       TEXT    NOT NULL,
+		applied_at TEXT    NOT NULL
+	);`
+	if _, err := conn.ExecContext(ctx, createQ); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	const verQ = `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`
+	if err := conn.QueryRowContext(ctx, verQ).Scan(&current); err != nil {
+		return fmt.Errorf("select schema version: %w", err)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("%w: database at version %d, binary supports %d", ErrSchemaTooNew, current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	// The pragma is a no-op inside a transaction, so it is set beforehand.
+	if _, err := conn.ExecContext(ctx, `PRAGMA foreign_keys = OFF`); err != nil {
+		return fmt.Errorf("disable foreign keys: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), `PRAGMA foreign_keys = ON`)
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(ctx, conn, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, m migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if err := m.up(ctx, tx); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations(version, name, applied_at) VALUES(?, ?, ?)`,
+		m.version, m.name, time.Now().UTC().Format(time.RFC3339),
+	)
+	if err != nil {
+		return fmt.Errorf("record version: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
+func execAll(ctx context.Context, tx *sql.Tx, steps ...string) error {
+	for _, q := range steps {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateInitialSchema(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE IF NOT EXISTS accounts (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			name       TEXT    NOT NULL,
+			chat_id    INTEGER NOT NULL,
+			balance    INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT    NOT NULL,
+			UNIQUE(chat_id, name)
+		)`,
+		`CREATE TABLE IF NOT EXISTS account_txns (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_id  INTEGER NOT NULL
+			REFERENCES accounts(id) ON DELETE CASCADE,
+			amount      INTEGER NOT NULL,
+			expression  TEXT    NOT NULL,
+			balance     INTEGER NOT NULL,
+			note        TEXT,
+			created_at  TEXT    NOT NULL,
+			created_by  INTEGER
+		)`,
+	)
+}
+
+// migrateMinorUnits converts databases created before amounts were stored
+// as integers. SQLite cannot change a column type in place, so both tables
+// are rebuilt and copied with amounts rounded to the nearest kopeck.
+// Balances are then summed from the rounded amounts rather than rounded on
+// their own, which could leave them a kopeck or more off their entries.
+// Transactions of accounts deleted while foreign keys were not enforced on
+// every connection are dropped, as they are no longer reachable anyway.
+func migrateMinorUnits(ctx context.Context, tx *sql.Tx) error {
+	typ, err := columnType(ctx, tx, "accounts", "balance")
+	if err != nil {
+		return err
+	}
+	if typ != "REAL" {
+		return nil
+	}
+
+	return execAll(ctx, tx,
+		`CREATE TABLE account_txns_new (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			account_id  INTEGER NOT NULL
+			REFERENCES accounts(id) ON DELETE CASCADE,
+			amount      INTEGER NOT NULL,
+			expression  TEXT    NOT NULL,
+			balance     INTEGER NOT NULL,
+			note        TEXT,
+			created_at  TEXT    NOT NULL,
+			created_by  INTEGER
+		)`,
+		`INSERT INTO account_txns_new(id, account_id, amount, expression, balance, note, created_at, created_by)
+		 SELECT id, account_id, CAST(ROUND(amount * 100) AS INTEGER), expression,
+		        CAST(ROUND(balance * 100) AS INTEGER), note, created_at, created_by
+		   FROM account_txns
+		  WHERE account_id IN (SELECT id FROM accounts)`,
+		`DROP TABLE account_txns`,
+		`ALTER TABLE account_txns_new RENAME TO account_txns`,
+		`CREATE TABLE accounts_new (
+			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			name       TEXT    NOT NULL,
+			chat_id    INTEGER NOT NULL,
+			balance    INTEGER NOT NULL DEFAULT 0,
+			created_at TEXT    NOT NULL,
+			UNIQUE(chat_id, name)
+		)`,
+		`INSERT INTO accounts_new(id, name, chat_id, balance, created_at)
+		 SELECT id, name, chat_id, CAST(ROUND(balance * 100) AS INTEGER), created_at
+		   FROM accounts`,
+		`DROP TABLE accounts`,
+		`ALTER TABLE accounts_new RENAME TO accounts`,
+		`UPDATE account_txns SET balance = r.balance
+		   FROM (SELECT id, SUM(amount) OVER (PARTITION BY account_id ORDER BY id) AS balance
+		           FROM account_txns) r
+		  WHERE r.id = account_txns.id`,
+		`UPDATE accounts SET balance = COALESCE(
+			(SELECT SUM(amount) FROM account_txns WHERE account_id = accounts.id), 0)`,
+	)
+}
+
+func migrateTransferLinks(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE account_txns ADD COLUMN transfer_id INTEGER`,
+		`CREATE INDEX account_txns_transfer_id ON account_txns(transfer_id)`,
+	)
+}
+
+func migrateReversals(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE account_txns ADD COLUMN reverses_id INTEGER REFERENCES account_txns(id)`,
+		`ALTER TABLE account_txns ADD COLUMN reverted INTEGER NOT NULL DEFAULT 0`,
+		`CREATE UNIQUE INDEX account_txns_reverses_id ON account_txns(reverses_id)`,
+	)
+}
+
+func migrateSourceMessages(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE account_txns ADD COLUMN source_msg_id INTEGER`,
+		`ALTER TABLE account_txns ADD COLUMN reply_msg_id INTEGER`,
+		`CREATE INDEX account_txns_source_msg_id ON account_txns(source_msg_id)`,
+	)
+}
+
+func migrateAccountCurrency(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE accounts ADD COLUMN currency TEXT NOT NULL DEFAULT ''`,
+	)
+}
+
+func migrateRates(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE rates (
+			id          INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id     INTEGER NOT NULL,
+			base        TEXT    NOT NULL,
+			quote       TEXT    NOT NULL,
+			rate        TEXT    NOT NULL,
+			valid_from  TEXT    NOT NULL,
+			created_by  INTEGER,
+			created_at  TEXT    NOT NULL
+		)`,
+		`CREATE INDEX rates_pair ON rates(chat_id, base, quote, valid_from)`,
+		`ALTER TABLE account_txns ADD COLUMN rate TEXT`,
+	)
+}
+
+func migrateRoles(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE chat_members (
+			chat_id     INTEGER NOT NULL,
+			user_id     INTEGER NOT NULL,
+			name        TEXT    NOT NULL DEFAULT '',
+			role        INTEGER NOT NULL,
+			updated_at  TEXT    NOT NULL,
+			PRIMARY KEY(chat_id, user_id)
+		)`,
+	)
+}
+
+func migrateArchivedAccounts(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`ALTER TABLE accounts ADD COLUMN archived_at INTEGER`,
+	)
+}
+
+func migrateAliases(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE account_aliases (
+			chat_id     INTEGER NOT NULL,
+			alias_key   TEXT    NOT NULL,
+			alias       TEXT    NOT NULL,
+			account_id  INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+			created_at  TEXT    NOT NULL,
+			PRIMARY KEY(chat_id, alias_key)
+		)`,
+		`CREATE INDEX account_aliases_account ON account_aliases(account_id)`,
+	)
+}
+
+func migrateTxnAccountIndex(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE INDEX account_txns_account ON account_txns(account_id, id)`,
+	)
+}
+
+func migrateTags(ctx context.Context, tx *sql.Tx) error {
+	err := execAll(ctx, tx,
+		`CREATE TABLE tags (
+			id       INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id  INTEGER NOT NULL,
+			name     TEXT    NOT NULL,
+			UNIQUE(chat_id, name)
+		)`,
+		`CREATE TABLE txn_tags (
+			txn_id  INTEGER NOT NULL REFERENCES account_txns(id) ON DELETE CASCADE,
+			tag_id  INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			PRIMARY KEY(txn_id, tag_id)
+		)`,
+		`CREATE INDEX txn_tags_tag ON txn_tags(tag_id)`,
+	)
+	if err != nil {
+		return err
+	}
+
+	// Tag the hashtags already written in notes.
+	rows, err := tx.QueryContext(ctx, `SELECT id, account_id, note FROM account_txns WHERE note LIKE '%#%'`)
+	if err != nil {
+		return fmt.Errorf("query notes: %w", err)
+	}
+	type noted struct {
+		id        int64
+		accountID int
+		note      string
+	}
+	var all []noted
+	for rows.Next() {
+		var n noted
+		if err := rows.Scan(&n.id, &n.accountID, &n.note); err != nil {
+			rows.Close()
+			return fmt.Errorf("scan note: %w", err)
+		}
+		all = append(all, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+
+	for _, n := range all {
+		seen := make(map[string]bool)
+		for _, m := range tagsV12Hashtag.FindAllStringSubmatch(n.note, -1) {
+			tag := tagsV12Name(m[1])
+			if seen[tag] {
+				continue
+			}
+			seen[tag] = true
+
+			const ins = `INSERT OR IGNORE INTO tags(chat_id, name) SELECT chat_id, ? FROM accounts WHERE id = ?`
+			if _, err := tx.ExecContext(ctx, ins, tag, n.accountID); err != nil {
+				return fmt.Errorf("insert tag: %w", err)
+			}
+			const link = `
+				INSERT OR IGNORE INTO txn_tags(txn_id, tag_id)
+				SELECT ?, g.id
+				FROM tags g
+				JOIN accounts a ON a.chat_id = g.chat_id
+				WHERE a.id = ? AND g.name = ?
+			`
+			if _, err := tx.ExecContext(ctx, link, n.id, n.accountID, tag); err != nil {
+				return fmt.Errorf("link tag: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// tagsV12Hashtag and tagsV12Name are model.ParseTags and
+// model.NormalizeName as migration 12 was released with. They are copied
+// so that later changes to the live parsing do not change what the
+// migration writes.
+var tagsV12Hashtag = regexp.MustCompile(`#([\p{L}\p{N}_]+)`)
+
+func tagsV12Name(s string) string {
+	s = norm.NFKC.String(strings.TrimSpace(s))
+	s = strings.ToLower(s)
+	return strings.ReplaceAll(s, "ё", "е")
+}
+
+func columnType(ctx context.Context, tx *sql.Tx, table, column string) (string, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT name, type FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return "", fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, typ string
+		if err := rows.Scan(&name, &typ); err != nil {
+			return "", fmt.Errorf("scan table info: %w", err)
+		}
+		if name == column {
+			return strings.ToUpper(typ), nil
+		}
+	}
+	return "", rows.Err()
+}
+
+func migrateImports(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE imports (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id        INTEGER NOT NULL,
+			account_id     INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+			source_msg_id  INTEGER NOT NULL,
+			file_name      TEXT    NOT NULL DEFAULT '',
+			row_count      INTEGER NOT NULL,
+			created_by     INTEGER,
+			created_at     TEXT    NOT NULL,
+			reverted       INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(chat_id, source_msg_id)
+		)`,
+		`ALTER TABLE account_txns ADD COLUMN import_id INTEGER REFERENCES imports(id)`,
+		`CREATE INDEX account_txns_import ON account_txns(import_id) WHERE import_id IS NOT NULL`,
+	)
+}
+
+// migrateImportAccountSetNull stops deleting imports with their account.
+// Their transactions may have been merged into another account, and the
+// cascade then failed on the import_id references left behind; the batch
+// row is also what keeps a file from being imported twice. Imports left on
+// a merged account are moved to where their transactions went.
+func migrateImportAccountSetNull(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`UPDATE imports SET account_id = (
+			SELECT t.account_id FROM account_txns t WHERE t.import_id = imports.id LIMIT 1
+		) WHERE EXISTS (SELECT 1 FROM account_txns t WHERE t.import_id = imports.id)`,
+		`CREATE TABLE imports_new (
+			id             INTEGER PRIMARY KEY AUTOINCREMENT,
+			chat_id        INTEGER NOT NULL,
+			account_id     INTEGER REFERENCES accounts(id) ON DELETE SET NULL,
+			source_msg_id  INTEGER NOT NULL,
+			file_name      TEXT    NOT NULL DEFAULT '',
+			row_count      INTEGER NOT NULL,
+			created_by     INTEGER,
+			created_at     TEXT    NOT NULL,
+			reverted       INTEGER NOT NULL DEFAULT 0,
+			UNIQUE(chat_id, source_msg_id)
+		)`,
+		`INSERT INTO imports_new(id, chat_id, account_id, source_msg_id, file_name, row_count, created_by, created_at, reverted)
+		 SELECT id, chat_id, account_id, source_msg_id, file_name, row_count, created_by, created_at, reverted FROM imports`,
+		`DROP TABLE imports`,
+		`ALTER TABLE imports_new RENAME TO imports`,
+	)
+}
+
+// migrateUnlinkPurgedTransfers clears the transfer_id of legs whose partner
+// was deleted with a purged account. Every transfer, and every reversal of
+// one, has two legs, so a group with a single row left is broken.
+func migrateUnlinkPurgedTransfers(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`UPDATE account_txns SET transfer_id = NULL
+		  WHERE transfer_id IN (
+			SELECT transfer_id FROM account_txns
+			WHERE transfer_id IS NOT NULL
+			GROUP BY transfer_id HAVING COUNT(*) < 2
+		  )`,
+	)
+}
+
+// migrateChatUsers keeps the names of users without a role, so that their
+// transactions can show who wrote them.
+func migrateChatUsers(ctx context.Context, tx *sql.Tx) error {
+	return execAll(ctx, tx,
+		`CREATE TABLE chat_users (
+			chat_id  INTEGER NOT NULL,
+			user_id  INTEGER NOT NULL,
+			name     TEXT    NOT NULL,
+			seen_at  TEXT    NOT NULL,
+			PRIMARY KEY(chat_id, user_id)
+		)`,
+	)
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func TestMigrateTags(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	addTestAccount(t, s, 1, "cash")
+	for _, note := range []string{"обед #Еда #еда", "#ЁЛКА и #дом_2", "без тегов"} {
+		txs := model.NewTransaction(0, 100, note, 0, "100", 1)
+		if _, _, err := s.ApplyDeltaAndLog(ctx, 1, "cash", 100, txs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Run the step again over the notes, as on a database from before tags.
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := execAll(ctx, tx, `DROP TABLE txn_tags`, `DROP TABLE tags`); err != nil {
+			return err
+		}
+		return migrateTags(ctx, tx)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.note, g.name FROM txn_tags tt
+		JOIN tags g ON g.id = tt.tag_id
+		JOIN account_txns t ON t.id = tt.txn_id
+		ORDER BY t.id, g.name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	for rows.Next() {
+		var note, tag string
+		if err := rows.Scan(&note, &tag); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, note+": "+tag)
+	}
+	want := []string{"обед #Еда #еда: еда", "#ЁЛКА и #дом_2: дом_2", "#ЁЛКА и #дом_2: елка"}
+	if !slices.Equal(got, want) {
+		t.Errorf("tags %q, want %q", got, want)
+	}
+}
+
+func TestMigrateMinorUnits(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "legacy.db")
+
+	// A database from before migrations, with amounts in rubles.
+	db, err := sql.Open(driverName, "file:"+path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = func() error {
+		defer db.Close()
+		for _, q := range []string{
+			`CREATE TABLE accounts (
+				id INTEGER PRIMARY KEY AUTOINCREMENT, name TEXT NOT NULL, chat_id INTEGER NOT NULL,
+				balance REAL NOT NULL DEFAULT 0, created_at TEXT NOT NULL, UNIQUE(chat_id, name))`,
+			`CREATE TABLE account_txns (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				account_id INTEGER NOT NULL REFERENCES accounts(id) ON DELETE CASCADE,
+				amount REAL NOT NULL, expression TEXT NOT NULL, balance REAL NOT NULL,
+				note TEXT, created_at TEXT NOT NULL, created_by INTEGER)`,
+			`INSERT INTO accounts VALUES (1, 'cash', 1, 0.015, '1700000000'), (2, 'card', 1, 10.5, '1700000000')`,
+			`INSERT INTO account_txns(account_id, amount, expression, balance, created_at) VALUES
+				(1, 0.005, '0.005', 0.005, '1700000001'),
+				(2, 10.5, '10.5', 10.5, '1700000002'),
+				(1, 0.005, '0.005', 0.01, '1700000003'),
+				(1, 0.005, '0.005', 0.015, '1700000004')`,
+		} {
+			if _, err := db.ExecContext(ctx, q); err != nil {
+				return err
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := New(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.db.Close() })
+	if err := s.Init(ctx); err != nil {
+		t.Fatalf("Init: %v", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT account_id, amount, balance FROM account_txns ORDER BY id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got [][3]int64
+	for rows.Next() {
+		var r [3]int64
+		if err := rows.Scan(&r[0], &r[1], &r[2]); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, r)
+	}
+	want := [][3]int64{{1, 1, 1}, {2, 1050, 1050}, {1, 1, 2}, {1, 1, 3}}
+	if !slices.Equal(got, want) {
+		t.Errorf("txns %v, want %v", got, want)
+	}
+
+	if ds, err := s.Reconcile(ctx, 1, false); err != nil || len(ds) != 0 {
+		t.Errorf("Reconcile after migration = %+v, %v", ds, err)
+	}
+	f, err := s.Backup(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Validate(); err != nil {
+		t.Errorf("backup after migration: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// AddRates stores rates in one transaction. Rates are kept as exact
+// fractions, so 1/92.5 round-trips without loss.
+func (s *Storage) AddRates(ctx context.Context, rates ...*model.Rate) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		const q = `
+			INSERT INTO rates(chat_id, base, quote, rate, valid_from, created_by, created_at)
+			VALUES(?, ?, ?, ?, ?, ?, ?)
+		`
+		for _, r := range rates {
+			if r == nil || r.Rate == nil || r.Rate.Sign() <= 0 {
+				return fmt.Errorf("invalid rate")
+			}
+			res, err := tx.ExecContext(ctx, q, r.ChatId, r.Base, r.Quote, r.Rate.RatString(), r.ValidFrom, r.CreatedBy, r.CreatedAt)
+			if err != nil {
+				return fmt.Errorf("insert rate: %w", err)
+			}
+			id, err := res.LastInsertId()
+			if err != nil {
+				return fmt.Errorf("last insert id: %w", err)
+			}
+			r.Id = int(id)
+		}
+		return nil
+	})
+}
+
+// LatestRate returns how many units of quote one unit of base was worth at
+// the given moment, using the newest rate entered for the pair no later
+// than at. A stored rate for the opposite pair is inverted. It returns
+// ErrNotFound when neither direction has a rate yet.
+func (s *Storage) LatestRate(ctx context.Context, chatID int64, base, quote string, at time.Time) (*big.Rat, error) {
+	if base == quote {
+		return big.NewRat(1, 1), nil
+	}
+
+	const q = `
+		SELECT base, rate
+		FROM rates
+		WHERE chat_id = ?
+		  AND ((base = ? AND quote = ?) OR (base = ? AND quote = ?))
+		  AND CAST(valid_from AS INTEGER) <= ?
+		ORDER BY CAST(valid_from AS INTEGER) DESC, id DESC
+		LIMIT 1
+	`
+	var gotBase, raw string
+	err := s.db.QueryRowContext(ctx, q, chatID, base, quote, quote, base, at.Unix()).Scan(&gotBase, &raw)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select rate: %w", err)
+	}
+
+	r, ok := new(big.Rat).SetString(raw)
+	if !ok || r.Sign() <= 0 {
+		return nil, fmt.Errorf("corrupt rate %q", raw)
+	}
+	if gotBase != base {
+		r.Inv(r)
+	}
+	return r, nil
+}
+
+// ListRates returns the newest rate of every pair in the chat, or with base
+// and quote set, the history of that pair newest first.
+func (s *Storage) ListRates(ctx context.Context, chatID int64, base, quote string, limit int) ([]model.Rate, error) {
+	q := `
+		SELECT id, chat_id, base, quote, rate, valid_from, created_by, created_at
+		FROM rates r
+		WHERE chat_id = ?
+		  AND id = (
+			SELECT id FROM rates x
+			WHERE x.chat_id = r.chat_id AND x.base = r.base AND x.quote = r.quote
+			ORDER BY CAST(x.valid_from AS INTEGER) DESC, x.id DESC
+			LIMIT 1
+		  )
+		ORDER BY base, quote
+		LIMIT ?
+	`
+	args := []any{chatID, limit}
+	if base != "" {
+		q = `
+			SELECT id, chat_id, base, quote, rate, valid_from, created_by, created_at
+			FROM rates
+			WHERE chat_id = ? AND base = ? AND quote = ?
+			ORDER BY CAST(valid_from AS INTEGER) DESC, id DESC
+			LIMIT ?
+		`
+		args = []any{chatID, base, quote, limit}
+	}
+
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query rates: %w", err)
+	}
+	defer rows.Close()
+
+	var out []model.Rate
+	for rows.Next() {
+		var (
+			r         model.Rate
+			raw       string
+			createdBy sql.NullInt64
+		)
+		if err := rows.Scan(&r.Id, &r.ChatId, &r.Base, &r.Quote, &raw, &r.ValidFrom, &createdBy, &r.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan rate: %w", err)
+		}
+		rat, ok := new(big.Rat).SetString(raw)
+		if !ok {
+			return nil, fmt.Errorf("corrupt rate %q", raw)
+		}
+		r.Rate = rat
+		r.CreatedBy = createdBy.Int64
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,145 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// Discrepancy describes an account whose stored balances disagree with its
+// transactions.
+type Discrepancy struct {
+	Account  string
+	Currency string
+	// Balance is accounts.balance as stored, Sum the total of all amounts.
+	Balance model.Money
+	Sum     model.Money
+	// BadRunning counts transactions whose running balance differs from the
+	// cumulative sum of amounts up to and including them.
+	BadRunning int
+}
+
+// Reconcile checks every account of the chat: the account balance must
+// equal the sum of its transaction amounts, and each transaction's balance
+// the running sum in id order. With fix set, wrong values are rewritten in
+// the same transaction. The discrepancies found are returned either way.
+func (s *Storage) Reconcile(ctx context.Context, chatID int64, fix bool) ([]Discrepancy, error) {
+	var out []Discrepancy
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		accounts, err := chatAccountsTx(ctx, tx, chatID)
+		if err != nil {
+			return err
+		}
+
+		for _, acc := range accounts {
+			d, err := reconcileAccountTx(ctx, tx, acc, fix)
+			if err != nil {
+				return fmt.Errorf("reconcile %s: %w", acc.Name, err)
+			}
+			if d.Balance != d.Sum || d.BadRunning > 0 {
+				out = append(out, d)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func chatAccountsTx(ctx context.Context, tx *sql.Tx, chatID int64) ([]model.Account, error) {
+	const q = `
+		SELECT id, name, balance, currency
+		FROM accounts
+		WHERE chat_id = ?
+		ORDER BY created_at ASC
+	`
+	rows, err := tx.QueryContext(ctx, q, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("query accounts: %w", err)
+	}
+	defer rows.Close()
+
+	var out []model.Account
+	for rows.Next() {
+		acc := model.Account{ChatId: chatID}
+		if err := rows.Scan(&acc.Id, &acc.Name, &acc.Balance, &acc.Currency); err != nil {
+			return nil, fmt.Errorf("scan account: %w", err)
+		}
+		out = append(out, acc)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
+
+func reconcileAccountTx(ctx context.Context, tx *sql.Tx, acc model.Account, fix bool) (Discrepancy, error) {
+	d := Discrepancy{Account: acc.Name, Currency: acc.Currency, Balance: acc.Balance}
+
+	bad, sum, err := rebuildRunningBalancesTx(ctx, tx, acc.Id, fix)
+	if err != nil {
+		return d, err
+	}
+	d.Sum = sum
+	d.BadRunning = bad
+
+	if fix && d.Balance != d.Sum {
+		const upd = `UPDATE accounts SET balance = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, upd, d.Sum, acc.Id); err != nil {
+			return d, fmt.Errorf("fix balance: %w", err)
+		}
+	}
+	return d, nil
+}
+
+// rebuildRunningBalancesTx walks the account's transactions in id order,
+// counts rows whose balance is not the running sum and, with fix set,
+// rewrites them. The final sum is returned.
+func rebuildRunningBalancesTx(ctx context.Context, tx *sql.Tx, accountID int, fix bool) (bad int, sum model.Money, err error) {
+	const q = `SELECT id, amount, balance FROM account_txns WHERE account_id = ? ORDER BY id ASC`
+	rows, err := tx.QueryContext(ctx, q, accountID)
+	if err != nil {
+		return 0, 0, fmt.Errorf("query txs: %w", err)
+	}
+
+	type fixup struct {
+		id      int64
+		balance model.Money
+	}
+	var fixes []fixup
+	for rows.Next() {
+		var (
+			id              int64
+			amount, balance model.Money
+		)
+		if err := rows.Scan(&id, &amount, &balance); err != nil {
+			rows.Close()
+			return 0, 0, fmt.Errorf("scan tx: %w", err)
+		}
+		sum += amount
+		if balance != sum {
+			bad++
+			fixes = append(fixes, fixup{id, sum})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("rows error: %w", err)
+	}
+
+	if !fix {
+		return bad, sum, nil
+	}
+	const upd = `UPDATE account_txns SET balance = ? WHERE id = ?`
+	for _, f := range fixes {
+		if _, err := tx.ExecContext(ctx, upd, f.balance, f.id); err != nil {
+			return 0, 0, fmt.Errorf("fix running balance: %w", err)
+		}
+	}
+	return bad, sum, nil
+}
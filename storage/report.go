@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// PeriodTotals is the movement of an account, or of all accounts in one
+// currency, over a period. Closing is Opening plus Net; Net is In plus Out
+// for accounts.
+type PeriodTotals struct {
+	// Account is empty in the chat summary.
+	Account  string
+	Currency string
+	Opening  model.Money
+	In       model.Money
+	Out      model.Money
+	Net      model.Money
+	Closing  model.Money
+}
+
+// counted leaves out mistakes that were undone: reverted transactions and
+// their reversals cancel out and are neither income nor expense.
+const counted = `
+	SELECT account_id, amount, transfer_id, CAST(created_at AS INTEGER) AS ts
+	FROM account_txns
+	WHERE reverses_id IS NULL AND reverted = 0
+`
+
+// PeriodReport sums opening balance, income, expense and closing balance
+// over [from, to) for every account of the chat, or only accountID when
+// set, and a summary per currency. Zero bounds are open. Archived accounts
+// are listed only when they have a balance or movement. In the summary,
+// transfers between the chat's accounts are not counted as income or
+// expense, so its Net may differ from In plus Out for converting
+// transfers.
+func (s *Storage) PeriodReport(ctx context.Context, chatID int64, accountID int, from, to time.Time) (accounts, summary []PeriodTotals, err error) {
+	lo, hi := int64(math.MinInt64), int64(math.MaxInt64)
+	if !from.IsZero() {
+		lo = from.Unix()
+	}
+	if !to.IsZero() {
+		hi = to.Unix()
+	}
+
+	where := "a.chat_id = ?"
+	args := []any{lo, lo, hi, lo, hi, lo, hi, chatID}
+	if accountID != 0 {
+		where += " AND a.id = ?"
+		args = append(args, accountID)
+	}
+
+	q := `
+		SELECT name, currency, opening, inflow, outflow, net
+		FROM (
+			SELECT a.name, a.currency, a.archived_at, a.created_at, a.id,
+			       COALESCE(SUM(CASE WHEN t.ts < ? THEN t.amount END), 0) AS opening,
+			       COALESCE(SUM(CASE WHEN t.ts >= ? AND t.ts < ? AND t.amount > 0 THEN t.amount END), 0) AS inflow,
+			       COALESCE(SUM(CASE WHEN t.ts >= ? AND t.ts < ? AND t.amount < 0 THEN t.amount END), 0) AS outflow,
+			       COALESCE(SUM(CASE WHEN t.ts >= ? AND t.ts < ? THEN t.amount END), 0) AS net
+			FROM accounts a
+			LEFT JOIN (` + counted + `) t ON t.account_id = a.id
+			WHERE ` + where + `
+			GROUP BY a.id
+		)
+		WHERE archived_at IS NULL OR opening <> 0 OR inflow <> 0 OR outflow <> 0
+		ORDER BY created_at ASC, id ASC
+	`
+	if accounts, err = s.queryPeriodTotals(ctx, q, args); err != nil {
+		return nil, nil, err
+	}
+
+	q = `
+		SELECT '', a.currency,
+		       COALESCE(SUM(CASE WHEN t.ts < ? THEN t.amount END), 0),
+		       COALESCE(SUM(CASE WHEN t.ts >= ? AND t.ts < ? AND t.amount > 0 AND t.transfer_id IS NULL THEN t.amount END), 0),
+		       COALESCE(SUM(CASE WHEN t.ts >= ? AND t.ts < ? AND t.amount < 0 AND t.transfer_id IS NULL THEN t.amount END), 0),
+		       COALESCE(SUM(CASE WHEN t.ts >= ? AND t.ts < ? THEN t.amount END), 0)
+		FROM accounts a
+		JOIN (` + counted + `) t ON t.account_id = a.id
+		WHERE ` + where + `
+		GROUP BY a.currency
+		ORDER BY MIN(a.created_at) ASC
+	`
+	if summary, err = s.queryPeriodTotals(ctx, q, args); err != nil {
+		return nil, nil, err
+	}
+	return accounts, summary, nil
+}
+
+func (s *Storage) queryPeriodTotals(ctx context.Context, q string, args []any) ([]PeriodTotals, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query report: %w", err)
+	}
+	defer rows.Close()
+
+	var out []PeriodTotals
+	for rows.Next() {
+		var p PeriodTotals
+		if err := rows.Scan(&p.Account, &p.Currency, &p.Opening, &p.In, &p.Out, &p.Net); err != nil {
+			return nil, fmt.Errorf("scan report: %w", err)
+		}
+		p.Closing = p.Opening + p.Net
+		out = append(out, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
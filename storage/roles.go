@@ -0,0 +1,115 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// GetRole returns the stored role of a user in a chat, or ErrNotFound.
+func (s *Storage) GetRole(ctx context.Context, chatID, userID int64) (model.Role, error) {
+	const q = `SELECT role FROM chat_members WHERE chat_id = ? AND user_id = ?`
+
+	var role model.Role
+	err := s.db.QueryRowContext(ctx, q, chatID, userID).Scan(&role)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("select role: %w", err)
+	}
+	return role, nil
+}
+
+// SetRoles inserts or replaces roles in one transaction.
+func (s *Storage) SetRoles(ctx context.Context, members ...model.ChatMember) error {
+	return s.withTx(ctx, func(tx *sql.Tx) error {
+		const q = `
+			INSERT INTO chat_members(chat_id, user_id, name, role, updated_at)
+			VALUES(?, ?, ?, ?, ?)
+			ON CONFLICT(chat_id, user_id) DO UPDATE
+			   SET name = excluded.name, role = excluded.role, updated_at = excluded.updated_at
+		`
+		now := strconv.FormatInt(time.Now().UTC().Unix(), 10)
+		for _, m := range members {
+			if _, err := tx.ExecContext(ctx, q, m.ChatId, m.UserId, m.Name, m.Role, now); err != nil {
+				return fmt.Errorf("set role: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// SeenUser records the name a user of the chat goes by, for showing who
+// wrote a transaction when the user has no role of their own.
+func (s *Storage) SeenUser(ctx context.Context, chatID, userID int64, name string) error {
+	const q = `
+		INSERT INTO chat_users(chat_id, user_id, name, seen_at)
+		VALUES(?, ?, ?, ?)
+		ON CONFLICT(chat_id, user_id) DO UPDATE
+		   SET name = excluded.name, seen_at = excluded.seen_at
+		 WHERE name <> excluded.name
+	`
+	now := strconv.FormatInt(time.Now().UTC().Unix(), 10)
+	if _, err := s.db.ExecContext(ctx, q, chatID, userID, name, now); err != nil {
+		return fmt.Errorf("record user name: %w", err)
+	}
+	return nil
+}
+
+// CountOwners reports how many owners a chat has.
+func (s *Storage) CountOwners(ctx context.Context, chatID int64) (int, error) {
+	const q = `SELECT COUNT(*) FROM chat_members WHERE chat_id = ? AND role = ?`
+
+	var n int
+	if err := s.db.QueryRowContext(ctx, q, chatID, model.RoleOwner).Scan(&n); err != nil {
+		return 0, fmt.Errorf("count owners: %w", err)
+	}
+	return n, nil
+}
+
+// ListRoles returns every member with an explicit role, owners first.
+func (s *Storage) ListRoles(ctx context.Context, chatID int64) ([]model.ChatMember, error) {
+	const q = `
+		SELECT chat_id, user_id, name, role, updated_at
+		FROM chat_members
+		WHERE chat_id = ?
+		ORDER BY role DESC, name ASC
+	`
+	rows, err := s.db.QueryContext(ctx, q, chatID)
+	if err != nil {
+		return nil, fmt.Errorf("query roles: %w", err)
+	}
+	defer rows.Close()
+
+	var out []model.ChatMember
+	for rows.Next() {
+		var m model.ChatMember
+		if err := rows.Scan(&m.ChatId, &m.UserId, &m.Name, &m.Role, &m.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan role: %w", err)
+		}
+		out = append(out, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
+
+// GetTransaction returns a transaction by id, or ErrNotFound.
+func (s *Storage) GetTransaction(ctx context.Context, id int64) (*model.Transaction, error) {
+	const q = `SELECT ` + txnColumns + ` FROM account_txns t WHERE t.id = ?`
+
+	txs, err := scanTransaction(s.db.QueryRowContext(ctx, q, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select tx: %w", err)
+	}
+	return txs, nil
+}
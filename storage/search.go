@@ -0,0 +1,130 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// driverName is go-sqlite3 with the functions the queries of this package
+// use registered on every connection.
+const driverName = "sqlite3_ledgerbot"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			return conn.RegisterFunc("fold", foldCase, true)
+		},
+	})
+}
+
+// foldCase lowercases s for the LIKE fallback of Search. SQLite's own
+// LIKE and lower() only fold ASCII, so "сантехник" would miss "Сантехник".
+func foldCase(s string) string {
+	return strings.ToLower(s)
+}
+
+// The full-text index over notes and expressions needs SQLite's FTS5,
+// which go-sqlite3 only compiles in with the sqlite_fts5 build tag:
+//
+//	go build -tags sqlite_fts5
+//
+// deploy.py passes the tag by default.
+//
+// It is set up outside the versioned migrations because its presence
+// depends on the binary, not on the database: a build with FTS5 creates or
+// refreshes the index, a build without it drops the triggers that would
+// fail on every insert and Search falls back to LIKE.
+var searchTriggers = []string{
+	`CREATE TRIGGER account_txns_fts_ai AFTER INSERT ON account_txns BEGIN
+		INSERT INTO account_txns_fts(rowid, note, expression) VALUES (new.id, new.note, new.expression);
+	END`,
+	`CREATE TRIGGER account_txns_fts_ad AFTER DELETE ON account_txns BEGIN
+		INSERT INTO account_txns_fts(account_txns_fts, rowid, note, expression) VALUES ('delete', old.id, old.note, old.expression);
+	END`,
+	`CREATE TRIGGER account_txns_fts_au AFTER UPDATE OF note, expression ON account_txns BEGIN
+		INSERT INTO account_txns_fts(account_txns_fts, rowid, note, expression) VALUES ('delete', old.id, old.note, old.expression);
+		INSERT INTO account_txns_fts(rowid, note, expression) VALUES (new.id, new.note, new.expression);
+	END`,
+}
+
+var searchTriggerNames = []string{"account_txns_fts_ai", "account_txns_fts_ad", "account_txns_fts_au"}
+
+// initSearch sets up the full-text index when FTS5 is available and
+// reports whether it is.
+func (s *Storage) initSearch(ctx context.Context) (bool, error) {
+	var fts bool
+	if err := s.db.QueryRowContext(ctx, `SELECT sqlite_compileoption_used('ENABLE_FTS5')`).Scan(&fts); err != nil {
+		return false, fmt.Errorf("check fts5: %w", err)
+	}
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		var present int
+		const q = `SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = 'account_txns_fts_ai'`
+		if err := tx.QueryRowContext(ctx, q).Scan(&present); err != nil {
+			return fmt.Errorf("check search triggers: %w", err)
+		}
+
+		if !fts {
+			for _, name := range searchTriggerNames {
+				if _, err := tx.ExecContext(ctx, `DROP TRIGGER IF EXISTS `+name); err != nil {
+					return fmt.Errorf("drop search trigger: %w", err)
+				}
+			}
+			return nil
+		}
+		if present > 0 {
+			return nil
+		}
+
+		// Either a new database or one written without the triggers: build
+		// the index from scratch.
+		stmts := append([]string{
+			`CREATE VIRTUAL TABLE IF NOT EXISTS account_txns_fts USING fts5(
+				note, expression,
+				content = 'account_txns', content_rowid = 'id',
+				tokenize = 'unicode61 remove_diacritics 2'
+			)`,
+		}, searchTriggers...)
+		stmts = append(stmts, `INSERT INTO account_txns_fts(account_txns_fts) VALUES ('rebuild')`)
+		return execAll(ctx, tx, stmts...)
+	})
+	if err != nil {
+		return false, err
+	}
+	if !fts {
+		log.Print("sqlite built without FTS5, /find falls back to LIKE")
+	}
+	return fts, nil
+}
+
+// Search pages through the transactions matching filter whose note or
+// expression contains every word of query, like History. Words match
+// case-insensitively, and as prefixes when the full-text index is
+// available or anywhere in a word without it.
+func (s *Storage) Search(ctx context.Context, filter TxnFilter, query string, before, after int64, limit int) (HistoryPage, error) {
+	where, args := filter.where()
+
+	words := strings.Fields(query)
+	if s.fts && len(words) > 0 {
+		terms := make([]string, len(words))
+		for i, w := range words {
+			terms[i] = `"` + strings.ReplaceAll(w, `"`, `""`) + `"*`
+		}
+		where += " AND t.id IN (SELECT rowid FROM account_txns_fts WHERE account_txns_fts MATCH ?)"
+		args = append(args, strings.Join(terms, " "))
+	} else {
+		for _, w := range words {
+			pattern := "%" + likeEscaper.Replace(foldCase(w)) + "%"
+			where += ` AND (fold(COALESCE(t.note, '')) LIKE ? ESCAPE '\' OR fold(t.expression) LIKE ? ESCAPE '\')`
+			args = append(args, pattern, pattern)
+		}
+	}
+	return s.historyPage(ctx, where, args, before, after, limit)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
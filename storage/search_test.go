@@ -0,0 +1,44 @@
+package sqlite
+
+import (
+	"context"
+	"testing"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func TestSearchFoldsCase(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	addTestAccount(t, s, 1, "cash")
+	for _, note := range []string{"Сантехник Ёжиков", "ОБЕД в столовой", "50% скидка", ""} {
+		txs := model.NewTransaction(0, 100, note, 0, "100", 1)
+		if _, _, err := s.ApplyDeltaAndLog(ctx, 1, "cash", 100, txs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"сантехник", []string{"Сантехник Ёжиков"}},
+		{"САНТЕХНИК ёжиков", []string{"Сантехник Ёжиков"}},
+		{"обед", []string{"ОБЕД в столовой"}},
+		{"50%", []string{"50% скидка"}},
+		{"электрик", nil},
+	}
+	for _, tt := range tests {
+		page, err := s.Search(ctx, TxnFilter{ChatID: 1}, tt.query, 0, 0, 10)
+		if err != nil {
+			t.Fatalf("Search(%q): %v", tt.query, err)
+		}
+		var got []string
+		for _, e := range page.Entries {
+			got = append(got, e.Note)
+		}
+		if len(got) != len(tt.want) || (len(got) > 0 && got[0] != tt.want[0]) {
+			t.Errorf("Search(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
@@ -4,22 +4,35 @@ import (
 	"context"
 	"database/sql"
 	"encoding/csv"
+	"errors"
 	"fmt"
 	"os"
 	"strconv"
 	"strings"
 	"time"
 
-	_ "github.com/mattn/go-sqlite3"
 	"github.com/maxBezel/ledgerbot/model"
 )
 
+var (
+	ErrAlreadyReverted = errors.New("transaction already reverted")
+	ErrIsReversal      = errors.New("transaction is a reversal")
+	ErrNotFound        = errors.New("not found")
+	ErrArchived        = errors.New("account is archived")
+)
+
 type Storage struct {
 	db *sql.DB
+	// fts is set by Init when the full-text index is usable.
+	fts bool
 }
 
 func New(path string) (*Storage, error) {
-	db, err := sql.Open("sqlite3", path)
+	// Updates of different chats are handled concurrently: WAL lets readers
+	// proceed during a write, immediate transactions take the write lock up
+	// front instead of failing on upgrade, and writers wait for each other.
+	dsn := "file:" + path + "?_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+	db, err := sql.Open(driverName, dsn)
 	if err != nil {
 		return nil, fmt.Errorf("cant open database %w", err)
 	}
@@ -31,39 +44,18 @@ func New(path string) (*Storage, error) {
 	return &Storage{db: db}, nil
 }
 
+// Init applies any pending schema migrations. It fails with ErrSchemaTooNew
+// when the database was written by a newer version of the bot.
 func (storage *Storage) Init(ctx context.Context) error {
-	_, _ = storage.db.ExecContext(ctx, `PRAGMA foreign_keys = ON;`)
-
-	accountsQ := `
-	CREATE TABLE IF NOT EXISTS accounts (
-		id         INTEGER PRIMARY KEY AUTOINCREMENT,
-		name       TEXT    NOT NULL,
-		chat_id    INTEGER NOT NULL,
-		balance    REAL    NOT NULL DEFAULT 0,
-		created_at TEXT    NOT NULL,
-		UNIQUE(chat_id, name)
-	);`
-
-	txsQ := `
-	CREATE TABLE IF NOT EXISTS account_txns (
-	 	id          INTEGER PRIMARY KEY AUTOINCREMENT,
-	 	account_id  INTEGER NOT NULL
-	 	REFERENCES accounts(id) ON DELETE CASCADE,
-	 	amount      REAL    NOT NULL,
-		expression	TEXT    NOT NULL,
-		balance	    REAL    NOT NULL,
-	 	note        TEXT,
-	 	created_at  TEXT    NOT NULL,
-	 	created_by  INTEGER
-	);`
-
-	if _, err := storage.db.ExecContext(ctx, accountsQ); err != nil {
-		return fmt.Errorf("Failed to create accounts table %w", err)
-	}
-
-	if _, err := storage.db.ExecContext(ctx, txsQ); err != nil {
-		return fmt.Errorf("Failed to create txs table %w", err)
+	if err := storage.migrate(ctx); err != nil {
+		return fmt.Errorf("Failed to migrate database %w", err)
+	}
+
+	fts, err := storage.initSearch(ctx)
+	if err != nil {
+		return fmt.Errorf("Failed to set up search %w", err)
 	}
+	storage.fts = fts
 
 	return nil
 }
@@ -74,9 +66,9 @@ func (s *Storage) AddAccount(ctx context.Context, acc *model.Account) error {
 	}
 
 	res, err := s.db.ExecContext(ctx,
-		`INSERT INTO accounts(name, chat_id, balance, created_at)
-		 VALUES(?, ?, ?, ?)`,
-		acc.Name, acc.ChatId, acc.Balance, acc.CreatedAt,
+		`INSERT INTO accounts(name, chat_id, balance, currency, created_at)
+		 VALUES(?, ?, ?, ?, ?)`,
+		acc.Name, acc.ChatId, acc.Balance, acc.Currency, acc.CreatedAt,
 	)
 	if err != nil {
 		return fmt.Errorf("insert account: %w", err)
@@ -91,30 +83,11 @@ func (s *Storage) AddAccount(ctx context.Context, acc *model.Account) error {
 	return nil
 }
 
-func (s *Storage) RemoveAccount(ctx context.Context, chatId int64, name string) error {
-	q := `DELETE FROM accounts WHERE chat_id = ? AND name = ?`
-	res, err := s.db.ExecContext(ctx, q, chatId, name)
-	if err != nil {
-		return fmt.Errorf("could not remove account %w", err)
-	}
-
-	n, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("rows affected: %w", err)
-	}
-
-	if n == 0 {
-		return fmt.Errorf("account not found")
-	}
-
-	return nil
-}
-
 func (s *Storage) GetAll(ctx context.Context, chatId int64) ([]string, error) {
 	const q = `
 		SELECT name
 		FROM accounts
-		WHERE chat_id = ?
+		WHERE chat_id = ? AND archived_at IS NULL
 		ORDER BY created_at ASC
 	`
 
@@ -139,10 +112,10 @@ func (s *Storage) GetAll(ctx context.Context, chatId int64) ([]string, error) {
 	return names, nil
 }
 
-func (s *Storage) GetCurrentBalance(ctx context.Context, accountID int) (float64, error) {
+func (s *Storage) GetCurrentBalance(ctx context.Context, accountID int) (model.Money, error) {
 	const q = `SELECT balance FROM accounts WHERE id = ?`
 
-	var balance float64
+	var balance model.Money
 	if err := s.db.QueryRowContext(ctx, q, accountID).Scan(&balance); err != nil {
 		if err == sql.ErrNoRows {
 			return 0, fmt.Errorf("account not found with id %d", accountID)
@@ -153,7 +126,7 @@ func (s *Storage) GetCurrentBalance(ctx context.Context, accountID int) (float64
 	return balance, nil
 }
 
-func (s *Storage) ApplyDeltaAndLog(ctx context.Context, chatId int64, name string, delta float64, txs *model.Transaction) (newBalance float64, txnID int64, err error) {
+func (s *Storage) ApplyDeltaAndLog(ctx context.Context, chatId int64, name string, delta model.Money, txs *model.Transaction) (newBalance model.Money, txnID int64, err error) {
 	if name == "" {
 		return 0, 0, fmt.Errorf("empty account name")
 	}
@@ -162,35 +135,78 @@ func (s *Storage) ApplyDeltaAndLog(ctx context.Context, chatId int64, name strin
 	}
 
 	err = s.withTx(ctx, func(tx *sql.Tx) error {
-		var accountID int
-		row := tx.QueryRowContext(ctx, `
-			UPDATE accounts
-			   SET balance = balance + ?
-			 WHERE chat_id = ? AND name = ?
-			 RETURNING id, balance
-		`, delta, chatId, name)
-
-		if err := row.Scan(&accountID, &newBalance); err != nil {
-			if err == sql.ErrNoRows {
-				return fmt.Errorf("account not found")
-			}
-			return fmt.Errorf("update+returning: %w", err)
-		}
-
-		txs.AccountId = accountID
 		txs.Amount = delta
-		txs.Balance = newBalance
-
-		id, err := s.addTransactionTx(ctx, tx, txs)
-		if err != nil {
+		if err := s.applyDeltaTx(ctx, tx, chatId, name, txs); err != nil {
 			return err
 		}
-		txnID = id
+		newBalance = txs.Balance
+		txnID = int64(txs.Id)
 		return nil
 	})
 	return newBalance, txnID, err
 }
 
+// applyDeltaTx adds txs.Amount to the named account and logs txs with the
+// resulting balance. AccountId, Balance and Id of txs are filled in.
+func (s *Storage) applyDeltaTx(ctx context.Context, tx *sql.Tx, chatId int64, name string, txs *model.Transaction) error {
+	var (
+		accountID  int
+		newBalance model.Money
+	)
+	row := tx.QueryRowContext(ctx, `
+		UPDATE accounts
+		   SET balance = balance + ?
+		 WHERE chat_id = ? AND name = ? AND archived_at IS NULL
+		 RETURNING id, balance
+	`, txs.Amount, chatId, name)
+
+	if err := row.Scan(&accountID, &newBalance); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("account not found")
+		}
+		return fmt.Errorf("update+returning: %w", err)
+	}
+
+	txs.AccountId = accountID
+	txs.Balance = newBalance
+
+	_, err := s.addTransactionTx(ctx, tx, txs)
+	return err
+}
+
+// queryer is what read helpers need of *sql.DB, *sql.Tx and *sql.Conn.
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// readTx runs fn in a deferred transaction. Like withTx it sees a single
+// snapshot, but it only takes the write lock if fn writes, so a long read
+// does not hold up the writers. The driver begins every transaction as the
+// DSN's _txlock says, hence the explicit BEGIN on a connection of its own.
+func (s *Storage) readTx(ctx context.Context, fn func(queryer) error) error {
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("get conn: %w", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN DEFERRED`); err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	if err := fn(conn); err != nil {
+		// The context may be what failed; the rollback must still run
+		// before the connection goes back to the pool.
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT`); err != nil {
+		_, _ = conn.ExecContext(context.Background(), `ROLLBACK`)
+		return fmt.Errorf("commit: %w", err)
+	}
+	return nil
+}
+
 func (s *Storage) withTx(ctx context.Context, fn func(*sql.Tx) error) error {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
@@ -213,9 +229,12 @@ func (s *Storage) addTransactionTx(ctx context.Context, tx *sql.Tx, txs *model.T
 		return 0, fmt.Errorf("nil transaction")
 	}
 	res, err := tx.ExecContext(ctx,
-		`INSERT INTO account_txns(account_id, amount, note, balance, expression, created_at, created_by)
-		 VALUES(?, ?, ?, ?, ?, ?, ?)`,
+		`INSERT INTO account_txns(account_id, amount, note, balance, expression, created_at, created_by,
+		                          transfer_id, reverses_id, source_msg_id, reply_msg_id, rate, import_id)
+		 VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		txs.AccountId, txs.Amount, txs.Note, txs.Balance, txs.Expression, txs.CreatedAt, txs.CreatedBy,
+		nullID(txs.TransferId), nullID(txs.ReversesId), nullID(txs.SourceMsgId), nullID(txs.ReplyMsgId),
+		sql.NullString{String: txs.Rate, Valid: txs.Rate != ""}, nullID(txs.ImportId),
 	)
 	if err != nil {
 		return 0, fmt.Errorf("insert txs: %w", err)
@@ -225,9 +244,14 @@ func (s *Storage) addTransactionTx(ctx context.Context, tx *sql.Tx, txs *model.T
 		return 0, fmt.Errorf("last insert id: %w", err)
 	}
 	txs.Id = int(id)
+	if err := setTxnTagsTx(ctx, tx, id, txs.AccountId, txs.Note); err != nil {
+		return 0, err
+	}
 	return id, nil
 }
 
+// Exists reports whether the chat has an account with this name, archived or
+// not, since archived accounts keep their names.
 func (s *Storage) Exists(ctx context.Context, chatId int64, name string) (bool, error) {
 	q := `SELECT COUNT(*) FROM accounts WHERE chat_id = ? AND name = ?`
 
@@ -249,7 +273,41 @@ func (s *Storage) GetAccountID(ctx context.Context, chatID int64, name string) (
 	return id, nil
 }
 
-func (s *Storage) RevertTransaction(ctx context.Context, txsId int64) (newBalance float64, delta float64, err error) {
+// GetAccount returns the named active account of the chat or ErrNotFound.
+// Archived accounts are not returned.
+func (s *Storage) GetAccount(ctx context.Context, chatID int64, name string) (*model.Account, error) {
+	const q = `SELECT id, name, chat_id, balance, currency, created_at FROM accounts WHERE chat_id = ? AND name = ? AND archived_at IS NULL`
+
+	var acc model.Account
+	err := s.db.QueryRowContext(ctx, q, chatID, name).Scan(&acc.Id, &acc.Name, &acc.ChatId, &acc.Balance, &acc.Currency, &acc.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select account: %w", err)
+	}
+	return &acc, nil
+}
+
+// GetAccountByID returns an active account of the chat by id or ErrNotFound.
+func (s *Storage) GetAccountByID(ctx context.Context, chatID int64, id int) (*model.Account, error) {
+	const q = `SELECT id, name, chat_id, balance, currency, created_at FROM accounts WHERE chat_id = ? AND id = ? AND archived_at IS NULL`
+
+	var acc model.Account
+	err := s.db.QueryRowContext(ctx, q, chatID, id).Scan(&acc.Id, &acc.Name, &acc.ChatId, &acc.Balance, &acc.Currency, &acc.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select account: %w", err)
+	}
+	return &acc, nil
+}
+
+// RevertTransaction appends a compensating entry for txsId, linked through
+// reverses_id, and marks the original as reverted. Nothing is deleted, so
+// the statement keeps both entries.
+func (s *Storage) RevertTransaction(ctx context.Context, txsId int64, revertedBy int64) (newBalance model.Money, delta model.Money, err error) {
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return 0, 0, fmt.Errorf("begin tx: %w", err)
@@ -260,57 +318,85 @@ func (s *Storage) RevertTransaction(ctx context.Context, txsId int64) (newBalanc
 		}
 	}()
 
-	var (
-		amount    float64
-		accountID int64
-	)
-
-	const sel = `SELECT amount, account_id FROM account_txns WHERE id = ?`
-	if err = tx.QueryRowContext(ctx, sel, txsId).Scan(&amount, &accountID); err != nil {
+	var transferID sql.NullInt64
+	const sel = `SELECT transfer_id FROM account_txns WHERE id = ?`
+	if err = tx.QueryRowContext(ctx, sel, txsId).Scan(&transferID); err != nil {
 		return 0, 0, fmt.Errorf("select tx: %w", err)
 	}
+	if transferID.Valid {
+		return 0, 0, fmt.Errorf("transaction is part of transfer %d", transferID.Int64)
+	}
 
-	const upd = `UPDATE accounts SET balance = balance - ? WHERE id = ?`
-	res, err := tx.ExecContext(ctx, upd, amount, accountID)
+	rev, err := s.reverseTx(ctx, tx, txsId, revertedBy)
 	if err != nil {
-		return 0, 0, fmt.Errorf("update balance: %w", err)
+		return 0, 0, err
 	}
-	if n, _ := res.RowsAffected(); n == 0 {
-		return 0, 0, fmt.Errorf("account not found for transaction")
+
+	if err = tx.Commit(); err != nil {
+		return 0, 0, fmt.Errorf("commit: %w", err)
 	}
 
-	const del = `DELETE FROM account_txns WHERE id = ?`
-	res, err = tx.ExecContext(ctx, del, txsId)
+	return rev.Balance, -rev.Amount, nil
+}
+
+// reverseTx marks txsId as reverted and logs the opposite amount against
+// the same account. The inserted reversal is returned.
+func (s *Storage) reverseTx(ctx context.Context, tx *sql.Tx, txsId int64, revertedBy int64) (*model.Transaction, error) {
+	var (
+		amount     model.Money
+		accountID  int
+		reverted   bool
+		reversesID sql.NullInt64
+	)
+
+	const sel = `SELECT amount, account_id, reverted, reverses_id FROM account_txns WHERE id = ?`
+	if err := tx.QueryRowContext(ctx, sel, txsId).Scan(&amount, &accountID, &reverted, &reversesID); err != nil {
+		return nil, fmt.Errorf("select tx: %w", err)
+	}
+	if reversesID.Valid {
+		return nil, ErrIsReversal
+	}
+	if reverted {
+		return nil, ErrAlreadyReverted
+	}
+
+	const mark = `UPDATE account_txns SET reverted = 1 WHERE id = ? AND reverted = 0`
+	res, err := tx.ExecContext(ctx, mark, txsId)
 	if err != nil {
-		return 0, 0, fmt.Errorf("delete tx: %w", err)
+		return nil, fmt.Errorf("mark reverted: %w", err)
 	}
 	if n, _ := res.RowsAffected(); n == 0 {
-		return 0, 0, fmt.Errorf("transaction already deleted")
+		return nil, ErrAlreadyReverted
 	}
 
-	const selBal = `SELECT balance FROM accounts WHERE id = ?`
-	if err = tx.QueryRowContext(ctx, selBal, accountID).Scan(&newBalance); err != nil {
-		return 0, 0, fmt.Errorf("select balance: %w", err)
-	}
+	rev := model.NewTransaction(accountID, -amount, "", 0, (-amount).String(), revertedBy)
+	rev.ReversesId = int(txsId)
 
-	if err = tx.Commit(); err != nil {
-		return 0, 0, fmt.Errorf("commit: %w", err)
+	const upd = `UPDATE accounts SET balance = balance + ? WHERE id = ? AND archived_at IS NULL RETURNING balance`
+	if err := tx.QueryRowContext(ctx, upd, rev.Amount, accountID).Scan(&rev.Balance); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrArchived
+		}
+		return nil, fmt.Errorf("update balance: %w", err)
 	}
 
-	return newBalance, amount, nil
+	if _, err := s.addTransactionTx(ctx, tx, rev); err != nil {
+		return nil, err
+	}
+	return rev, nil
 }
 
-
 type AccountBalance struct {
-	Name    string
-	Balance float64
+	Name     string
+	Balance  model.Money
+	Currency string
 }
 
 func (s *Storage) ListAccountBalances(ctx context.Context, chatID int64) ([]AccountBalance, error) {
 	const q = `
-		SELECT name, balance
+		SELECT name, balance, currency
 		FROM accounts
-		WHERE chat_id = ?
+		WHERE chat_id = ? AND archived_at IS NULL
 		ORDER BY created_at ASC
 	`
 
@@ -323,7 +409,7 @@ func (s *Storage) ListAccountBalances(ctx context.Context, chatID int64) ([]Acco
 	var out []AccountBalance
 	for rows.Next() {
 		var ab AccountBalance
-		if err := rows.Scan(&ab.Name, &ab.Balance); err != nil {
+		if err := rows.Scan(&ab.Name, &ab.Balance, &ab.Currency); err != nil {
 			return nil, fmt.Errorf("scan balance: %w", err)
 		}
 		out = append(out, ab)
@@ -334,8 +420,9 @@ func (s *Storage) ListAccountBalances(ctx context.Context, chatID int64) ([]Acco
 	return out, nil
 }
 
-func (s *Storage) WriteTransactionsCsv(ctx context.Context, chatId int64, filename string) error {
-	const q = `
+func (s *Storage) WriteTransactionsCsv(ctx context.Context, filter TxnFilter, filename string) error {
+	where, args := filter.where()
+	q := `
 		SELECT
 			a.name,
 			t.created_by,
@@ -343,14 +430,18 @@ func (s *Storage) WriteTransactionsCsv(ctx context.Context, chatId int64, filena
 			t.expression,
 			t.amount,
 			t.balance,
-			t.note
+			t.note,
+			t.id,
+			t.reverses_id,
+			t.reverted,
+			a.currency
 		FROM account_txns t
 		JOIN accounts a ON a.id = t.account_id
-		WHERE a.chat_id = ?
+		` + where + `
 		ORDER BY t.created_at DESC, t.id DESC
 	`
 
-	rows, err := s.db.QueryContext(ctx, q, chatId)
+	rows, err := s.db.QueryContext(ctx, q, args...)
 	if err != nil {
 		return fmt.Errorf("WriteTransactionsCsv unable to query: %v", err)
 	}
@@ -367,6 +458,7 @@ func (s *Storage) WriteTransactionsCsv(ctx context.Context, chatId int64, filena
 
 	if err := w.Write([]string{
 		"account", "userId", "createdAt", "expression", "eval", "account value", "comment",
+		"txnId", "reverses", "reverted", "currency",
 	}); err != nil {
 		return fmt.Errorf("write header: %w", err)
 	}
@@ -377,12 +469,16 @@ func (s *Storage) WriteTransactionsCsv(ctx context.Context, chatId int64, filena
 			createdBy sql.NullInt64
 			createdAt string
 			expr      string
-			amount    float64
-			balance   float64
+			amount    model.Money
+			balance   model.Money
 			note      sql.NullString
+			txnID     int64
+			reverses  sql.NullInt64
+			reverted  bool
+			currency  string
 		)
 
-		if err := rows.Scan(&account, &createdBy, &createdAt, &expr, &amount, &balance, &note); err != nil {
+		if err := rows.Scan(&account, &createdBy, &createdAt, &expr, &amount, &balance, &note, &txnID, &reverses, &reverted, &currency); err != nil {
 			return fmt.Errorf("scan row: %w", err)
 		}
 
@@ -396,6 +492,16 @@ func (s *Storage) WriteTransactionsCsv(ctx context.Context, chatId int64, filena
 			comment = note.String
 		}
 
+		reversesOut := ""
+		if reverses.Valid {
+			reversesOut = strconv.FormatInt(reverses.Int64, 10)
+		}
+
+		revertedOut := ""
+		if reverted {
+			revertedOut = "yes"
+		}
+
 		createdAtOut := createdAt
 
 		sec, err := strconv.ParseInt(strings.TrimSpace(createdAt), 10, 64)
@@ -411,9 +517,13 @@ func (s *Storage) WriteTransactionsCsv(ctx context.Context, chatId int64, filena
 			userID,
 			createdAtOut,
 			expr,
-			strconv.FormatFloat(amount, 'f', 2, 64),
-			strconv.FormatFloat(balance, 'f', 2, 64),
+			amount.String(),
+			balance.String(),
 			comment,
+			strconv.FormatInt(txnID, 10),
+			reversesOut,
+			revertedOut,
+			currency,
 		}); err != nil {
 			return fmt.Errorf("write row: %w", err)
 		}
@@ -0,0 +1,117 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// setTxnTagsTx replaces the tags of a transaction with the hashtags of its
+// note, creating tags of the account's chat as needed.
+func setTxnTagsTx(ctx context.Context, tx *sql.Tx, txnID int64, accountID int, note string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM txn_tags WHERE txn_id = ?`, txnID); err != nil {
+		return fmt.Errorf("clear tags: %w", err)
+	}
+
+	for _, tag := range model.ParseTags(note) {
+		const ins = `INSERT OR IGNORE INTO tags(chat_id, name) SELECT chat_id, ? FROM accounts WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, ins, tag, accountID); err != nil {
+			return fmt.Errorf("insert tag: %w", err)
+		}
+		const link = `
+			INSERT OR IGNORE INTO txn_tags(txn_id, tag_id)
+			SELECT ?, g.id
+			FROM tags g
+			JOIN accounts a ON a.chat_id = g.chat_id
+			WHERE a.id = ? AND g.name = ?
+		`
+		if _, err := tx.ExecContext(ctx, link, txnID, accountID, tag); err != nil {
+			return fmt.Errorf("link tag: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetTag returns a tag of the chat by name, with or without the leading #,
+// or ErrNotFound.
+func (s *Storage) GetTag(ctx context.Context, chatID int64, name string) (*model.Tag, error) {
+	tags := model.ParseTags("#" + name)
+	if len(tags) != 1 {
+		tags = model.ParseTags(name)
+	}
+	if len(tags) != 1 {
+		return nil, ErrNotFound
+	}
+	return s.getTag(ctx, `chat_id = ? AND name = ?`, chatID, tags[0])
+}
+
+// GetTagByID returns a tag of the chat by id or ErrNotFound.
+func (s *Storage) GetTagByID(ctx context.Context, chatID int64, id int) (*model.Tag, error) {
+	return s.getTag(ctx, `chat_id = ? AND id = ?`, chatID, id)
+}
+
+func (s *Storage) getTag(ctx context.Context, cond string, args ...any) (*model.Tag, error) {
+	var t model.Tag
+	err := s.db.QueryRowContext(ctx, `SELECT id, chat_id, name FROM tags WHERE `+cond, args...).Scan(&t.Id, &t.ChatId, &t.Name)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("select tag: %w", err)
+	}
+	return &t, nil
+}
+
+// TagTotal sums the transactions with one tag in one currency. An empty
+// Tag stands for untagged transactions.
+type TagTotal struct {
+	Tag      string
+	Currency string
+	In       model.Money
+	Out      model.Money
+	Count    int
+}
+
+// TagTotals sums income and expense per tag and currency over [from, to);
+// zero bounds are open. Transfers, reverted transactions and their
+// reversals are left out, as they are not income or expense. A transaction
+// with several tags counts towards each. Tags are ordered by expense,
+// largest first, with untagged transactions last.
+func (s *Storage) TagTotals(ctx context.Context, chatID int64, from, to time.Time) ([]TagTotal, error) {
+	where, args := TxnFilter{ChatID: chatID, From: from, To: to}.where()
+	q := `
+		SELECT COALESCE(g.name, ''), a.currency,
+		       SUM(CASE WHEN t.amount > 0 THEN t.amount ELSE 0 END),
+		       SUM(CASE WHEN t.amount < 0 THEN t.amount ELSE 0 END),
+		       COUNT(*)
+		FROM account_txns t
+		JOIN accounts a ON a.id = t.account_id
+		LEFT JOIN txn_tags tt ON tt.txn_id = t.id
+		LEFT JOIN tags g ON g.id = tt.tag_id
+		` + where + `
+		  AND t.transfer_id IS NULL AND t.reverses_id IS NULL AND t.reverted = 0
+		GROUP BY g.name, a.currency
+		ORDER BY g.name IS NULL, 4 ASC, 3 DESC, g.name ASC
+	`
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query tag totals: %w", err)
+	}
+	defer rows.Close()
+
+	var out []TagTotal
+	for rows.Next() {
+		var t TagTotal
+		if err := rows.Scan(&t.Tag, &t.Currency, &t.In, &t.Out, &t.Count); err != nil {
+			return nil, fmt.Errorf("scan tag total: %w", err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %w", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,125 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// TransferLeg is one side of a transfer after it was applied or reverted.
+type TransferLeg struct {
+	Account  string
+	Currency string
+	Amount   model.Money
+	Balance  model.Money
+}
+
+// Transfer atomically logs out against the from account and in against the
+// to account. Both rows share a transfer_id equal to the id of the outgoing
+// leg, which is returned. Amounts are taken from out and in as given, so the
+// caller decides their signs; AccountId, Balance, Id and TransferId are
+// filled in.
+func (s *Storage) Transfer(ctx context.Context, chatId int64, from, to string, out, in *model.Transaction) (transferID int64, err error) {
+	if from == "" || to == "" {
+		return 0, fmt.Errorf("empty account name")
+	}
+	if from == to {
+		return 0, fmt.Errorf("transfer to the same account")
+	}
+	if out == nil || in == nil {
+		return 0, fmt.Errorf("nil transaction")
+	}
+
+	err = s.withTx(ctx, func(tx *sql.Tx) error {
+		if err := s.applyDeltaTx(ctx, tx, chatId, from, out); err != nil {
+			return fmt.Errorf("transfer from %s: %w", from, err)
+		}
+		in.TransferId = out.Id
+		if err := s.applyDeltaTx(ctx, tx, chatId, to, in); err != nil {
+			return fmt.Errorf("transfer to %s: %w", to, err)
+		}
+
+		const link = `UPDATE account_txns SET transfer_id = ? WHERE id = ?`
+		if _, err := tx.ExecContext(ctx, link, out.Id, out.Id); err != nil {
+			return fmt.Errorf("link transfer: %w", err)
+		}
+		out.TransferId = out.Id
+		transferID = int64(out.Id)
+		return nil
+	})
+	return transferID, err
+}
+
+// RevertTransfer appends reversal entries for both legs of a transfer in
+// one transaction and returns the reverted legs with the resulting account
+// balances. The reversal legs are linked into a transfer of their own.
+func (s *Storage) RevertTransfer(ctx context.Context, transferID int64, revertedBy int64) ([]TransferLeg, error) {
+	var legs []TransferLeg
+
+	err := s.withTx(ctx, func(tx *sql.Tx) error {
+		const sel = `
+			SELECT t.id, a.name, a.currency
+			FROM account_txns t
+			JOIN accounts a ON a.id = t.account_id
+			WHERE t.transfer_id = ?
+			ORDER BY t.id ASC
+		`
+		rows, err := tx.QueryContext(ctx, sel, transferID)
+		if err != nil {
+			return fmt.Errorf("select transfer: %w", err)
+		}
+
+		var (
+			ids   []int64
+			names []string
+			curs  []string
+		)
+		for rows.Next() {
+			var (
+				id        int64
+				name, cur string
+			)
+			if err := rows.Scan(&id, &name, &cur); err != nil {
+				rows.Close()
+				return fmt.Errorf("scan transfer leg: %w", err)
+			}
+			ids = append(ids, id)
+			names = append(names, name)
+			curs = append(curs, cur)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("rows error: %w", err)
+		}
+		if len(ids) == 0 {
+			return fmt.Errorf("transfer %d not found", transferID)
+		}
+
+		var revGroup int
+		for i, id := range ids {
+			rev, err := s.reverseTx(ctx, tx, id, revertedBy)
+			if err != nil {
+				return err
+			}
+			if revGroup == 0 {
+				revGroup = rev.Id
+			}
+			const link = `UPDATE account_txns SET transfer_id = ? WHERE id = ?`
+			if _, err := tx.ExecContext(ctx, link, revGroup, rev.Id); err != nil {
+				return fmt.Errorf("link reversal: %w", err)
+			}
+			legs = append(legs, TransferLeg{Account: names[i], Currency: curs[i], Amount: -rev.Amount, Balance: rev.Balance})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return legs, nil
+}
+
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
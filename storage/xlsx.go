@@ -0,0 +1,233 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/maxBezel/ledgerbot/internal/xlsx"
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+// xlsxColumns are the columns of an account sheet; amounts are in column D.
+var xlsxColumns = []string{
+	"Дата", "Автор", "Выражение", "Сумма", "Баланс", "Комментарий", "Операция", "Отменяет", "Отменена",
+}
+
+const (
+	xlsxAmountCol   = 3
+	xlsxReversesCol = 7
+	xlsxRevertedCol = 8
+)
+
+// WriteTransactionsXlsx writes the transactions matching filter to an
+// Excel workbook: a summary sheet followed by one sheet per account, in
+// time order, each with a frozen header and SUM/SUMIFS totals. Income and
+// expense leave out undone entries and their reversals, so an undo doesn't
+// count twice; the change and the closing balance include every row.
+func (s *Storage) WriteTransactionsXlsx(ctx context.Context, filter TxnFilter, filename string) error {
+	where, args := filter.where()
+	q := `
+		SELECT a.name, a.currency, ` + authorColumn + `, ` + txnColumns + `
+		FROM account_txns t
+		JOIN accounts a ON a.id = t.account_id` + authorJoin + `
+		` + where + `
+		ORDER BY a.created_at ASC, a.id ASC, t.id ASC
+	`
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return fmt.Errorf("query transactions: %w", err)
+	}
+	defer rows.Close()
+
+	type accountSheet struct {
+		name, currency string
+		txs            []HistoryEntry
+	}
+	var sheets []*accountSheet
+	for rows.Next() {
+		var e HistoryEntry
+		if e.Transaction, err = scanTransaction(rows, &e.Account, &e.Currency, &e.Author); err != nil {
+			return fmt.Errorf("scan transaction: %w", err)
+		}
+		if n := len(sheets); n == 0 || sheets[n-1].txs[0].AccountId != e.AccountId {
+			sheets = append(sheets, &accountSheet{name: e.Account, currency: e.Currency})
+		}
+		last := sheets[len(sheets)-1]
+		last.txs = append(last.txs, e)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("rows error: %w", err)
+	}
+	rows.Close()
+
+	var wb xlsx.Workbook
+	summary := wb.AddSheet("Сводка")
+	summary.FreezeHeader = true
+	summary.Widths = []float64{24, 10, 11, 16, 16, 16, 18}
+	summary.Append(
+		xlsx.Text("Счет").Bold(), xlsx.Text("Валюта").Bold(), xlsx.Text("Операций").Bold(),
+		xlsx.Text("Приход").Bold(), xlsx.Text("Расход").Bold(), xlsx.Text("Изменение").Bold(),
+		xlsx.Text("Баланс на конец").Bold(),
+	)
+
+	type sums struct{ in, out, change model.Money }
+	var (
+		currencies []string
+		byCurrency = make(map[string]*sums)
+	)
+	for _, acc := range sheets {
+		sheet := wb.AddSheet(acc.name)
+		sheet.FreezeHeader = true
+		sheet.Widths = []float64{17, 18, 20, 14, 14, 40, 10, 10, 10}
+		header := make([]xlsx.Cell, len(xlsxColumns))
+		for i, h := range xlsxColumns {
+			header[i] = xlsx.Text(h).Bold()
+		}
+		sheet.Append(header...)
+
+		var in, out, change model.Money
+		for _, e := range acc.txs {
+			row, err := xlsxRow(e)
+			if err != nil {
+				return err
+			}
+			sheet.Append(row...)
+			change += e.Amount
+			switch {
+			case e.Reverted || e.ReversesId != 0:
+			case e.Amount > 0:
+				in += e.Amount
+			default:
+				out += e.Amount
+			}
+		}
+		closing, err := s.closingBalance(ctx, acc.txs[0].AccountId, filter.To)
+		if err != nil {
+			return err
+		}
+
+		first, last := 2, sheet.Rows()
+		local := func(col int) string {
+			return fmt.Sprintf("%[1]s%[2]d:%[1]s%[3]d", xlsx.Column(col), first, last)
+		}
+		// sumifs adds up the amounts of one sign, skipping undone entries
+		// and reversals: both marker columns must be empty.
+		sumifs := func(ref func(col int) string, cond string) string {
+			return fmt.Sprintf(`SUMIFS(%s,%s,"%s",%s,"",%s,"")`,
+				ref(xlsxAmountCol), ref(xlsxAmountCol), cond, ref(xlsxReversesCol), ref(xlsxRevertedCol))
+		}
+		sheet.Append()
+		sheet.Append(xlsx.Text("Приход"), xlsx.Cell{}, xlsx.Cell{}, xlsx.Formula(sumifs(local, ">0"), in.Float()))
+		sheet.Append(xlsx.Text("Расход"), xlsx.Cell{}, xlsx.Cell{}, xlsx.Formula(sumifs(local, "<0"), out.Float()))
+		sheet.Append(xlsx.Text("Итого").Bold(), xlsx.Cell{}, xlsx.Cell{}, xlsx.Formula("SUM("+local(xlsxAmountCol)+")", change.Float()).Bold())
+
+		remote := func(col int) string { return xlsx.Range(sheet, col, first, last) }
+		summary.Append(
+			xlsx.Text(acc.name),
+			xlsx.Text(acc.currency),
+			xlsx.Int(int64(len(acc.txs))),
+			xlsx.Formula(sumifs(remote, ">0"), in.Float()),
+			xlsx.Formula(sumifs(remote, "<0"), out.Float()),
+			xlsx.Formula("SUM("+remote(xlsxAmountCol)+")", change.Float()),
+			xlsx.Amount(closing.Float()),
+		)
+
+		if byCurrency[acc.currency] == nil {
+			byCurrency[acc.currency] = &sums{}
+			currencies = append(currencies, acc.currency)
+		}
+		byCurrency[acc.currency].in += in
+		byCurrency[acc.currency].out += out
+		byCurrency[acc.currency].change += change
+	}
+
+	// Totals per currency sum the account rows above by their currency cell.
+	if n := summary.Rows(); n > 1 {
+		summary.Append()
+		for _, cur := range currencies {
+			t := byCurrency[cur]
+			sumif := func(col int) string {
+				c := xlsx.Column(col)
+				return fmt.Sprintf(`SUMIF($B$2:$B$%d,"%s",%s2:%s%d)`, n, strings.ReplaceAll(cur, `"`, `""`), c, c, n)
+			}
+			summary.Append(
+				xlsx.Text("Итого").Bold(),
+				xlsx.Text(cur).Bold(),
+				xlsx.Cell{},
+				xlsx.Formula(sumif(3), t.in.Float()).Bold(),
+				xlsx.Formula(sumif(4), t.out.Float()).Bold(),
+				xlsx.Formula(sumif(5), t.change.Float()).Bold(),
+			)
+		}
+		summary.Append()
+		summary.Append(xlsx.Text("Приход и расход без отмененных операций и их отмен; изменение учитывает все операции."))
+		summary.Append(xlsx.Text("Баланс на конец — баланс счета на конец периода, без учета фильтров по тегу и сумме."))
+	}
+
+	f, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("create file: %w", err)
+	}
+	defer f.Close()
+	if err := wb.Write(f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// closingBalance is the balance of the account after its last transaction
+// before to, or its current balance when to is zero. Tag and amount filters
+// don't apply: the balance covers every transaction of the account.
+func (s *Storage) closingBalance(ctx context.Context, accountID int, to time.Time) (model.Money, error) {
+	hi := int64(math.MaxInt64)
+	if !to.IsZero() {
+		hi = to.Unix()
+	}
+	var bal model.Money
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE((
+			SELECT balance FROM account_txns
+			WHERE account_id = ? AND CAST(created_at AS INTEGER) < ?
+			ORDER BY id DESC LIMIT 1
+		), 0)`, accountID, hi).Scan(&bal)
+	if err != nil {
+		return 0, fmt.Errorf("query closing balance: %w", err)
+	}
+	return bal, nil
+}
+
+func xlsxRow(e HistoryEntry) ([]xlsx.Cell, error) {
+	sec, err := strconv.ParseInt(strings.TrimSpace(e.CreatedAt), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("parse created_at of txn %d: %w", e.Id, err)
+	}
+
+	author := xlsx.Text(e.Author)
+	if e.Author == "" && e.CreatedBy != 0 {
+		author = xlsx.Text(fmt.Sprintf("неизвестен (id %d)", e.CreatedBy))
+	}
+	reverses := xlsx.Cell{}
+	if e.ReversesId != 0 {
+		reverses = xlsx.Int(int64(e.ReversesId))
+	}
+	reverted := xlsx.Cell{}
+	if e.Reverted {
+		reverted = xlsx.Text("да")
+	}
+	return []xlsx.Cell{
+		xlsx.Date(time.Unix(sec, 0)),
+		author,
+		xlsx.Text(e.Expression),
+		xlsx.Amount(e.Amount.Float()),
+		xlsx.Amount(e.Balance.Float()),
+		xlsx.Text(e.Note),
+		xlsx.Int(int64(e.Id)),
+		reverses,
+		reverted,
+	}, nil
+}
@@ -0,0 +1,78 @@
+package sqlite
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/maxBezel/ledgerbot/model"
+)
+
+func TestXlsxSummary(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStorage(t)
+	addTestAccount(t, s, 1, "cash")
+
+	for _, e := range []struct {
+		amount model.Money
+		note   string
+	}{{100000, "зарплата"}, {-2000, "обед #еда"}, {-3000, "ужин #еда"}} {
+		txn := model.NewTransaction(0, 0, e.note, 0, e.amount.String(), 1)
+		if _, _, err := s.ApplyDeltaAndLog(ctx, 1, "cash", e.amount, txn); err != nil {
+			t.Fatal(err)
+		}
+	}
+	txn := model.NewTransaction(0, 0, "кофе #еда", 0, "-5", 1)
+	_, id, err := s.ApplyDeltaAndLog(ctx, 1, "cash", -500, txn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.RevertTransaction(ctx, id, 1); err != nil {
+		t.Fatal(err)
+	}
+	tag, err := s.GetTag(ctx, 1, "еда")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "out.xlsx")
+	if err := s.WriteTransactionsXlsx(ctx, TxnFilter{ChatID: 1, TagID: tag.Id}, path); err != nil {
+		t.Fatal(err)
+	}
+	summary := readXlsxPart(t, path, "xl/worksheets/sheet1.xml")
+
+	// The undone coffee stays out of the expense but not out of the change,
+	// and the closing balance is the account's, not the last tagged row's.
+	for _, want := range []string{
+		`<v>-50</v>`,
+		`<v>-55</v>`,
+		`<v>950</v>`,
+		`,&#34;&lt;0&#34;,&#39;cash&#39;!H2:H4,&#34;&#34;,&#39;cash&#39;!I2:I4,&#34;&#34;)`,
+	} {
+		if !strings.Contains(summary, want) {
+			t.Errorf("summary has no %s:\n%s", want, summary)
+		}
+	}
+}
+
+func readXlsxPart(t *testing.T, path, name string) string {
+	t.Helper()
+	zr, err := zip.OpenReader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zr.Close()
+	f, err := zr.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	b, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}